@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/url"
 	"os"
 	"path"
@@ -11,6 +12,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/internal"
@@ -21,6 +25,9 @@ import (
 const ReplicaClientType = "abs"
 
 var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.SnapshotRangeReader = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
 
 // ReplicaClient is a client for writing snapshots & WAL segments to disk.
 type ReplicaClient struct {
@@ -32,6 +39,26 @@ type ReplicaClient struct {
 	AccountKey  string
 	Endpoint    string
 
+	// Shared access signature appended to all requests. Used instead of the
+	// account key, if specified.
+	SASToken string
+
+	// Connection string containing the account name, endpoint & credentials.
+	// Values are only used if not set on the fields above.
+	ConnectionString string
+
+	// Azure AD credentials. A service principal is used if ClientSecret is
+	// set. Otherwise, the managed identity is used if UseManagedIdentity is
+	// set. ClientID selects a user-assigned managed identity.
+	TenantID           string
+	ClientID           string
+	ClientSecret       string
+	UseManagedIdentity bool
+
+	// If true, the account name is included in the endpoint path instead of
+	// the host name. Required for emulators such as Azurite.
+	ForcePathStyle bool
+
 	// Azure Blob Storage container information
 	Bucket string
 	Path   string
@@ -56,28 +83,61 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 		return nil
 	}
 
+	accountName, accountKey, endpoint, sasToken := c.AccountName, c.AccountKey, c.Endpoint, c.SASToken
+	forcePathStyle := c.ForcePathStyle
+
+	// Fill in settings that are not set explicitly from the connection string.
+	if c.ConnectionString != "" {
+		cs, err := ParseConnectionString(c.ConnectionString)
+		if err != nil {
+			return err
+		}
+
+		if accountName == "" {
+			accountName = cs.AccountName
+		}
+		if accountKey == "" {
+			accountKey = cs.AccountKey
+		}
+		if endpoint == "" && cs.Endpoint != "" {
+			endpoint, forcePathStyle = cs.Endpoint, false
+		}
+		if sasToken == "" {
+			sasToken = cs.SASToken
+		}
+	}
+
 	// Read account key from environment, if available.
-	accountKey := c.AccountKey
 	if accountKey == "" {
 		accountKey = os.Getenv("LITESTREAM_AZURE_ACCOUNT_KEY")
 	}
 
 	// Authenticate to ACS.
-	credential, err := azblob.NewSharedKeyCredential(c.AccountName, accountKey)
+	credential, err := c.credential(ctx, accountName, accountKey, sasToken)
 	if err != nil {
 		return err
 	}
 
 	// Construct & parse endpoint unless already set.
-	endpoint := c.Endpoint
 	if endpoint == "" {
-		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", c.AccountName)
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", accountName)
 	}
 	endpointURL, err := url.Parse(endpoint)
 	if err != nil {
 		return fmt.Errorf("cannot parse azure endpoint: %w", err)
 	}
 
+	// Path-style endpoints include the account name as the first path
+	// segment (e.g. "http://127.0.0.1:10000/devstoreaccount1").
+	if forcePathStyle && strings.Trim(endpointURL.Path, "/") == "" {
+		endpointURL.Path = "/" + accountName
+	}
+
+	// SAS tokens are passed as query parameters on every request.
+	if sasToken != "" {
+		endpointURL.RawQuery = strings.TrimPrefix(sasToken, "?")
+	}
+
 	// Build pipeline and reference to container.
 	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{
 		Retry: azblob.RetryOptions{
@@ -90,6 +150,129 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 	return nil
 }
 
+// credential returns the credential used to authenticate requests.
+func (c *ReplicaClient) credential(ctx context.Context, accountName, accountKey, sasToken string) (azblob.Credential, error) {
+	switch {
+	case sasToken != "":
+		return azblob.NewAnonymousCredential(), nil
+
+	case c.ClientSecret != "":
+		if c.TenantID == "" || c.ClientID == "" {
+			return nil, fmt.Errorf("azure tenant id & client id required with client secret")
+		}
+		cred, err := azidentity.NewClientSecretCredential(c.TenantID, c.ClientID, c.ClientSecret, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create azure client secret credential: %w", err)
+		}
+		return newTokenCredential(ctx, cred)
+
+	case c.UseManagedIdentity:
+		var opts azidentity.ManagedIdentityCredentialOptions
+		if c.ClientID != "" {
+			opts.ID = azidentity.ClientID(c.ClientID)
+		}
+		cred, err := azidentity.NewManagedIdentityCredential(&opts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create azure managed identity credential: %w", err)
+		}
+		return newTokenCredential(ctx, cred)
+
+	default:
+		return azblob.NewSharedKeyCredential(accountName, accountKey)
+	}
+}
+
+// newTokenCredential fetches an initial token & returns a credential that
+// refreshes the token before it expires.
+func newTokenCredential(ctx context.Context, cred azcore.TokenCredential) (azblob.Credential, error) {
+	opts := policy.TokenRequestOptions{Scopes: []string{azureStorageScope}}
+
+	token, err := cred.GetToken(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch azure token: %w", err)
+	}
+
+	return azblob.NewTokenCredential(token.Token, func(credential azblob.TokenCredential) time.Duration {
+		token, err := cred.GetToken(context.Background(), opts)
+		if err != nil {
+			slog.Error("cannot refresh azure token", "error", err)
+			return tokenRetryInterval
+		}
+
+		credential.SetToken(token.Token)
+
+		if d := time.Until(token.ExpiresOn) - tokenRefreshMargin; d > tokenRetryInterval {
+			return d
+		}
+		return tokenRetryInterval
+	}), nil
+}
+
+// Azure AD settings used for token-based authentication.
+const (
+	azureStorageScope = "https://storage.azure.com/.default"
+
+	tokenRefreshMargin = 5 * time.Minute
+	tokenRetryInterval = 30 * time.Second
+)
+
+// Settings for the local Azurite emulator when "UseDevelopmentStorage=true".
+const (
+	DevelopmentAccountName = "devstoreaccount1"
+	DevelopmentAccountKey  = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	DevelopmentEndpoint    = "http://127.0.0.1:10000/devstoreaccount1"
+)
+
+// ConnectionString represents the parsed settings from an Azure Storage
+// connection string.
+type ConnectionString struct {
+	AccountName string
+	AccountKey  string
+	Endpoint    string
+	SASToken    string
+}
+
+// ParseConnectionString parses an Azure Storage connection string such as
+// "DefaultEndpointsProtocol=https;AccountName=NAME;AccountKey=KEY".
+func ParseConnectionString(s string) (*ConnectionString, error) {
+	var cs ConnectionString
+	protocol, suffix := "https", "core.windows.net"
+	for _, part := range strings.Split(s, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid azure connection string: missing value for %q", key)
+		}
+
+		switch strings.ToLower(key) {
+		case "accountname":
+			cs.AccountName = value
+		case "accountkey":
+			cs.AccountKey = value
+		case "blobendpoint":
+			cs.Endpoint = value
+		case "sharedaccesssignature":
+			cs.SASToken = value
+		case "defaultendpointsprotocol":
+			protocol = value
+		case "endpointsuffix":
+			suffix = value
+		case "usedevelopmentstorage":
+			if strings.EqualFold(value, "true") {
+				cs.AccountName, cs.AccountKey, cs.Endpoint = DevelopmentAccountName, DevelopmentAccountKey, DevelopmentEndpoint
+			}
+		}
+	}
+
+	if cs.Endpoint == "" && cs.AccountName != "" {
+		cs.Endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, cs.AccountName, suffix)
+	}
+	return &cs, nil
+}
+
 // Generations returns a list of available generation names.
 func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
 	if err := c.Init(ctx); err != nil {
@@ -227,6 +410,32 @@ func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, i
 	return resp.Body(azblob.RetryReaderOptions{}), nil
 }
 
+// SnapshotRangeReader returns a reader for size bytes of snapshot data
+// starting at offset.
+func (c *ReplicaClient) SnapshotRangeReader(ctx context.Context, generation string, index int, offset, size int64) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	blobURL := c.containerURL.NewBlobURL(key)
+	resp, err := blobURL.Download(ctx, offset, size, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot start new range reader for %q: %w", key, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(resp.ContentLength()))
+
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
 // DeleteSnapshot deletes a snapshot with the given generation & index.
 func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
 	if err := c.Init(ctx); err != nil {
@@ -342,6 +551,117 @@ func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Po
 	return nil
 }
 
+// GenerationMetaReader returns a reader for the metadata of a generation.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	blobURL := c.containerURL.NewBlobURL(key)
+	resp, err := blobURL.Download(ctx, 0, 0, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot start new reader for %q: %w", key, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(resp.ContentLength()))
+
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+// WriteGenerationMeta writes the metadata of a generation.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	key, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	rc := internal.NewReadCounter(rd)
+
+	blobURL := c.containerURL.NewBlockBlobURL(key)
+	if _, err := azblob.UploadStreamToBlockBlob(ctx, rc, blobURL, azblob.UploadStreamToBlockBlobOptions{
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: "application/json"},
+		BlobAccessTier:  azblob.DefaultAccessTier,
+	}); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(rc.N()))
+	return nil
+}
+
+// LeaseReader returns a reader for the replica lease.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	key := litestream.LeasePath(c.Path)
+	blobURL := c.containerURL.NewBlobURL(key)
+	resp, err := blobURL.Download(ctx, 0, 0, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot start new reader for %q: %w", key, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(resp.ContentLength()))
+
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+// WriteLease writes the replica lease, replacing any existing lease.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	rc := internal.NewReadCounter(rd)
+
+	blobURL := c.containerURL.NewBlockBlobURL(litestream.LeasePath(c.Path))
+	if _, err := azblob.UploadStreamToBlockBlob(ctx, rc, blobURL, azblob.UploadStreamToBlockBlobOptions{
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: "application/json"},
+		BlobAccessTier:  azblob.DefaultAccessTier,
+	}); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(rc.N()))
+	return nil
+}
+
+// DeleteLease deletes the replica lease, if it exists.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+
+	key := litestream.LeasePath(c.Path)
+	blobURL := c.containerURL.NewBlobURL(key)
+	if _, err := blobURL.Delete(ctx, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{}); isNotExists(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot delete lease %q: %w", key, err)
+	}
+	return nil
+}
+
 type snapshotIterator struct {
 	client     *ReplicaClient
 	generation string
@@ -0,0 +1,101 @@
+package abs_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream/abs"
+)
+
+func TestReplicaClient_Init(t *testing.T) {
+	t.Run("ErrClientSecretWithoutTenant", func(t *testing.T) {
+		c := abs.NewReplicaClient()
+		c.AccountName, c.Bucket, c.ClientID, c.ClientSecret = "foo", "bkt", "CLIENT", "SECRET"
+		if err := c.Init(context.Background()); err == nil || err.Error() != `azure tenant id & client id required with client secret` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure a token for the storage scope is fetched from the managed
+	// identity endpoint for the user-assigned identity.
+	t.Run("ManagedIdentity", func(t *testing.T) {
+		var mu sync.Mutex
+		var query url.Values
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			query = r.URL.Query()
+			mu.Unlock()
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"TOKEN","expires_on":"%d","resource":"https://storage.azure.com","token_type":"Bearer"}`, time.Now().Add(time.Hour).Unix())
+		}))
+		defer s.Close()
+
+		// Use the App Service managed identity endpoint.
+		t.Setenv("IDENTITY_ENDPOINT", s.URL)
+		t.Setenv("IDENTITY_HEADER", "HEADER")
+
+		c := abs.NewReplicaClient()
+		c.AccountName, c.Bucket, c.ClientID, c.UseManagedIdentity = "foo", "bkt", "CLIENT", true
+		if err := c.Init(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if got, want := query.Get("resource"), "https://storage.azure.com"; got != want {
+			t.Fatalf("resource=%q, want %q", got, want)
+		} else if got, want := query.Get("client_id"), "CLIENT"; got != want {
+			t.Fatalf("client_id=%q, want %q", got, want)
+		}
+	})
+}
+
+func TestParseConnectionString(t *testing.T) {
+	t.Run("AccountKey", func(t *testing.T) {
+		cs, err := abs.ParseConnectionString("DefaultEndpointsProtocol=https;AccountName=foo;AccountKey=Zm9v==;EndpointSuffix=core.chinacloudapi.cn")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := cs.AccountName, "foo"; got != want {
+			t.Fatalf("AccountName=%s, want %s", got, want)
+		} else if got, want := cs.AccountKey, "Zm9v=="; got != want {
+			t.Fatalf("AccountKey=%s, want %s", got, want)
+		} else if got, want := cs.Endpoint, "https://foo.blob.core.chinacloudapi.cn"; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("SAS", func(t *testing.T) {
+		cs, err := abs.ParseConnectionString("BlobEndpoint=https://foo.blob.core.windows.net/;SharedAccessSignature=sv=2022-11-02&sig=abc%3D")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := cs.Endpoint, "https://foo.blob.core.windows.net/"; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		} else if got, want := cs.SASToken, "sv=2022-11-02&sig=abc%3D"; got != want {
+			t.Fatalf("SASToken=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("UseDevelopmentStorage", func(t *testing.T) {
+		cs, err := abs.ParseConnectionString("UseDevelopmentStorage=true")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := cs.AccountName, abs.DevelopmentAccountName; got != want {
+			t.Fatalf("AccountName=%s, want %s", got, want)
+		} else if got, want := cs.Endpoint, abs.DevelopmentEndpoint; got != want {
+			t.Fatalf("Endpoint=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		if _, err := abs.ParseConnectionString("AccountName"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,360 @@
+package litestream
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"time"
+)
+
+// BundleVersion is the current version of the bundle format.
+const BundleVersion = 1
+
+// BundleManifestPath is the path of the manifest within a bundle. It is
+// always the first entry so a bundle can be read in a single pass.
+const BundleManifestPath = "manifest.json"
+
+// BundleManifest describes the contents of a bundle. A bundle is a tar
+// archive containing the manifest followed by one snapshot, preceded by its
+// base snapshots if it is a delta snapshot, and the WAL segments that follow
+// it within a single generation. Files are stored under the same paths used
+// by replicas (e.g. "generations/GEN/wal/...") and contain the data exactly
+// as stored on the replica, so they remain compressed and, if the replica
+// uses age, encrypted.
+type BundleManifest struct {
+	Version     int                `json:"version"`
+	Generation  string             `json:"generation"`
+	CreatedAt   time.Time          `json:"created-at"`
+	Encrypted   bool               `json:"encrypted"`
+	Snapshot    BundleSnapshot     `json:"snapshot"`
+	WALSegments []BundleWALSegment `json:"wal-segments"`
+
+	// Snapshots that a delta snapshot is built upon, starting with the full
+	// snapshot. These precede the snapshot in the bundle.
+	BaseSnapshots []BundleSnapshot `json:"base-snapshots,omitempty"`
+}
+
+// BundleSnapshot describes the snapshot within a bundle.
+type BundleSnapshot struct {
+	Index     int       `json:"index"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+// BundleWALSegment describes a WAL segment within a bundle.
+type BundleWALSegment struct {
+	Index     int       `json:"index"`
+	Offset    int64     `json:"offset"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+// Pos returns the position of the WAL segment.
+func (s *BundleWALSegment) Pos(generation string) Pos {
+	return Pos{Generation: generation, Index: s.Index, Offset: s.Offset}
+}
+
+// Export writes a bundle to w containing a snapshot & subsequent WAL segments
+// from the replica. The generation is required. The snapshot & WAL segments
+// are selected by index or timestamp in the same way as Restore().
+func (r *Replica) Export(ctx context.Context, w io.Writer, opt RestoreOptions) (*BundleManifest, error) {
+	if opt.Generation == "" {
+		return nil, fmt.Errorf("generation required")
+	} else if opt.Index != math.MaxInt32 && !opt.Timestamp.IsZero() {
+		return nil, fmt.Errorf("cannot specify index & timestamp to export")
+	}
+
+	// Find lastest snapshot that occurs before timestamp or index.
+	var snapshotIndex int
+	var err error
+	if opt.Index < math.MaxInt32 {
+		if snapshotIndex, err = r.SnapshotIndexByIndex(ctx, opt.Generation, opt.Index); err != nil {
+			return nil, fmt.Errorf("cannot find snapshot index: %w", err)
+		}
+	} else {
+		if snapshotIndex, err = r.SnapshotIndexAt(ctx, opt.Generation, opt.Timestamp); err != nil {
+			return nil, fmt.Errorf("cannot find snapshot index by timestamp: %w", err)
+		}
+	}
+
+	manifest := &BundleManifest{
+		Version:    BundleVersion,
+		Generation: opt.Generation,
+		CreatedAt:  time.Now().UTC(),
+		Encrypted:  len(r.AgeRecipients) > 0 || len(r.AgeIdentities) > 0,
+	}
+
+	// Look up snapshot metadata.
+	snapshots, err := r.Client.Snapshots(ctx, opt.Generation)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshots.Close()
+
+	infos := make(map[int]BundleSnapshot)
+	for snapshots.Next() {
+		info := snapshots.Snapshot()
+		infos[info.Index] = BundleSnapshot{Index: info.Index, Size: info.Size, CreatedAt: info.CreatedAt}
+	}
+	if err := snapshots.Close(); err != nil {
+		return nil, err
+	}
+
+	var found bool
+	if manifest.Snapshot, found = infos[snapshotIndex]; !found {
+		return nil, ErrNoSnapshots
+	}
+
+	// Include the base snapshots if this is a delta snapshot.
+	chain, err := r.SnapshotChain(ctx, opt.Generation, snapshotIndex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot chain: %w", err)
+	}
+	for _, index := range chain[:len(chain)-1] {
+		info, ok := infos[index]
+		if !ok {
+			return nil, fmt.Errorf("base snapshot not found: %s/%08x", opt.Generation, index)
+		}
+		manifest.BaseSnapshots = append(manifest.BaseSnapshots, info)
+	}
+
+	// Determine the WAL segments to include & look up their metadata.
+	walSegmentMap, err := r.walSegmentMap(ctx, opt.Generation, snapshotIndex, opt.Index, opt.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine wal segments: %w", err)
+	}
+	included := make(map[Pos]struct{})
+	for index, offsets := range walSegmentMap {
+		for _, offset := range offsets {
+			included[Pos{Generation: opt.Generation, Index: index, Offset: offset}] = struct{}{}
+		}
+	}
+
+	walSegments, err := r.Client.WALSegments(ctx, opt.Generation)
+	if err != nil {
+		return nil, err
+	}
+	defer walSegments.Close()
+
+	var segInfos []WALSegmentInfo
+	for walSegments.Next() {
+		info := walSegments.WALSegment()
+		if _, ok := included[info.Pos()]; ok {
+			segInfos = append(segInfos, info)
+		}
+	}
+	if err := walSegments.Close(); err != nil {
+		return nil, err
+	}
+	sort.Sort(WALSegmentInfoSlice(segInfos))
+
+	for _, info := range segInfos {
+		manifest.WALSegments = append(manifest.WALSegments, BundleWALSegment{
+			Index:     info.Index,
+			Offset:    info.Offset,
+			Size:      info.Size,
+			CreatedAt: info.CreatedAt,
+		})
+	}
+
+	// Write manifest followed by the snapshot & WAL segments.
+	tw := tar.NewWriter(w)
+
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	} else if err := writeBundleFile(tw, BundleManifestPath, int64(len(buf)), manifest.CreatedAt, io.NopCloser(bytes.NewReader(buf))); err != nil {
+		return nil, fmt.Errorf("cannot write manifest: %w", err)
+	}
+
+	for _, snapshot := range append(manifest.BaseSnapshots, manifest.Snapshot) {
+		filename, err := SnapshotPath("", manifest.Generation, snapshot.Index)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+		}
+		rd, err := r.Client.SnapshotReader(ctx, manifest.Generation, snapshot.Index)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read snapshot: %w", err)
+		} else if err := writeBundleFile(tw, filename, snapshot.Size, snapshot.CreatedAt, rd); err != nil {
+			return nil, fmt.Errorf("cannot write snapshot: %w", err)
+		}
+	}
+
+	for _, seg := range manifest.WALSegments {
+		pos := seg.Pos(manifest.Generation)
+		filename, err := WALSegmentPath("", pos.Generation, pos.Index, pos.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine wal segment path: %w", err)
+		}
+
+		rd, err := r.Client.WALSegmentReader(ctx, pos)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read wal segment %s: %w", pos, err)
+		} else if err := writeBundleFile(tw, filename, seg.Size, seg.CreatedAt, rd); err != nil {
+			return nil, fmt.Errorf("cannot write wal segment %s: %w", pos, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Import reads a bundle from rd & writes its snapshot & WAL segments to the
+// replica. Returns an error if the generation already exists on the replica.
+func (r *Replica) Import(ctx context.Context, rd io.Reader) (*BundleManifest, error) {
+	tr := tar.NewReader(rd)
+
+	manifest, err := readBundleManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse to merge into an existing generation.
+	generations, err := r.Client.Generations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch generations: %w", err)
+	}
+	for _, generation := range generations {
+		if generation == manifest.Generation {
+			return nil, fmt.Errorf("generation already exists on replica: %s", generation)
+		}
+	}
+
+	// Track which files in the manifest have been imported.
+	snapshotPath, err := SnapshotPath("", manifest.Generation, manifest.Snapshot.Index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+	baseSnapshots := make(map[string]BundleSnapshot)
+	for _, snapshot := range manifest.BaseSnapshots {
+		filename, err := SnapshotPath("", manifest.Generation, snapshot.Index)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+		}
+		baseSnapshots[filename] = snapshot
+	}
+	walSegments := make(map[string]BundleWALSegment)
+	for _, seg := range manifest.WALSegments {
+		filename, err := WALSegmentPath("", manifest.Generation, seg.Index, seg.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine wal segment path: %w", err)
+		}
+		walSegments[filename] = seg
+	}
+
+	// Export always writes the snapshot before its WAL segments so a
+	// partially imported generation still begins with a snapshot.
+	var snapshotImported bool
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read bundle: %w", err)
+		}
+
+		name := path.Clean(hdr.Name)
+		base, isBaseSnapshot := baseSnapshots[name]
+		seg, isWALSegment := walSegments[name]
+
+		switch {
+		case isBaseSnapshot:
+			if snapshotImported {
+				return nil, fmt.Errorf("base snapshot found after snapshot in bundle: %s", name)
+			} else if hdr.Size != base.Size {
+				return nil, fmt.Errorf("base snapshot size mismatch: %s: %d, expected %d", name, hdr.Size, base.Size)
+			} else if _, err := r.Client.WriteSnapshot(ctx, manifest.Generation, base.Index, tr); err != nil {
+				return nil, fmt.Errorf("cannot write base snapshot: %w", err)
+			}
+			delete(baseSnapshots, name)
+
+		case name == snapshotPath && !snapshotImported:
+			if len(baseSnapshots) > 0 {
+				return nil, fmt.Errorf("%d base snapshots missing from bundle", len(baseSnapshots))
+			}
+			if hdr.Size != manifest.Snapshot.Size {
+				return nil, fmt.Errorf("snapshot size mismatch: %d, expected %d", hdr.Size, manifest.Snapshot.Size)
+			} else if _, err := r.Client.WriteSnapshot(ctx, manifest.Generation, manifest.Snapshot.Index, tr); err != nil {
+				return nil, fmt.Errorf("cannot write snapshot: %w", err)
+			}
+			snapshotImported = true
+
+		case isWALSegment:
+			if !snapshotImported {
+				return nil, fmt.Errorf("wal segment found before snapshot in bundle: %s", name)
+			} else if hdr.Size != seg.Size {
+				return nil, fmt.Errorf("wal segment size mismatch: %s: %d, expected %d", name, hdr.Size, seg.Size)
+			} else if _, err := r.Client.WriteWALSegment(ctx, seg.Pos(manifest.Generation), tr); err != nil {
+				return nil, fmt.Errorf("cannot write wal segment %s: %w", seg.Pos(manifest.Generation), err)
+			}
+			delete(walSegments, name)
+
+		default:
+			return nil, fmt.Errorf("unexpected file in bundle: %s", hdr.Name)
+		}
+	}
+
+	if !snapshotImported {
+		return nil, fmt.Errorf("snapshot missing from bundle")
+	} else if len(walSegments) > 0 {
+		return nil, fmt.Errorf("%d wal segments missing from bundle", len(walSegments))
+	}
+	return manifest, nil
+}
+
+// ReadBundleManifest returns the manifest from the bundle in rd.
+func ReadBundleManifest(rd io.Reader) (*BundleManifest, error) {
+	return readBundleManifest(tar.NewReader(rd))
+}
+
+func readBundleManifest(tr *tar.Reader) (*BundleManifest, error) {
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("bundle is empty")
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read bundle: %w", err)
+	} else if hdr.Name != BundleManifestPath {
+		return nil, fmt.Errorf("bundle manifest not found")
+	}
+
+	var manifest BundleManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("cannot decode bundle manifest: %w", err)
+	} else if manifest.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version: %d", manifest.Version)
+	} else if !IsGenerationName(manifest.Generation) {
+		return nil, fmt.Errorf("invalid generation name in bundle manifest: %q", manifest.Generation)
+	}
+	return &manifest, nil
+}
+
+// writeBundleFile writes a single file to the bundle & closes rd.
+func writeBundleFile(tw *tar.Writer, name string, size int64, modTime time.Time, rd io.ReadCloser) error {
+	defer rd.Close()
+
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  modTime,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(tw, rd, size); errors.Is(err, io.EOF) {
+		return fmt.Errorf("file shorter than expected size: %d bytes", size)
+	} else if err != nil {
+		return err
+	}
+	return rd.Close()
+}
@@ -0,0 +1,106 @@
+package litestream_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestReplica_Export(t *testing.T) {
+	// Ensure a bundle can be imported into an empty replica & restored.
+	t.Run("RoundTrip", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		r := litestream.NewReplica(db, "")
+		r.Client = memory.NewReplicaClient()
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := r.Snapshot(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		opt := litestream.NewRestoreOptions()
+		opt.Generation = r.Pos().Generation
+
+		var buf bytes.Buffer
+		manifest, err := r.Export(context.Background(), &buf, opt)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := manifest.Generation, opt.Generation; got != want {
+			t.Fatalf("Generation=%s, want %s", got, want)
+		} else if len(manifest.WALSegments) == 0 {
+			t.Fatal("expected wal segments")
+		}
+
+		// Verify manifest can be read independently.
+		if other, err := litestream.ReadBundleManifest(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(other.WALSegments), len(manifest.WALSegments); got != want {
+			t.Fatalf("len(WALSegments)=%d, want %d", got, want)
+		}
+
+		// Import into a new replica & restore from it.
+		rr := litestream.NewReplica(nil, "")
+		rr.Client = memory.NewReplicaClient()
+		if _, err := rr.Import(context.Background(), bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+
+		ropt := litestream.NewRestoreOptions()
+		ropt.OutputPath = filepath.Join(t.TempDir(), "db")
+		ropt.Generation = manifest.Generation
+		if err := rr.Restore(context.Background(), ropt); err != nil {
+			t.Fatal(err)
+		}
+
+		restored := MustOpenSQLDB(t, ropt.OutputPath)
+		defer MustCloseSQLDB(t, restored)
+
+		var bar string
+		if err := restored.QueryRow(`SELECT bar FROM foo`).Scan(&bar); err != nil {
+			t.Fatal(err)
+		} else if got, want := bar, "baz"; got != want {
+			t.Fatalf("bar=%q, want %q", got, want)
+		}
+
+		// Importing the same bundle again should fail.
+		if _, err := rr.Import(context.Background(), bytes.NewReader(buf.Bytes())); err == nil || !strings.Contains(err.Error(), "generation already exists") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrGenerationRequired", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "")
+		r.Client = memory.NewReplicaClient()
+		if _, err := r.Export(context.Background(), &bytes.Buffer{}, litestream.NewRestoreOptions()); err == nil || err.Error() != `generation required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplica_Import(t *testing.T) {
+	t.Run("ErrEmpty", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "")
+		r.Client = memory.NewReplicaClient()
+		if _, err := r.Import(context.Background(), &bytes.Buffer{}); err == nil || err.Error() != `bundle is empty` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,603 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultMaxSize is the default maximum size of the cache, in bytes.
+const DefaultMaxSize = 1 << 30 // 1GB
+
+var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
+
+// ReplicaClient wraps another client and caches snapshots & WAL segments on
+// local disk as they are read. Subsequent reads for the same generation,
+// index & offset are served from disk. When the cache exceeds MaxSize, the
+// least recently used entries are evicted.
+//
+// Cached entries are removed when they are written or deleted through this
+// client, or when listing reports a different size for the object, such as a
+// WAL segment replaced by compaction in another process. Objects that are
+// larger than MaxSize are not cached.
+type ReplicaClient struct {
+	mu      sync.Mutex
+	lru     *list.List               // front is most recently used
+	entries map[string]*list.Element // key to *entry
+	size    int64                    // total size of cached entries
+
+	// Underlying client that calls are delegated to.
+	Client litestream.ReplicaClient
+
+	// Directory where cached objects are stored.
+	Path string
+
+	// Maximum total size of cached objects, in bytes.
+	MaxSize int64
+}
+
+// entry represents a single cached object.
+type entry struct {
+	key  string // path relative to the cache directory
+	size int64
+}
+
+// NewReplicaClient returns a new instance of ReplicaClient wrapping client.
+func NewReplicaClient(client litestream.ReplicaClient, path string) *ReplicaClient {
+	return &ReplicaClient{
+		Client:  client,
+		Path:    path,
+		MaxSize: DefaultMaxSize,
+	}
+}
+
+// Unwrap returns the underlying client.
+func (c *ReplicaClient) Unwrap() litestream.ReplicaClient {
+	return c.Client
+}
+
+// Type returns the type of the underlying client.
+func (c *ReplicaClient) Type() string {
+	return c.Client.Type()
+}
+
+// Init loads the index of existing cached objects from disk. No-op if
+// already initialized.
+func (c *ReplicaClient) Init(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.init()
+}
+
+func (c *ReplicaClient) init() error {
+	if c.entries != nil {
+		return nil
+	} else if c.Path == "" {
+		return fmt.Errorf("cache path required")
+	}
+
+	if err := os.MkdirAll(c.Path, 0o700); err != nil {
+		return err
+	}
+
+	// Collect existing objects so they can be ordered by last access time.
+	type file struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	if err := filepath.WalkDir(c.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if d.IsDir() {
+			return nil
+		}
+
+		// Remove partially downloaded objects from a previous process.
+		if strings.HasSuffix(path, ".tmp") {
+			return os.Remove(path)
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		key, err := filepath.Rel(c.Path, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, file{key: filepath.ToSlash(key), size: fi.Size(), modTime: fi.ModTime()})
+		return nil
+	}); err != nil {
+		return fmt.Errorf("cannot load cache: %w", err)
+	}
+
+	// Files are touched on each cache hit so the modification time is used
+	// as the last access time. Push oldest first so the most recent is in front.
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	c.lru = list.New()
+	c.entries = make(map[string]*list.Element)
+	c.size = 0
+	for _, f := range files {
+		c.entries[f.key] = c.lru.PushFront(&entry{key: f.key, size: f.size})
+		c.size += f.size
+	}
+
+	return c.evict()
+}
+
+// Generations returns a list of available generation names.
+func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
+	return c.Client.Generations(ctx)
+}
+
+// DeleteGeneration deletes all snapshots & WAL segments within a generation
+// and removes them from the cache.
+func (c *ReplicaClient) DeleteGeneration(ctx context.Context, generation string) error {
+	if err := c.Client.DeleteGeneration(ctx, generation); err != nil {
+		return err
+	}
+
+	dir, err := litestream.GenerationPath("", generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation path: %w", err)
+	}
+	return c.removePrefix(dir + "/")
+}
+
+// Snapshots returns an iterator over all available snapshots for a generation.
+// Cached snapshots are invalidated if their listed size has changed.
+func (c *ReplicaClient) Snapshots(ctx context.Context, generation string) (litestream.SnapshotIterator, error) {
+	itr, err := c.Client.Snapshots(ctx, generation)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotIterator{SnapshotIterator: itr, c: c}, nil
+}
+
+// WriteSnapshot writes LZ4 compressed data from rd to the underlying client
+// and invalidates any cached copy.
+func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (litestream.SnapshotInfo, error) {
+	info, err := c.Client.WriteSnapshot(ctx, generation, index, rd)
+	if err != nil {
+		return info, err
+	}
+
+	key, err := litestream.SnapshotPath("", generation, index)
+	if err != nil {
+		return info, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+	return info, c.remove(key)
+}
+
+// DeleteSnapshot deletes a snapshot with the given generation & index and
+// removes it from the cache.
+func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
+	if err := c.Client.DeleteSnapshot(ctx, generation, index); err != nil {
+		return err
+	}
+
+	key, err := litestream.SnapshotPath("", generation, index)
+	if err != nil {
+		return fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+	return c.remove(key)
+}
+
+// SnapshotReader returns a reader for snapshot data at the given generation/index.
+// Data is read from the cache if available. Otherwise it is downloaded into
+// the cache from the underlying client.
+func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+	key, err := litestream.SnapshotPath("", generation, index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	return c.open(key, func() (io.ReadCloser, error) {
+		return c.Client.SnapshotReader(ctx, generation, index)
+	})
+}
+
+// WALSegments returns an iterator over all available WAL files for a generation.
+// Cached segments are invalidated if their listed size has changed.
+func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+	itr, err := c.Client.WALSegments(ctx, generation)
+	if err != nil {
+		return nil, err
+	}
+	return &walSegmentIterator{WALSegmentIterator: itr, c: c}, nil
+}
+
+// WriteWALSegment writes LZ4 compressed data from rd to the underlying client
+// and invalidates any cached copy.
+func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (litestream.WALSegmentInfo, error) {
+	info, err := c.Client.WriteWALSegment(ctx, pos, rd)
+	if err != nil {
+		return info, err
+	}
+
+	key, err := litestream.WALSegmentPath("", pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return info, fmt.Errorf("cannot determine wal segment path: %w", err)
+	}
+	return info, c.remove(key)
+}
+
+// DeleteWALSegments deletes WAL segments at the given positions and removes
+// them from the cache.
+func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Pos) error {
+	if err := c.Client.DeleteWALSegments(ctx, a); err != nil {
+		return err
+	}
+
+	for _, pos := range a {
+		key, err := litestream.WALSegmentPath("", pos.Generation, pos.Index, pos.Offset)
+		if err != nil {
+			return fmt.Errorf("cannot determine wal segment path: %w", err)
+		} else if err := c.remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WALSegmentReader returns a reader for a section of WAL data at the given position.
+// Data is read from the cache if available. Otherwise it is downloaded into
+// the cache from the underlying client.
+func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+	key, err := litestream.WALSegmentPath("", pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine wal segment path: %w", err)
+	}
+
+	return c.open(key, func() (io.ReadCloser, error) {
+		return c.Client.WALSegmentReader(ctx, pos)
+	})
+}
+
+// GenerationMetaReader returns a reader for the metadata of a generation if
+// the underlying client supports generation metadata.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	mc, ok := c.Client.(litestream.GenerationMetaClient)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support generation metadata", c.Client.Type())
+	}
+	return mc.GenerationMetaReader(ctx, generation)
+}
+
+// WriteGenerationMeta writes the metadata of a generation to the underlying client.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	mc, ok := c.Client.(litestream.GenerationMetaClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support generation metadata", c.Client.Type())
+	}
+	return mc.WriteGenerationMeta(ctx, generation, rd)
+}
+
+// LeaseReader returns a reader for the replica lease from the underlying
+// client. Leases are never cached.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+	return lc.LeaseReader(ctx)
+}
+
+// WriteLease writes the replica lease to the underlying client.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+	return lc.WriteLease(ctx, rd)
+}
+
+// DeleteLease deletes the replica lease from the underlying client.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+	return lc.DeleteLease(ctx)
+}
+
+// open returns a reader for the cached object at key. On a cache miss, the
+// object is downloaded using fetch and added to the cache.
+func (c *ReplicaClient) open(key string, fetch func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	filename := filepath.Join(c.Path, filepath.FromSlash(key))
+
+	c.mu.Lock()
+	if err := c.init(); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	// Serve from the cache & mark as recently used, if available.
+	if elem := c.entries[key]; elem != nil {
+		f, err := os.Open(filename)
+		if err == nil {
+			c.lru.MoveToFront(elem)
+			now := time.Now()
+			_ = os.Chtimes(filename, now, now)
+			c.mu.Unlock()
+
+			cacheHitCounterVec.WithLabelValues(c.Client.Type()).Inc()
+			return f, nil
+		}
+
+		// Drop entry if the file was removed out from under us.
+		c.removeElement(elem)
+	}
+	c.mu.Unlock()
+
+	cacheMissCounterVec.WithLabelValues(c.Client.Type()).Inc()
+
+	// Download to a temporary file next to the final path.
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := download(f, fetch)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+
+	// Objects too large to be cached are removed once they are read.
+	if size > c.MaxSize {
+		return &tempFile{File: f}, nil
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	} else if err := os.Rename(f.Name(), filename); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem := c.entries[key]; elem != nil {
+		c.size -= elem.Value.(*entry).size
+		elem.Value.(*entry).size = size
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[key] = c.lru.PushFront(&entry{key: key, size: size})
+	}
+	c.size += size
+
+	if err := c.evict(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// download copies the object returned by fetch into f and rewinds f.
+func download(f *os.File, fetch func() (io.ReadCloser, error)) (int64, error) {
+	rc, err := fetch()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	n, err := io.Copy(f, rc)
+	if err != nil {
+		return 0, err
+	} else if err := rc.Close(); err != nil {
+		return 0, err
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// evict removes least recently used entries until the cache is within its
+// maximum size. Must hold mu.
+func (c *ReplicaClient) evict() error {
+	for c.size > c.MaxSize {
+		elem := c.lru.Back()
+		if elem == nil {
+			return nil
+		}
+
+		key := elem.Value.(*entry).key
+		if err := os.Remove(filepath.Join(c.Path, filepath.FromSlash(key))); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot evict cached object: %w", err)
+		}
+		c.removeElement(elem)
+
+		cacheEvictionCounterVec.WithLabelValues(c.Client.Type()).Inc()
+	}
+	return nil
+}
+
+// remove deletes the cached object at key, if it exists.
+func (c *ReplicaClient) remove(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.init(); err != nil {
+		return err
+	}
+
+	elem := c.entries[key]
+	if elem == nil {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(c.Path, filepath.FromSlash(key))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.removeElement(elem)
+	return nil
+}
+
+// invalidate deletes the cached object at key if its size differs from size.
+func (c *ReplicaClient) invalidate(key string, size int64) error {
+	c.mu.Lock()
+	elem := c.entries[key]
+	stale := elem != nil && elem.Value.(*entry).size != size
+	c.mu.Unlock()
+
+	if !stale {
+		return nil
+	}
+	return c.remove(key)
+}
+
+// removePrefix deletes all cached objects with keys starting with prefix.
+func (c *ReplicaClient) removePrefix(prefix string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.init(); err != nil {
+		return err
+	}
+
+	for key, elem := range c.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(c.Path, filepath.FromSlash(key))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.removeElement(elem)
+	}
+	return nil
+}
+
+// removeElement removes elem from the index. Must hold mu.
+func (c *ReplicaClient) removeElement(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.lru.Remove(elem)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+// snapshotIterator invalidates cached snapshots as they are listed.
+type snapshotIterator struct {
+	litestream.SnapshotIterator
+	c   *ReplicaClient
+	err error
+}
+
+func (itr *snapshotIterator) Next() bool {
+	if itr.err != nil || !itr.SnapshotIterator.Next() {
+		return false
+	}
+
+	info := itr.Snapshot()
+	key, err := litestream.SnapshotPath("", info.Generation, info.Index)
+	if err != nil {
+		itr.err = fmt.Errorf("cannot determine snapshot path: %w", err)
+		return false
+	} else if err := itr.c.invalidate(key, info.Size); err != nil {
+		itr.err = err
+		return false
+	}
+	return true
+}
+
+func (itr *snapshotIterator) Err() error {
+	if itr.err != nil {
+		return itr.err
+	}
+	return itr.SnapshotIterator.Err()
+}
+
+// walSegmentIterator invalidates cached WAL segments as they are listed.
+type walSegmentIterator struct {
+	litestream.WALSegmentIterator
+	c   *ReplicaClient
+	err error
+}
+
+func (itr *walSegmentIterator) Next() bool {
+	if itr.err != nil || !itr.WALSegmentIterator.Next() {
+		return false
+	}
+
+	info := itr.WALSegment()
+	key, err := litestream.WALSegmentPath("", info.Generation, info.Index, info.Offset)
+	if err != nil {
+		itr.err = fmt.Errorf("cannot determine wal segment path: %w", err)
+		return false
+	} else if err := itr.c.invalidate(key, info.Size); err != nil {
+		itr.err = err
+		return false
+	}
+	return true
+}
+
+func (itr *walSegmentIterator) Err() error {
+	if itr.err != nil {
+		return itr.err
+	}
+	return itr.WALSegmentIterator.Err()
+}
+
+// tempFile is a file that is removed when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if e := os.Remove(f.Name()); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Cache metrics.
+var (
+	cacheHitCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "litestream",
+		Subsystem: "replica",
+		Name:      "cache_hit_total",
+		Help:      "The number of reads served from the local cache",
+	}, []string{"replica_type"})
+
+	cacheMissCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "litestream",
+		Subsystem: "replica",
+		Name:      "cache_miss_total",
+		Help:      "The number of reads not found in the local cache",
+	}, []string{"replica_type"})
+
+	cacheEvictionCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "litestream",
+		Subsystem: "replica",
+		Name:      "cache_eviction_total",
+		Help:      "The number of objects evicted from the local cache",
+	}, []string{"replica_type"})
+)
@@ -0,0 +1,218 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/cache"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestReplicaClient_SnapshotReader(t *testing.T) {
+	t.Run("ReadThrough", func(t *testing.T) {
+		underlying := memory.NewReplicaClient()
+		c := cache.NewReplicaClient(underlying, t.TempDir())
+
+		if _, err := underlying.WriteSnapshot(context.Background(), "0123456789abcdef", 1, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		} else if got, want := mustReadSnapshot(t, c, "0123456789abcdef", 1), "foo"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+
+		// Remove from the underlying client. Reads should be served by the cache.
+		if err := underlying.DeleteSnapshot(context.Background(), "0123456789abcdef", 1); err != nil {
+			t.Fatal(err)
+		} else if got, want := mustReadSnapshot(t, c, "0123456789abcdef", 1), "foo"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure writes through the cache invalidate any cached copy.
+	t.Run("WriteInvalidates", func(t *testing.T) {
+		c := cache.NewReplicaClient(memory.NewReplicaClient(), t.TempDir())
+
+		if _, err := c.WriteSnapshot(context.Background(), "0123456789abcdef", 1, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		} else if got, want := mustReadSnapshot(t, c, "0123456789abcdef", 1), "foo"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+
+		if _, err := c.WriteSnapshot(context.Background(), "0123456789abcdef", 1, strings.NewReader("bar")); err != nil {
+			t.Fatal(err)
+		} else if got, want := mustReadSnapshot(t, c, "0123456789abcdef", 1), "bar"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("DeleteInvalidates", func(t *testing.T) {
+		c := cache.NewReplicaClient(memory.NewReplicaClient(), t.TempDir())
+
+		if _, err := c.WriteSnapshot(context.Background(), "0123456789abcdef", 1, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		}
+		mustReadSnapshot(t, c, "0123456789abcdef", 1)
+
+		if err := c.DeleteSnapshot(context.Background(), "0123456789abcdef", 1); err != nil {
+			t.Fatal(err)
+		} else if _, err := c.SnapshotReader(context.Background(), "0123456789abcdef", 1); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrNotFound", func(t *testing.T) {
+		c := cache.NewReplicaClient(memory.NewReplicaClient(), t.TempDir())
+		if _, err := c.SnapshotReader(context.Background(), "0123456789abcdef", 1); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicaClient_WALSegmentReader(t *testing.T) {
+	t.Run("Evict", func(t *testing.T) {
+		underlying := memory.NewReplicaClient()
+		c := cache.NewReplicaClient(underlying, t.TempDir())
+		c.MaxSize = 10
+
+		pos0 := litestream.Pos{Generation: "0123456789abcdef", Index: 0, Offset: 0}
+		pos1 := litestream.Pos{Generation: "0123456789abcdef", Index: 0, Offset: 4}
+		pos2 := litestream.Pos{Generation: "0123456789abcdef", Index: 0, Offset: 8}
+		for _, pos := range []litestream.Pos{pos0, pos1, pos2} {
+			if _, err := underlying.WriteWALSegment(context.Background(), pos, bytes.NewReader(make([]byte, 4))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Read pos0 & pos1, then touch pos0 so pos1 is least recently used.
+		mustReadWALSegment(t, c, pos0)
+		mustReadWALSegment(t, c, pos1)
+		mustReadWALSegment(t, c, pos0)
+
+		// Reading pos2 exceeds the max size so pos1 should be evicted.
+		mustReadWALSegment(t, c, pos2)
+
+		if err := underlying.DeleteWALSegments(context.Background(), []litestream.Pos{pos0, pos1, pos2}); err != nil {
+			t.Fatal(err)
+		}
+		mustReadWALSegment(t, c, pos0)
+		mustReadWALSegment(t, c, pos2)
+		if _, err := c.WALSegmentReader(context.Background(), pos1); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure objects larger than the cache are returned but not cached.
+	t.Run("TooLarge", func(t *testing.T) {
+		underlying := memory.NewReplicaClient()
+		c := cache.NewReplicaClient(underlying, t.TempDir())
+		c.MaxSize = 2
+
+		pos := litestream.Pos{Generation: "0123456789abcdef"}
+		if _, err := underlying.WriteWALSegment(context.Background(), pos, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		} else if got, want := mustReadWALSegment(t, c, pos), "foo"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+
+		if err := underlying.DeleteWALSegments(context.Background(), []litestream.Pos{pos}); err != nil {
+			t.Fatal(err)
+		} else if _, err := c.WALSegmentReader(context.Background(), pos); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure a segment replaced outside of the cache, such as by compaction in
+	// another process, is refetched once listing reports a new size.
+	t.Run("SizeChanged", func(t *testing.T) {
+		underlying := memory.NewReplicaClient()
+		c := cache.NewReplicaClient(underlying, t.TempDir())
+
+		pos := litestream.Pos{Generation: "0123456789abcdef"}
+		if _, err := underlying.WriteWALSegment(context.Background(), pos, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		}
+		mustReadWALSegment(t, c, pos)
+
+		if _, err := underlying.WriteWALSegment(context.Background(), pos, strings.NewReader("foobar")); err != nil {
+			t.Fatal(err)
+		}
+		itr, err := c.WALSegments(context.Background(), pos.Generation)
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := litestream.SliceWALSegmentIterator(itr); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := mustReadWALSegment(t, c, pos), "foobar"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure cached objects are loaded from disk by a new client.
+	t.Run("Reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		underlying := memory.NewReplicaClient()
+
+		pos := litestream.Pos{Generation: "0123456789abcdef"}
+		if _, err := underlying.WriteWALSegment(context.Background(), pos, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		}
+		mustReadWALSegment(t, cache.NewReplicaClient(underlying, dir), pos)
+
+		if err := underlying.DeleteWALSegments(context.Background(), []litestream.Pos{pos}); err != nil {
+			t.Fatal(err)
+		} else if got, want := mustReadWALSegment(t, cache.NewReplicaClient(underlying, dir), pos), "foo"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+	})
+}
+
+func TestReplicaClient_DeleteGeneration(t *testing.T) {
+	c := cache.NewReplicaClient(memory.NewReplicaClient(), t.TempDir())
+
+	pos := litestream.Pos{Generation: "0123456789abcdef"}
+	if _, err := c.WriteWALSegment(context.Background(), pos, strings.NewReader("foo")); err != nil {
+		t.Fatal(err)
+	}
+	mustReadWALSegment(t, c, pos)
+
+	if err := c.DeleteGeneration(context.Background(), "0123456789abcdef"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.WALSegmentReader(context.Background(), pos); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func mustReadSnapshot(tb testing.TB, c litestream.ReplicaClient, generation string, index int) string {
+	tb.Helper()
+	rc, err := c.SnapshotReader(context.Background(), generation, index)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(b)
+}
+
+func mustReadWALSegment(tb testing.TB, c litestream.ReplicaClient, pos litestream.Pos) string {
+	tb.Helper()
+	rc, err := c.WALSegmentReader(context.Background(), pos)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(b)
+}
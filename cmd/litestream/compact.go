@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// DefaultCompactLeaseTimeout is the writer lease duration used by the compact
+// command for replicas without a configured lease timeout.
+const DefaultCompactLeaseTimeout = 1 * time.Minute
+
+// CompactCommand represents a command to merge small WAL segments on a replica.
+type CompactCommand struct{}
+
+// Run executes the command.
+func (c *CompactCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-compact", flag.ContinueOnError)
+	configPath, noExpandEnv := registerConfigFlag(fs)
+	replicaName := fs.String("replica", "", "replica name")
+	generation := fs.String("generation", "", "generation name")
+	minSegments := fs.Int("min-segments", 0, "minimum segments per index")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	var db *litestream.DB
+	var r *litestream.Replica
+	if isURL(fs.Arg(0)) {
+		if *configPath != "" {
+			return fmt.Errorf("cannot specify a replica URL and the -config flag")
+		}
+		if r, err = NewReplicaFromConfig(&ReplicaConfig{URL: fs.Arg(0)}, nil); err != nil {
+			return err
+		}
+	} else {
+		if *configPath == "" {
+			*configPath = DefaultConfigPath()
+		}
+
+		// Load configuration.
+		config, err := ReadConfigFile(*configPath, !*noExpandEnv)
+		if err != nil {
+			return err
+		}
+
+		// Lookup database from configuration file by path.
+		if path, err := expand(fs.Arg(0)); err != nil {
+			return err
+		} else if dbc := config.DBConfig(path); dbc == nil {
+			return fmt.Errorf("database not found in config: %s", path)
+		} else if db, err = NewDBFromConfig(dbc); err != nil {
+			return err
+		}
+
+		// Filter by replica, if specified.
+		if *replicaName != "" {
+			if r = db.Replica(*replicaName); r == nil {
+				return fmt.Errorf("replica %q not found for database %q", *replicaName, db.Path())
+			}
+		}
+	}
+
+	// Compact by db or replica.
+	var replicas []*litestream.Replica
+	if r != nil {
+		replicas = []*litestream.Replica{r}
+	} else {
+		replicas = db.Replicas
+	}
+
+	for _, r := range replicas {
+		if err := c.compact(ctx, r, *generation, *minSegments); err != nil {
+			return fmt.Errorf("%s: %w", r.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// compact merges the WAL segments of r while holding its writer lease, if the
+// client supports leases, so segments are not replaced underneath a running
+// replication process.
+func (c *CompactCommand) compact(ctx context.Context, r *litestream.Replica, generation string, minSegments int) (err error) {
+	if litestream.SupportsLeases(r.Client) {
+		if r.LeaseTimeout <= 0 {
+			r.LeaseTimeout = DefaultCompactLeaseTimeout
+		}
+		if err := r.AcquireLease(ctx, false); err != nil {
+			return fmt.Errorf("lease: %w", err)
+		}
+		defer func() {
+			if e := r.ReleaseLease(ctx); e != nil && err == nil {
+				err = fmt.Errorf("release lease: %w", e)
+			}
+		}()
+	}
+
+	n := minSegments
+	if n == 0 {
+		n = r.CompactionMinSegments
+	}
+
+	var generations []string
+	if generation != "" {
+		generations = []string{generation}
+	} else if generations, err = r.Client.Generations(ctx); err != nil {
+		return fmt.Errorf("cannot determine generations: %w", err)
+	}
+
+	for _, generation := range generations {
+		removed, err := r.CompactWAL(ctx, generation, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s/%s: %d wal segments removed\n", r.Name(), generation, removed)
+	}
+	return nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *CompactCommand) Usage() {
+	fmt.Printf(`
+The compact command merges the WAL segments of each completed WAL index on a
+replica into a single segment & deletes the originals. The latest index of
+each generation is skipped as it may still be written to.
+
+The replica's writer lease is acquired while compacting, if supported, so the
+command fails while another replication process holds the lease.
+
+Usage:
+
+	litestream compact [arguments] DB_PATH
+
+	litestream compact [arguments] REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Optional, compact a specific replica.
+
+	-generation NAME
+	    Optional, compact a specific generation.
+
+	-min-segments NUM
+	    Optional, only compact indexes with at least NUM segments.
+	    Defaults to the replica's compaction-min-segments or 2.
+
+Examples:
+
+	# Compact all replicas for a database.
+	$ litestream compact /path/to/db
+
+	# Compact a single generation of a replica URL.
+	$ litestream compact -generation xxxxxxxx s3://mybkt/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -51,8 +51,10 @@ func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Remove Action = 2
 	)
 
-	// Update the config
+	// Update the config. Bandwidth limits are updated in place so existing
+	// replicas pick up the new limits.
 	h.c.Config = newConfig
+	h.c.Config.applyGlobalRateLimits()
 
 	// Take action on each of the databases in the new config
 	for _, newDBConfig := range h.c.Config.DBs {
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// ExportCommand represents a command to export a generation to a bundle file.
+type ExportCommand struct{}
+
+// Run executes the command.
+func (c *ExportCommand) Run(ctx context.Context, args []string) (err error) {
+	opt := litestream.NewRestoreOptions()
+
+	fs := flag.NewFlagSet("litestream-export", flag.ContinueOnError)
+	configPath, noExpandEnv := registerConfigFlag(fs)
+	outputPath := fs.String("o", "", "output path")
+	fs.StringVar(&opt.ReplicaName, "replica", "", "replica name")
+	fs.StringVar(&opt.Generation, "generation", "", "generation name")
+	fs.Var((*indexVar)(&opt.Index), "index", "wal index")
+	timestampStr := fs.String("timestamp", "", "timestamp")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	} else if *outputPath == "" {
+		return fmt.Errorf("output path required")
+	}
+
+	// Parse timestamp, if specified.
+	if *timestampStr != "" {
+		if opt.Timestamp, err = time.Parse(time.RFC3339, *timestampStr); err != nil {
+			return errors.New("invalid -timestamp, must specify in ISO 8601 format (e.g. 2000-01-01T00:00:00Z)")
+		}
+	}
+
+	// Determine replica & generation to export from.
+	var r *litestream.Replica
+	if isURL(fs.Arg(0)) {
+		if *configPath != "" {
+			return fmt.Errorf("cannot specify a replica URL and the -config flag")
+		}
+		if r, err = NewReplicaFromConfig(&ReplicaConfig{URL: fs.Arg(0)}, nil); err != nil {
+			return err
+		}
+		if opt.Generation, _, err = r.CalcRestoreTarget(ctx, opt); err != nil {
+			return err
+		}
+	} else {
+		if *configPath == "" {
+			*configPath = DefaultConfigPath()
+		}
+		if r, err = c.loadFromConfig(ctx, fs.Arg(0), *configPath, !*noExpandEnv, &opt); err != nil {
+			return err
+		}
+	}
+
+	if opt.Generation == "" {
+		return fmt.Errorf("no matching backups found")
+	}
+
+	// Write to a temporary file first so a failed export does not leave a
+	// partial bundle at the output path.
+	filename, err := expand(*outputPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer func() { _ = f.Close() }()
+
+	manifest, err := r.Export(ctx, f, opt)
+	if err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	} else if err := os.Rename(f.Name(), filename); err != nil {
+		return err
+	}
+
+	slog.Info("export complete",
+		"path", filename,
+		"generation", manifest.Generation,
+		"snapshot", fmt.Sprintf("%08x", manifest.Snapshot.Index),
+		"wal_segments", len(manifest.WALSegments),
+	)
+	return nil
+}
+
+// loadFromConfig returns a replica & updates the options from a DB reference.
+func (c *ExportCommand) loadFromConfig(ctx context.Context, dbPath, configPath string, expandEnv bool, opt *litestream.RestoreOptions) (*litestream.Replica, error) {
+	// Load configuration.
+	config, err := ReadConfigFile(configPath, expandEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lookup database from configuration file by path.
+	if dbPath, err = expand(dbPath); err != nil {
+		return nil, err
+	}
+	dbConfig := config.DBConfig(dbPath)
+	if dbConfig == nil {
+		return nil, fmt.Errorf("database not found in config: %s", dbPath)
+	}
+	db, err := NewDBFromConfig(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine the appropriate replica & generation to export from.
+	r, generation, err := db.CalcRestoreTarget(ctx, *opt)
+	if err != nil {
+		return nil, err
+	}
+	opt.Generation = generation
+
+	return r, nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *ExportCommand) Usage() {
+	fmt.Printf(`
+The export command writes a snapshot and its subsequent WAL segments from a
+single generation to a self-describing bundle file. The bundle can be loaded
+into another replica with the import command.
+
+Usage:
+
+	litestream export [arguments] -o PATH DB_PATH
+
+	litestream export [arguments] -o PATH REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-o PATH
+	    Output path of the bundle file. Required.
+
+	-replica NAME
+	    Export from a specific replica.
+	    Defaults to replica with latest data.
+
+	-generation NAME
+	    Export a specific generation.
+	    Defaults to generation with latest data.
+
+	-index NUM
+	    Export up to a specific hex-encoded WAL index (inclusive).
+	    Defaults to use the highest available index.
+
+	-timestamp TIMESTAMP
+	    Export up to a specific point-in-time.
+	    Defaults to use the latest available backup.
+
+Examples:
+
+	# Export the latest generation for a database.
+	$ litestream export -o /tmp/db.bundle /path/to/db
+
+	# Export a specific generation from S3.
+	$ litestream export -replica s3 -generation xxxxxxxx -o /tmp/db.bundle /path/to/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// FollowCommand represents a command to continuously restore a replica into a
+// local read-only database.
+type FollowCommand struct{}
+
+// Run executes the command.
+func (c *FollowCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-follow", flag.ContinueOnError)
+	configPath, noExpandEnv := registerConfigFlag(fs)
+	outputPath := fs.String("o", "", "output path")
+	replicaName := fs.String("replica", "", "replica name")
+	interval := fs.Duration("interval", litestream.DefaultFollowInterval, "poll interval")
+	parallelism := fs.Int("parallelism", litestream.DefaultRestoreParallelism, "parallelism")
+	addr := fs.String("addr", "", "metrics bind address")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	}
+
+	// Allow flags to follow the positional argument.
+	arg := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments")
+	} else if *interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+
+	// Determine replica to follow.
+	var r *litestream.Replica
+	if isURL(arg) {
+		if *configPath != "" {
+			return fmt.Errorf("cannot specify a replica URL and the -config flag")
+		} else if *outputPath == "" {
+			return fmt.Errorf("output path required")
+		}
+		if r, err = NewReplicaFromConfig(&ReplicaConfig{URL: arg}, nil); err != nil {
+			return err
+		}
+	} else {
+		if *configPath == "" {
+			*configPath = DefaultConfigPath()
+		}
+		if r, err = c.loadFromConfig(arg, *configPath, !*noExpandEnv, *replicaName); err != nil {
+			return err
+		}
+
+		// Follow into original database path if not specified.
+		if *outputPath == "" {
+			*outputPath = r.DB().Path()
+		}
+	}
+
+	if *outputPath, err = expand(*outputPath); err != nil {
+		return err
+	}
+
+	f := litestream.NewFollower(r, *outputPath)
+	f.Interval = *interval
+	f.Parallelism = *parallelism
+	if err := f.Open(); err != nil {
+		return err
+	}
+
+	// Serve metrics, if enabled.
+	if *addr != "" {
+		slog.Info("serving metrics on", "addr", *addr)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		go func() {
+			if err := http.ListenAndServe(*addr, mux); err != nil {
+				slog.Error("cannot start the HTTP server", "error", err)
+			}
+		}()
+	}
+
+	// Stop following on signal.
+	signalCh := signalChan()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-signalCh:
+			slog.Info("signal received, litestream shutting down")
+			cancel()
+		}
+	}()
+
+	slog.Info("following replica", "replica", r.Name(), "path", *outputPath)
+	if err := f.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	slog.Info("litestream shut down")
+	return nil
+}
+
+// loadFromConfig returns a replica for a database in the configuration file.
+func (c *FollowCommand) loadFromConfig(dbPath, configPath string, expandEnv bool, replicaName string) (*litestream.Replica, error) {
+	config, err := ReadConfigFile(configPath, expandEnv)
+	if err != nil {
+		return nil, err
+	}
+	config.applyGlobalRateLimits()
+
+	// Lookup database from configuration file by path.
+	if dbPath, err = expand(dbPath); err != nil {
+		return nil, err
+	}
+	dbConfig := config.DBConfig(dbPath)
+	if dbConfig == nil {
+		return nil, fmt.Errorf("database not found in config: %s", dbPath)
+	}
+	db, err := NewDBFromConfig(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Require replica name if the database has more than one replica.
+	if replicaName != "" {
+		r := db.Replica(replicaName)
+		if r == nil {
+			return nil, fmt.Errorf("replica %q not found for database %q", replicaName, db.Path())
+		}
+		return r, nil
+	} else if len(db.Replicas) != 1 {
+		return nil, fmt.Errorf("database has %d replicas, must specify -replica", len(db.Replicas))
+	}
+	return db.Replicas[0], nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *FollowCommand) Usage() {
+	fmt.Printf(`
+The follow command restores the latest snapshot from a replica and then
+continuously applies new WAL segments so the local database stays close
+behind the primary. The local database should only be opened read-only.
+
+Usage:
+
+	litestream follow [arguments] DB_PATH
+
+	litestream follow [arguments] REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Follow a specific replica.
+	    Required if the database has more than one replica.
+
+	-o PATH
+	    Output path of the followed database.
+	    Required for replica URLs. Defaults to original DB path.
+
+	-interval DURATION
+	    Time between checks for new WAL segments.
+	    Defaults to `+litestream.DefaultFollowInterval.String()+`.
+
+	-parallelism NUM
+	    Determines the number of parallel chunks when downloading snapshots.
+	    Defaults to `+strconv.Itoa(litestream.DefaultRestoreParallelism)+`.
+
+	-addr BIND_ADDR
+	    Serves Prometheus metrics, including follower lag, on /metrics.
+
+Examples:
+
+	# Follow an S3 replica into a local database.
+	$ litestream follow s3://mybkt/db -o /var/lib/db
+
+	# Follow the replica of a configured database & serve metrics.
+	$ litestream follow -addr :9090 /path/to/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"text/tabwriter"
@@ -20,6 +21,7 @@ func (c *GenerationsCommand) Run(ctx context.Context, args []string) (err error)
 	fs := flag.NewFlagSet("litestream-generations", flag.ContinueOnError)
 	configPath, noExpandEnv := registerConfigFlag(fs)
 	replicaName := fs.String("replica", "", "replica name")
+	tree := fs.Bool("tree", false, "show generation lineage")
 	fs.Usage = c.Usage
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -79,6 +81,19 @@ func (c *GenerationsCommand) Run(ctx context.Context, args []string) (err error)
 		replicas = db.Replicas
 	}
 
+	// Print lineage of generations, if requested.
+	if *tree {
+		for _, r := range replicas {
+			generations, err := r.Client.Generations(ctx)
+			if err != nil {
+				r.Logger().Error("cannot list generations", "error", err)
+				continue
+			}
+			c.printTree(ctx, os.Stdout, r, generations)
+		}
+		return nil
+	}
+
 	// List each generation.
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
 	defer w.Flush()
@@ -114,6 +129,70 @@ func (c *GenerationsCommand) Run(ctx context.Context, args []string) (err error)
 	return nil
 }
 
+// printTree writes the generations of a replica as a tree where each
+// generation is listed under the generation it forked from.
+func (c *GenerationsCommand) printTree(ctx context.Context, w io.Writer, r *litestream.Replica, generations []string) {
+	metas := make(map[string]*litestream.GenerationMeta, len(generations))
+	for _, generation := range generations {
+		meta, err := r.GenerationMeta(ctx, generation)
+		if err != nil {
+			r.Logger().Error("cannot read generation metadata", "generation", generation, "error", err)
+		}
+		metas[generation] = meta
+	}
+
+	// Attach each generation to its parent if the parent still exists.
+	var roots []string
+	children := make(map[string][]string)
+	for _, generation := range generations {
+		meta := metas[generation]
+		if meta == nil || meta.ParentGeneration == "" || meta.ParentGeneration == generation {
+			roots = append(roots, generation)
+		} else if _, ok := metas[meta.ParentGeneration]; !ok {
+			roots = append(roots, generation)
+		} else {
+			children[meta.ParentGeneration] = append(children[meta.ParentGeneration], generation)
+		}
+	}
+
+	fmt.Fprintln(w, r.Name())
+	c.printTreeNodes(w, roots, children, metas, "")
+}
+
+func (c *GenerationsCommand) printTreeNodes(w io.Writer, generations []string, children map[string][]string, metas map[string]*litestream.GenerationMeta, prefix string) {
+	// Order siblings by creation time, falling back to name.
+	sort.Slice(generations, func(i, j int) bool {
+		mi, mj := metas[generations[i]], metas[generations[j]]
+		if mi != nil && mj != nil && !mi.CreatedAt.Equal(mj.CreatedAt) {
+			return mi.CreatedAt.Before(mj.CreatedAt)
+		}
+		return generations[i] < generations[j]
+	})
+
+	for i, generation := range generations {
+		branch, indent := "├── ", "│   "
+		if i == len(generations)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		fmt.Fprintf(w, "%s%s%s  %s\n", prefix, branch, generation, formatGenerationMeta(metas[generation]))
+		c.printTreeNodes(w, children[generation], children, metas, prefix+indent)
+	}
+}
+
+// formatGenerationMeta returns a single line description of a generation's origin.
+func formatGenerationMeta(meta *litestream.GenerationMeta) string {
+	if meta == nil {
+		return "(no metadata)"
+	}
+
+	s := fmt.Sprintf("%s  %s  %s", meta.CreatedAt.Format(time.RFC3339), meta.Hostname, meta.Reason)
+	if meta.ParentGeneration != "" {
+		s += fmt.Sprintf(" (forked from %s)", meta.ParentPos().String())
+	}
+	return s
+}
+
 // Usage prints the help message to STDOUT.
 func (c *GenerationsCommand) Usage() {
 	fmt.Printf(`
@@ -139,6 +218,10 @@ Arguments:
 	-replica NAME
 	    Optional, filters by replica.
 
+	-tree
+	    Shows the lineage of generations, including the reason each
+	    generation was started & the position of its parent.
+
 `[1:],
 		DefaultConfigPath(),
 	)
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// ImportCommand represents a command to load a bundle file into a replica.
+type ImportCommand struct{}
+
+// Run executes the command.
+func (c *ImportCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-import", flag.ContinueOnError)
+	configPath, noExpandEnv := registerConfigFlag(fs)
+	replicaName := fs.String("replica", "", "replica name")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("bundle path required")
+	} else if fs.NArg() == 1 || fs.Arg(1) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	} else if fs.NArg() > 2 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	// Determine replica to import into.
+	var r *litestream.Replica
+	if isURL(fs.Arg(1)) {
+		if *configPath != "" {
+			return fmt.Errorf("cannot specify a replica URL and the -config flag")
+		}
+		if r, err = NewReplicaFromConfig(&ReplicaConfig{URL: fs.Arg(1)}, nil); err != nil {
+			return err
+		}
+	} else {
+		if *configPath == "" {
+			*configPath = DefaultConfigPath()
+		}
+
+		// Load configuration.
+		config, err := ReadConfigFile(*configPath, !*noExpandEnv)
+		if err != nil {
+			return err
+		}
+
+		// Lookup database from configuration file by path.
+		var db *litestream.DB
+		if path, err := expand(fs.Arg(1)); err != nil {
+			return err
+		} else if dbc := config.DBConfig(path); dbc == nil {
+			return fmt.Errorf("database not found in config: %s", path)
+		} else if db, err = NewDBFromConfig(dbc); err != nil {
+			return err
+		}
+
+		// Require replica name if the database has more than one replica.
+		if *replicaName != "" {
+			if r = db.Replica(*replicaName); r == nil {
+				return fmt.Errorf("replica %q not found for database %q", *replicaName, db.Path())
+			}
+		} else if len(db.Replicas) == 1 {
+			r = db.Replicas[0]
+		} else {
+			return fmt.Errorf("database has multiple replicas, must specify -replica")
+		}
+	}
+
+	filename, err := expand(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	manifest, err := r.Import(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("import complete",
+		"replica", r.Name(),
+		"generation", manifest.Generation,
+		"snapshot", fmt.Sprintf("%08x", manifest.Snapshot.Index),
+		"wal_segments", len(manifest.WALSegments),
+	)
+	return nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *ImportCommand) Usage() {
+	fmt.Printf(`
+The import command loads a bundle file created by the export command into a
+replica. The bundle's generation must not already exist on the replica.
+
+Usage:
+
+	litestream import [arguments] BUNDLE_PATH DB_PATH
+
+	litestream import [arguments] BUNDLE_PATH REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Import into a specific replica.
+	    Required if the database has more than one replica.
+
+Examples:
+
+	# Import a bundle into the database's only replica.
+	$ litestream import /tmp/db.bundle /path/to/db
+
+	# Import a bundle into an S3 bucket.
+	$ litestream import /tmp/db.bundle s3://mybkt/db
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
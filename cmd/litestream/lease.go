@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// LeaseCommand represents a command to show or break the writer lease of a replica.
+type LeaseCommand struct{}
+
+// Run executes the command.
+func (c *LeaseCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-lease", flag.ContinueOnError)
+	configPath, noExpandEnv := registerConfigFlag(fs)
+	replicaName := fs.String("replica", "", "replica name")
+	breakLease := fs.Bool("break", false, "delete lease regardless of holder")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 || fs.Arg(0) == "" {
+		return fmt.Errorf("database path or replica URL required")
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	var replicas []*litestream.Replica
+	if isURL(fs.Arg(0)) {
+		if *configPath != "" {
+			return fmt.Errorf("cannot specify a replica URL and the -config flag")
+		}
+		r, err := NewReplicaFromConfig(&ReplicaConfig{URL: fs.Arg(0)}, nil)
+		if err != nil {
+			return err
+		}
+		replicas = []*litestream.Replica{r}
+	} else {
+		if *configPath == "" {
+			*configPath = DefaultConfigPath()
+		}
+
+		// Load configuration.
+		config, err := ReadConfigFile(*configPath, !*noExpandEnv)
+		if err != nil {
+			return err
+		}
+
+		// Lookup database from configuration file by path.
+		var db *litestream.DB
+		if path, err := expand(fs.Arg(0)); err != nil {
+			return err
+		} else if dbc := config.DBConfig(path); dbc == nil {
+			return fmt.Errorf("database not found in config: %s", path)
+		} else if db, err = NewDBFromConfig(dbc); err != nil {
+			return err
+		}
+
+		// Filter by replica, if specified.
+		if *replicaName != "" {
+			r := db.Replica(*replicaName)
+			if r == nil {
+				return fmt.Errorf("replica %q not found for database %q", *replicaName, db.Path())
+			}
+			replicas = []*litestream.Replica{r}
+		} else {
+			replicas = db.Replicas
+		}
+	}
+
+	// Break lease on each replica, if requested.
+	if *breakLease {
+		for _, r := range replicas {
+			if err := r.BreakLease(ctx); err != nil {
+				return fmt.Errorf("break lease on %s: %w", r.Name(), err)
+			}
+			slog.Info("lease broken", "replica", r.Name())
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "name\tholder\tstatus\trenewed\texpires")
+	now := time.Now()
+	for _, r := range replicas {
+		lease, err := r.ReadLease(ctx)
+		if err != nil {
+			r.Logger().Error("cannot read lease", "error", err)
+			continue
+		} else if lease == nil {
+			fmt.Fprintf(w, "%s\t-\tnone\t-\t-\n", r.Name())
+			continue
+		}
+
+		status := "held"
+		if lease.Expired(now) {
+			status = "expired"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			r.Name(),
+			lease.Holder,
+			status,
+			lease.RenewedAt.Format(time.RFC3339),
+			lease.ExpiresAt.Format(time.RFC3339),
+		)
+	}
+
+	return nil
+}
+
+// Usage prints the help message to STDOUT.
+func (c *LeaseCommand) Usage() {
+	fmt.Printf(`
+The lease command shows the writer lease stored in a database's replicas. A
+lease prevents more than one primary from replicating to the same location.
+Leases are enabled with the "lease-timeout" replica setting.
+
+Usage:
+
+	litestream lease [arguments] DB_PATH
+
+	litestream lease [arguments] REPLICA_URL
+
+Arguments:
+
+	-config PATH
+	    Specifies the configuration file.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+	-replica NAME
+	    Optional, filters by replica.
+
+	-break
+	    Deletes the lease regardless of its holder so that another
+	    writer can take over before the lease expires. Only use this
+	    once the previous primary has stopped replicating.
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/url"
 	"os"
 	"os/user"
@@ -22,10 +23,17 @@ import (
 
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/abs"
+	"github.com/benbjohnson/litestream/cache"
 	"github.com/benbjohnson/litestream/file"
 	"github.com/benbjohnson/litestream/gcs"
+	lshttp "github.com/benbjohnson/litestream/http"
+	"github.com/benbjohnson/litestream/memory"
+	"github.com/benbjohnson/litestream/ratelimit"
+	"github.com/benbjohnson/litestream/retry"
 	"github.com/benbjohnson/litestream/s3"
 	"github.com/benbjohnson/litestream/sftp"
+	"github.com/benbjohnson/litestream/sqlite"
+	"github.com/benbjohnson/litestream/webdav"
 )
 
 // Build information.
@@ -37,6 +45,8 @@ var (
 var errStop = errors.New("stop")
 
 func main() {
+	litestream.Version = Version
+
 	m := NewMain()
 	if err := m.Run(context.Background(), os.Args[1:]); err == flag.ErrHelp || err == errStop {
 		os.Exit(1)
@@ -73,10 +83,20 @@ func (m *Main) Run(ctx context.Context, args []string) (err error) {
 	}
 
 	switch cmd {
+	case "compact":
+		return (&CompactCommand{}).Run(ctx, args)
 	case "databases":
 		return (&DatabasesCommand{}).Run(ctx, args)
+	case "export":
+		return (&ExportCommand{}).Run(ctx, args)
+	case "follow":
+		return (&FollowCommand{}).Run(ctx, args)
 	case "generations":
 		return (&GenerationsCommand{}).Run(ctx, args)
+	case "import":
+		return (&ImportCommand{}).Run(ctx, args)
+	case "lease":
+		return (&LeaseCommand{}).Run(ctx, args)
 	case "replicate":
 		c := NewReplicateCommand()
 		if err := c.ParseFlags(ctx, args); err != nil {
@@ -119,6 +139,8 @@ func (m *Main) Run(ctx context.Context, args []string) (err error) {
 
 	case "restore":
 		return (&RestoreCommand{}).Run(ctx, args)
+	case "serve":
+		return (&ServeCommand{}).Run(ctx, args)
 	case "snapshots":
 		return (&SnapshotsCommand{}).Run(ctx, args)
 	case "version":
@@ -145,10 +167,16 @@ Usage:
 
 The commands are:
 
+	compact      merges small WAL segments on a replica
 	databases    list databases specified in config file
+	export       writes a generation from a replica to a bundle file
+	follow       continuously restores a replica as a read-only standby
 	generations  list available generations for a database
+	import       loads a bundle file into a replica
+	lease        shows or breaks the writer lease of a replica
 	replicate    runs a server to replicate databases
 	restore      recovers database backup from a replica
+	serve        runs a server to receive replicas over HTTP
 	snapshots    list available snapshots for a database
 	version      prints the binary version
 	wal          list available WAL files for a database
@@ -170,8 +198,20 @@ type Config struct {
 	AccessKeyID     string `yaml:"access-key-id"`
 	SecretAccessKey string `yaml:"secret-access-key"`
 
+	// Process-wide bandwidth limits shared by all replicas (e.g. "10MB").
+	UploadRateLimit   string `yaml:"upload-rate-limit"`
+	DownloadRateLimit string `yaml:"download-rate-limit"`
+
+	// Parsed bandwidth limits, in bytes per second. These are only applied
+	// to the process by applyGlobalRateLimits().
+	UploadLimit   int64 `yaml:"-"`
+	DownloadLimit int64 `yaml:"-"`
+
 	// Logging
 	Logging LoggingConfig `yaml:"logging"`
+
+	// Settings for receiving replicas via the "serve" command.
+	Serve ServeConfig `yaml:"serve"`
 }
 
 type HTTPConfig struct {
@@ -189,6 +229,9 @@ type HTTPConfig struct {
 
 	// Whether to handle snapshot signals via HTTP or not. This disables timeout-based snapshots.
 	Snapshot bool `yaml:"snapshot"`
+
+	// Whether to handle requests that block until a position is replicated.
+	Wait bool `yaml:"wait"`
 }
 
 // LoggingConfig configures logging.
@@ -210,6 +253,22 @@ func (c *Config) propagateGlobalSettings() {
 			}
 		}
 	}
+
+	if rc := c.Serve.Replica; rc != nil {
+		if rc.AccessKeyID == "" {
+			rc.AccessKeyID = c.AccessKeyID
+		}
+		if rc.SecretAccessKey == "" {
+			rc.SecretAccessKey = c.SecretAccessKey
+		}
+	}
+}
+
+// applyGlobalRateLimits sets the process-wide bandwidth limits. It must be
+// called before replicas are created so their clients are wrapped.
+func (c *Config) applyGlobalRateLimits() {
+	ratelimit.SetGlobalUploadLimit(c.UploadLimit)
+	ratelimit.SetGlobalDownloadLimit(c.DownloadLimit)
 }
 
 // DefaultConfig returns a new instance of Config with defaults set.
@@ -265,6 +324,13 @@ func ReadConfigFile(filename string, expandEnv bool) (_ Config, err error) {
 	// Propage settings from global config to replica configs.
 	config.propagateGlobalSettings()
 
+	// Parse process-wide bandwidth limits.
+	if config.UploadLimit, err = ParseRateLimit(config.UploadRateLimit); err != nil {
+		return config, fmt.Errorf("invalid upload-rate-limit: %w", err)
+	} else if config.DownloadLimit, err = ParseRateLimit(config.DownloadRateLimit); err != nil {
+		return config, fmt.Errorf("invalid download-rate-limit: %w", err)
+	}
+
 	// Configure logging.
 	logOutput := os.Stdout
 	if config.Logging.Stderr {
@@ -303,10 +369,17 @@ type DBConfig struct {
 	Path               string         `yaml:"path"`
 	MetaPath           *string        `yaml:"meta-path"`
 	MonitorInterval    *time.Duration `yaml:"monitor-interval"`
+	MonitorMode        string         `yaml:"monitor-mode"` // "poll", "inotify"
+	MonitorDebounce    *time.Duration `yaml:"monitor-debounce"`
 	CheckpointInterval *time.Duration `yaml:"checkpoint-interval"`
 	MinCheckpointPageN *int           `yaml:"min-checkpoint-page-count"`
 	MaxCheckpointPageN *int           `yaml:"max-checkpoint-page-count"`
 
+	// Limit on shadow WAL retained for a lagging replica (e.g. "1GB") & the
+	// policy applied once exceeded ("alert", "drop" or "throttle").
+	MaxShadowWALSize string `yaml:"max-shadow-wal-size"`
+	ShadowWALPolicy  string `yaml:"shadow-wal-policy"`
+
 	Replicas []*ReplicaConfig `yaml:"replicas"`
 }
 
@@ -327,6 +400,16 @@ func NewDBFromConfig(dbc *DBConfig) (*litestream.DB, error) {
 	if dbc.MonitorInterval != nil {
 		db.MonitorInterval = *dbc.MonitorInterval
 	}
+	switch dbc.MonitorMode {
+	case "":
+	case litestream.MonitorModePoll, litestream.MonitorModeInotify:
+		db.MonitorMode = dbc.MonitorMode
+	default:
+		return nil, fmt.Errorf("unknown monitor mode for database %q: %q", path, dbc.MonitorMode)
+	}
+	if dbc.MonitorDebounce != nil {
+		db.MonitorDebounce = *dbc.MonitorDebounce
+	}
 	if dbc.CheckpointInterval != nil {
 		db.CheckpointInterval = *dbc.CheckpointInterval
 	}
@@ -336,6 +419,16 @@ func NewDBFromConfig(dbc *DBConfig) (*litestream.DB, error) {
 	if dbc.MaxCheckpointPageN != nil {
 		db.MaxCheckpointPageN = *dbc.MaxCheckpointPageN
 	}
+	if db.MaxShadowWALSize, err = ParseByteSize(dbc.MaxShadowWALSize); err != nil {
+		return nil, fmt.Errorf("invalid max-shadow-wal-size for database %q: %w", path, err)
+	}
+	switch dbc.ShadowWALPolicy {
+	case "":
+	case litestream.ShadowWALPolicyAlert, litestream.ShadowWALPolicyDrop, litestream.ShadowWALPolicyThrottle:
+		db.ShadowWALPolicy = dbc.ShadowWALPolicy
+	default:
+		return nil, fmt.Errorf("unknown shadow wal policy for database %q: %q", path, dbc.ShadowWALPolicy)
+	}
 
 	// Instantiate and attach replicas.
 	for _, rc := range dbc.Replicas {
@@ -361,6 +454,30 @@ type ReplicaConfig struct {
 	SnapshotInterval       *time.Duration `yaml:"snapshot-interval"`
 	ValidationInterval     *time.Duration `yaml:"validation-interval"`
 
+	// WAL segment batching. Small segments are held back until they reach
+	// min-segment-size (e.g. "1MB") or max-segment-delay elapses.
+	MinSegmentSize  string         `yaml:"min-segment-size"`
+	MaxSegmentDelay *time.Duration `yaml:"max-segment-delay"`
+
+	// Minimum WAL segments per index merged during retention checks.
+	// Disabled if unset.
+	CompactionMinSegments *int `yaml:"compaction-min-segments"`
+
+	// Writer lease stored in the replica. Disabled if lease-timeout is unset.
+	LeaseTimeout *time.Duration `yaml:"lease-timeout"`
+	LeaseHolder  string         `yaml:"lease-holder"`
+
+	// Compression codec ("lz4", "zstd" or "none") & level for new data.
+	Codec            string `yaml:"codec"`
+	CompressionLevel int    `yaml:"compression-level"`
+
+	// Number of delta snapshots written between full snapshots. Disabled if unset.
+	MaxDeltaSnapshots *int `yaml:"max-delta-snapshots"`
+
+	// Snapshot mode ("direct" or "staged") & staging directory.
+	SnapshotMode        string `yaml:"snapshot-mode"`
+	SnapshotStagingPath string `yaml:"snapshot-staging-path"`
+
 	// S3 settings
 	AccessKeyID     string `yaml:"access-key-id"`
 	SecretAccessKey string `yaml:"secret-access-key"`
@@ -370,16 +487,55 @@ type ReplicaConfig struct {
 	ForcePathStyle  *bool  `yaml:"force-path-style"`
 	SkipVerify      bool   `yaml:"skip-verify"`
 
-	// ABS settings
-	AccountName string `yaml:"account-name"`
-	AccountKey  string `yaml:"account-key"`
+	// S3 encryption, storage class & tagging settings
+	SSE                  string            `yaml:"sse"` // "AES256", "aws:kms"
+	SSEKMSKeyID          string            `yaml:"sse-kms-key-id"`
+	SSECustomerKey       string            `yaml:"sse-customer-key"` // base64-encoded
+	StorageClass         string            `yaml:"storage-class"`
+	SnapshotStorageClass string            `yaml:"snapshot-storage-class"`
+	WALStorageClass      string            `yaml:"wal-storage-class"`
+	Tags                 map[string]string `yaml:"tags"`
 
-	// SFTP settings
+	// GCS settings
+	CredentialsPath string `yaml:"credentials-path"`
+	CredentialsJSON string `yaml:"credentials-json"`
+	EmulatorHost    string `yaml:"emulator-host"`
+
+	// ABS settings
+	AccountName        string `yaml:"account-name"`
+	AccountKey         string `yaml:"account-key"`
+	SASToken           string `yaml:"sas-token"`
+	ConnectionString   string `yaml:"connection-string"`
+	TenantID           string `yaml:"tenant-id"`
+	ClientID           string `yaml:"client-id"`
+	ClientSecret       string `yaml:"client-secret"`
+	UseManagedIdentity bool   `yaml:"managed-identity"`
+
+	// SFTP & WebDAV settings
 	Host     string `yaml:"host"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	KeyPath  string `yaml:"key-path"`
 
+	// SFTP settings
+	KeyPassphrase  string `yaml:"key-passphrase"`
+	KnownHostsPath string `yaml:"known-hosts-path"`
+	HostKey        string `yaml:"host-key"`
+
+	// HTTP settings
+	Token string `yaml:"token"`
+
+	// Retry & circuit breaker settings. Disabled if unset.
+	Retry *RetryConfig `yaml:"retry"`
+
+	// Bandwidth limits for this replica (e.g. "10MB").
+	UploadRateLimit   string `yaml:"upload-rate-limit"`
+	DownloadRateLimit string `yaml:"download-rate-limit"`
+
+	// Local cache for snapshots & WAL segments read from the replica.
+	// Disabled if unset.
+	Cache *CacheConfig `yaml:"cache"`
+
 	// Encryption identities and recipients
 	Age struct {
 		Identities []string `yaml:"identities"`
@@ -411,6 +567,37 @@ func NewReplicaFromConfig(c *ReplicaConfig, db *litestream.DB) (_ *litestream.Re
 	if v := c.ValidationInterval; v != nil {
 		r.ValidationInterval = *v
 	}
+	if r.MinSegmentSize, err = ParseByteSize(c.MinSegmentSize); err != nil {
+		return nil, fmt.Errorf("invalid min-segment-size: %w", err)
+	}
+	if v := c.MaxSegmentDelay; v != nil {
+		r.MaxSegmentDelay = *v
+	}
+	if v := c.CompactionMinSegments; v != nil {
+		r.CompactionMinSegments = *v
+	}
+	if v := c.LeaseTimeout; v != nil {
+		r.LeaseTimeout = *v
+	}
+	if c.LeaseHolder != "" {
+		r.LeaseHolder = c.LeaseHolder
+	}
+	if err := litestream.ValidateCodec(c.Codec, c.CompressionLevel); err != nil {
+		return nil, err
+	} else if c.Codec != "" {
+		r.Codec = c.Codec
+	}
+	r.CompressionLevel = c.CompressionLevel
+	if v := c.MaxDeltaSnapshots; v != nil {
+		r.MaxDeltaSnapshots = *v
+	}
+	switch c.SnapshotMode {
+	case "", litestream.SnapshotModeDirect, litestream.SnapshotModeStaged:
+		r.SnapshotMode = c.SnapshotMode
+	default:
+		return nil, fmt.Errorf("unknown snapshot mode: %q", c.SnapshotMode)
+	}
+	r.SnapshotStagingPath = c.SnapshotStagingPath
 	for _, str := range c.Age.Identities {
 		identities, err := age.ParseIdentities(strings.NewReader(str))
 		if err != nil {
@@ -450,13 +637,194 @@ func NewReplicaFromConfig(c *ReplicaConfig, db *litestream.DB) (_ *litestream.Re
 		if r.Client, err = newSFTPReplicaClientFromConfig(c, r); err != nil {
 			return nil, err
 		}
+	case "webdav":
+		if r.Client, err = newWebDAVReplicaClientFromConfig(c, r); err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		if r.Client, err = newHTTPReplicaClientFromConfig(c, r); err != nil {
+			return nil, err
+		}
+	case "mem":
+		if r.Client, err = newMemReplicaClientFromConfig(c, r); err != nil {
+			return nil, err
+		}
+	case "sqlite":
+		if r.Client, err = newSQLiteReplicaClientFromConfig(c, r); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("unknown replica type in config: %q", c.Type)
 	}
 
+	// Wrap client with bandwidth limits, if enabled. The global limits apply
+	// to all replicas so the client is wrapped if either is set.
+	uploadRateLimit, err := ParseRateLimit(c.UploadRateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload-rate-limit: %w", err)
+	}
+	downloadRateLimit, err := ParseRateLimit(c.DownloadRateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download-rate-limit: %w", err)
+	}
+	if uploadRateLimit > 0 || downloadRateLimit > 0 || ratelimit.HasGlobalLimit() {
+		client := ratelimit.NewReplicaClient(r.Client)
+		client.UploadLimiter = ratelimit.NewLimiter(uploadRateLimit)
+		client.DownloadLimiter = ratelimit.NewLimiter(downloadRateLimit)
+		r.Client = client
+	}
+
+	// Wrap client with retries, if enabled. Writes are spooled alongside the
+	// database's other temporary files so they are removed on restart.
+	if c.Retry != nil {
+		client, err := c.Retry.NewReplicaClient(r.Client)
+		if err != nil {
+			return nil, err
+		}
+		if db != nil {
+			client.SpoolPath = filepath.Join(db.MetaPath(), "spool")
+		}
+		r.Client = client
+	}
+
+	// Wrap client with a read-through cache, if enabled. This is applied last
+	// so cache hits skip rate limits & retries.
+	if c.Cache != nil {
+		if r.Client, err = c.Cache.NewReplicaClient(r.Client); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reject leases up front instead of failing on every sync.
+	if r.LeaseTimeout > 0 && !litestream.SupportsLeases(r.Client) {
+		return nil, fmt.Errorf("lease-timeout is not supported by %s replicas", r.Client.Type())
+	}
+
 	return r, nil
 }
 
+// ParseRateLimit parses a bandwidth limit in bytes per second. The value can
+// use decimal (KB, MB, GB) or binary (KiB, MiB, GiB) units and an optional
+// "/s" suffix. An empty string returns zero, which means unlimited.
+func ParseRateLimit(s string) (int64, error) {
+	n, err := ParseByteSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse rate limit: %w", err)
+	}
+	return n, nil
+}
+
+// ParseByteSize parses a size in bytes. The value can use decimal (KB, MB, GB)
+// or binary (KiB, MiB, GiB) units. An empty string returns zero.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	m := byteSizeRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	switch strings.ToUpper(m[2]) {
+	case "", "B":
+	case "K", "KB":
+		f *= 1e3
+	case "M", "MB":
+		f *= 1e6
+	case "G", "GB":
+		f *= 1e9
+	case "KIB":
+		f *= 1 << 10
+	case "MIB":
+		f *= 1 << 20
+	case "GIB":
+		f *= 1 << 30
+	default:
+		return 0, fmt.Errorf("unknown size unit: %q", m[2])
+	}
+	return int64(f), nil
+}
+
+var byteSizeRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([A-Za-z]*)$`)
+
+// RetryConfig represents the retry & circuit breaker settings for a replica.
+type RetryConfig struct {
+	MaxAttempts      *int           `yaml:"max-attempts"`
+	MinBackoff       *time.Duration `yaml:"min-backoff"`
+	MaxBackoff       *time.Duration `yaml:"max-backoff"`
+	Jitter           *float64       `yaml:"jitter"`
+	BreakerThreshold *int           `yaml:"breaker-threshold"`
+	BreakerCooldown  *time.Duration `yaml:"breaker-cooldown"`
+	MaxSpoolSize     string         `yaml:"max-spool-size"` // e.g. "64MB", "0" to spool writes of any size
+}
+
+// NewReplicaClient returns client wrapped with the configured retry settings.
+func (c *RetryConfig) NewReplicaClient(client litestream.ReplicaClient) (*retry.ReplicaClient, error) {
+	rc := retry.NewReplicaClient(client)
+	if v := c.MaxAttempts; v != nil {
+		rc.MaxAttempts = *v
+	}
+	if v := c.MinBackoff; v != nil {
+		rc.MinBackoff = *v
+	}
+	if v := c.MaxBackoff; v != nil {
+		rc.MaxBackoff = *v
+	}
+	if v := c.Jitter; v != nil {
+		rc.Jitter = *v
+	}
+	if v := c.BreakerThreshold; v != nil {
+		rc.BreakerThreshold = *v
+	}
+	if v := c.BreakerCooldown; v != nil {
+		rc.BreakerCooldown = *v
+	}
+	if c.MaxSpoolSize != "" {
+		n, err := ParseByteSize(c.MaxSpoolSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry max-spool-size: %w", err)
+		}
+		rc.MaxSpoolSize = n
+	}
+	return rc, nil
+}
+
+// CacheConfig represents the local read-through cache settings for a replica.
+type CacheConfig struct {
+	Path    string `yaml:"path"`
+	MaxSize string `yaml:"max-size"` // e.g. "1GB"
+}
+
+// NewReplicaClient returns client wrapped with the configured cache.
+func (c *CacheConfig) NewReplicaClient(client litestream.ReplicaClient) (*cache.ReplicaClient, error) {
+	if c.Path == "" {
+		return nil, fmt.Errorf("cache path required")
+	}
+
+	path, err := expand(c.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize, err := ParseByteSize(c.MaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache max-size: %w", err)
+	}
+
+	rc := cache.NewReplicaClient(client, path)
+	if maxSize > 0 {
+		rc.MaxSize = maxSize
+	}
+	return rc, nil
+}
+
 // newFileReplicaClientFromConfig returns a new instance of file.ReplicaClient built from config.
 func newFileReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *file.ReplicaClient, err error) {
 	// Ensure URL & path are not both specified.
@@ -538,6 +906,15 @@ func newS3ReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *s
 		return nil, fmt.Errorf("bucket required for s3 replica")
 	}
 
+	// Apply the general storage class unless overridden per object type.
+	snapshotStorageClass, walStorageClass := c.StorageClass, c.StorageClass
+	if c.SnapshotStorageClass != "" {
+		snapshotStorageClass = c.SnapshotStorageClass
+	}
+	if c.WALStorageClass != "" {
+		walStorageClass = c.WALStorageClass
+	}
+
 	// Build replica.
 	client := s3.NewReplicaClient()
 	client.AccessKeyID = c.AccessKeyID
@@ -548,6 +925,12 @@ func newS3ReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *s
 	client.Endpoint = endpoint
 	client.ForcePathStyle = forcePathStyle
 	client.SkipVerify = skipVerify
+	client.SSE = c.SSE
+	client.SSEKMSKeyID = c.SSEKMSKeyID
+	client.SSECustomerKey = c.SSECustomerKey
+	client.SnapshotStorageClass = snapshotStorageClass
+	client.WALStorageClass = walStorageClass
+	client.Tags = c.Tags
 	return client, nil
 }
 
@@ -581,12 +964,25 @@ func newGCSReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *
 	// Ensure required settings are set.
 	if bucket == "" {
 		return nil, fmt.Errorf("bucket required for gcs replica")
+	} else if c.CredentialsPath != "" && c.CredentialsJSON != "" {
+		return nil, fmt.Errorf("cannot specify credentials-path & credentials-json for gcs replica")
+	} else if c.Endpoint != "" && c.EmulatorHost != "" {
+		return nil, fmt.Errorf("cannot specify endpoint & emulator-host for gcs replica")
 	}
 
 	// Build replica.
 	client := gcs.NewReplicaClient()
 	client.Bucket = bucket
 	client.Path = path
+	client.CredentialsJSON = c.CredentialsJSON
+	client.Endpoint = c.Endpoint
+	client.EmulatorHost = c.EmulatorHost
+
+	if c.CredentialsPath != "" {
+		if client.CredentialsPath, err = expand(c.CredentialsPath); err != nil {
+			return nil, err
+		}
+	}
 	return client, nil
 }
 
@@ -606,6 +1002,25 @@ func newABSReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *
 	client.Bucket = c.Bucket
 	client.Path = c.Path
 	client.Endpoint = c.Endpoint
+	client.SASToken = c.SASToken
+	client.ConnectionString = c.ConnectionString
+	client.TenantID = c.TenantID
+	client.ClientID = c.ClientID
+	client.ClientSecret = c.ClientSecret
+	client.UseManagedIdentity = c.UseManagedIdentity
+
+	// Use path-style account URLs for local endpoints, such as Azurite.
+	// Azure itself always uses the account name in the host name.
+	if c.Endpoint != "" {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse abs endpoint: %w", err)
+		}
+		client.ForcePathStyle = isLocalHost(u.Hostname())
+	}
+	if v := c.ForcePathStyle; v != nil {
+		client.ForcePathStyle = *v
+	}
 
 	// Apply settings from URL, if specified.
 	if c.URL != "" {
@@ -633,6 +1048,11 @@ func newABSReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *
 	return client, nil
 }
 
+// isLocalHost returns true if host is "localhost" or an IP address.
+func isLocalHost(host string) bool {
+	return host == "localhost" || strings.HasSuffix(host, ".localhost") || net.ParseIP(host) != nil
+}
+
 // newSFTPReplicaClientFromConfig returns a new instance of sftp.ReplicaClient built from config.
 func newSFTPReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *sftp.ReplicaClient, err error) {
 	// Ensure URL & constituent parts are not both specified.
@@ -680,6 +1100,155 @@ func newSFTPReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_
 	client.Password = password
 	client.Path = path
 	client.KeyPath = c.KeyPath
+	client.KeyPassphrase = c.KeyPassphrase
+	client.HostKey = c.HostKey
+	client.AgentSocket = os.Getenv("SSH_AUTH_SOCK")
+
+	if c.KnownHostsPath != "" {
+		if client.KnownHostsPath, err = expand(c.KnownHostsPath); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// newWebDAVReplicaClientFromConfig returns a new instance of webdav.ReplicaClient built from config.
+func newWebDAVReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *webdav.ReplicaClient, err error) {
+	// Ensure URL & constituent parts are not both specified.
+	if c.URL != "" && c.Path != "" {
+		return nil, fmt.Errorf("cannot specify url & path for webdav replica")
+	} else if c.URL != "" && c.Host != "" {
+		return nil, fmt.Errorf("cannot specify url & host for webdav replica")
+	}
+
+	endpoint, host, user, password, path := c.Endpoint, c.Host, c.User, c.Password, c.Path
+
+	// Apply settings from URL, if specified.
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only apply URL parts to field that have not been overridden.
+		host = u.Host
+		if user == "" && u.User != nil {
+			user = u.User.Username()
+		}
+		if password == "" && u.User != nil {
+			password, _ = u.User.Password()
+		}
+		path = strings.TrimPrefix(u.Path, "/")
+	}
+
+	// Build an HTTPS endpoint from the host if one is not explicitly set.
+	if endpoint == "" && host != "" {
+		endpoint = "https://" + host
+	}
+
+	// Ensure required settings are set.
+	if endpoint == "" {
+		return nil, fmt.Errorf("host or endpoint required for webdav replica")
+	}
+
+	// Build replica.
+	client := webdav.NewReplicaClient()
+	client.Endpoint = endpoint
+	client.User = user
+	client.Password = password
+	client.Path = path
+	client.SkipVerify = c.SkipVerify
+	return client, nil
+}
+
+// newHTTPReplicaClientFromConfig returns a new instance of http.ReplicaClient built from config.
+func newHTTPReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *lshttp.ReplicaClient, err error) {
+	// Ensure URL & path are not both specified.
+	if c.URL != "" && c.Path != "" {
+		return nil, fmt.Errorf("cannot specify url & path for http replica")
+	}
+
+	endpoint, path := c.Endpoint, c.Path
+
+	// Split URL into the server endpoint & the database prefix, if specified.
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		path = strings.Trim(u.Path, "/")
+		u.Path, u.RawPath, u.RawQuery, u.Fragment = "", "", "", ""
+		endpoint = u.String()
+	}
+
+	// Ensure required settings are set.
+	if endpoint == "" {
+		return nil, fmt.Errorf("endpoint required for http replica")
+	}
+
+	// Build replica.
+	client := lshttp.NewReplicaClient()
+	client.Endpoint = endpoint
+	client.Path = path
+	client.Token = c.Token
+	client.SkipVerify = c.SkipVerify
+	return client, nil
+}
+
+// newMemReplicaClientFromConfig returns a named memory.ReplicaClient built
+// from config. Replicas referencing the same name share storage within the process.
+func newMemReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *memory.ReplicaClient, err error) {
+	// Ensure URL & path are not both specified.
+	if c.URL != "" && c.Path != "" {
+		return nil, fmt.Errorf("cannot specify url & path for mem replica")
+	}
+
+	// Use the URL host & path as the name, if specified. Otherwise fallback to path.
+	name := c.Path
+	if c.URL != "" {
+		_, host, urlpath, err := ParseReplicaURL(c.URL)
+		if err != nil {
+			return nil, err
+		}
+		name = path.Join(host, urlpath)
+	}
+
+	// Ensure required settings are set.
+	if name == "" {
+		return nil, fmt.Errorf("name required for mem replica")
+	}
+
+	return memory.Named(name), nil
+}
+
+// newSQLiteReplicaClientFromConfig returns a new instance of sqlite.ReplicaClient built from config.
+func newSQLiteReplicaClientFromConfig(c *ReplicaConfig, r *litestream.Replica) (_ *sqlite.ReplicaClient, err error) {
+	// Ensure URL & path are not both specified.
+	if c.URL != "" && c.Path != "" {
+		return nil, fmt.Errorf("cannot specify url & path for sqlite replica")
+	}
+
+	// Parse path from URL, if specified.
+	path := c.Path
+	if c.URL != "" {
+		if _, _, path, err = ParseReplicaURL(c.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Ensure path is set explicitly or derived from URL field.
+	if path == "" {
+		return nil, fmt.Errorf("sqlite replica path required")
+	}
+
+	// Expand home prefix and return absolute path.
+	if path, err = expand(path); err != nil {
+		return nil, err
+	}
+
+	client := sqlite.NewReplicaClient(path)
+	client.Replica = r
 	return client, nil
 }
 
@@ -707,7 +1276,7 @@ func ParseReplicaURL(s string) (scheme, host, urlpath string, err error) {
 	}
 
 	switch u.Scheme {
-	case "file":
+	case "file", "sqlite":
 		scheme, u.Scheme = u.Scheme, ""
 		return scheme, "", path.Clean(u.String()), nil
 
@@ -18,8 +18,12 @@ import (
 	"github.com/benbjohnson/litestream/abs"
 	"github.com/benbjohnson/litestream/file"
 	"github.com/benbjohnson/litestream/gcs"
+	lshttp "github.com/benbjohnson/litestream/http"
+	"github.com/benbjohnson/litestream/memory"
 	"github.com/benbjohnson/litestream/s3"
 	"github.com/benbjohnson/litestream/sftp"
+	"github.com/benbjohnson/litestream/sqlite"
+	"github.com/benbjohnson/litestream/webdav"
 )
 
 // ReplicateCommand represents a command that continuously replicates SQLite databases.
@@ -88,6 +92,9 @@ func (c *ReplicateCommand) Run(ctx context.Context) (err error) {
 	// Display version information.
 	slog.Info("litestream", "version", Version)
 
+	// Apply bandwidth limits before any replica clients are created.
+	c.Config.applyGlobalRateLimits()
+
 	// Setup databases.
 	if len(c.Config.DBs) == 0 {
 		slog.Warn("no databases specified in configuration")
@@ -111,18 +118,25 @@ func (c *ReplicateCommand) Run(ctx context.Context) (err error) {
 		slog.Info("initialized db", "path", db.Path())
 		for _, r := range db.Replicas {
 			slog := slog.With("name", r.Name(), "type", r.Client.Type(), "sync-interval", r.SyncInterval)
-			switch client := r.Client.(type) {
-			case *file.ReplicaClient:
+			if client, ok := litestream.UnwrapClient[*file.ReplicaClient](r.Client); ok {
 				slog.Info("replicating to", "path", client.Path())
-			case *s3.ReplicaClient:
+			} else if client, ok := litestream.UnwrapClient[*s3.ReplicaClient](r.Client); ok {
 				slog.Info("replicating to", "bucket", client.Bucket, "path", client.Path, "region", client.Region, "endpoint", client.Endpoint)
-			case *gcs.ReplicaClient:
+			} else if client, ok := litestream.UnwrapClient[*gcs.ReplicaClient](r.Client); ok {
 				slog.Info("replicating to", "bucket", client.Bucket, "path", client.Path)
-			case *abs.ReplicaClient:
+			} else if client, ok := litestream.UnwrapClient[*abs.ReplicaClient](r.Client); ok {
 				slog.Info("replicating to", "bucket", client.Bucket, "path", client.Path, "endpoint", client.Endpoint)
-			case *sftp.ReplicaClient:
+			} else if client, ok := litestream.UnwrapClient[*sftp.ReplicaClient](r.Client); ok {
 				slog.Info("replicating to", "host", client.Host, "user", client.User, "path", client.Path)
-			default:
+			} else if client, ok := litestream.UnwrapClient[*webdav.ReplicaClient](r.Client); ok {
+				slog.Info("replicating to", "endpoint", client.Endpoint, "user", client.User, "path", client.Path)
+			} else if client, ok := litestream.UnwrapClient[*lshttp.ReplicaClient](r.Client); ok {
+				slog.Info("replicating to", "endpoint", client.Endpoint, "path", client.Path)
+			} else if client, ok := litestream.UnwrapClient[*sqlite.ReplicaClient](r.Client); ok {
+				slog.Info("replicating to", "path", client.Path())
+			} else if client, ok := litestream.UnwrapClient[*memory.ReplicaClient](r.Client); ok {
+				slog.Info("replicating to", "name", client.Name())
+			} else {
 				slog.Info("replicating to")
 			}
 		}
@@ -159,6 +173,11 @@ func (c *ReplicateCommand) Run(ctx context.Context) (err error) {
 				http.Handle("/snapshot", NewSnapshotHandler(ctx, c))
 				start = true
 			}
+			if c.Config.HTTP.Wait {
+				slog.Info("watching for replication wait requests on", "url", fmt.Sprintf("http://%s/wait", hostport))
+				http.Handle("/wait", NewWaitHandler(ctx, c))
+				start = true
+			}
 			if start {
 				if err := http.ListenAndServe(c.Config.HTTP.Addr, nil); err != nil {
 					slog.Error("cannot start the HTTP server", "error", err)
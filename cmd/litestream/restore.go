@@ -113,6 +113,7 @@ func (c *RestoreCommand) loadFromConfig(ctx context.Context, dbPath, configPath
 	if err != nil {
 		return nil, err
 	}
+	config.applyGlobalRateLimits()
 
 	// Lookup database from configuration file by path.
 	if dbPath, err = expand(dbPath); err != nil {
@@ -194,7 +195,9 @@ Arguments:
 	    Returns exit code of 0 if no backups found.
 
 	-parallelism NUM
-	    Determines the number of WAL files downloaded in parallel.
+	    Determines the number of WAL files downloaded in parallel. Also
+	    determines the number of parallel chunks when downloading large
+	    snapshots from replicas that support ranged reads.
 	    Defaults to `+strconv.Itoa(litestream.DefaultRestoreParallelism)+`.
 
 
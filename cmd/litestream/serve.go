@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	lshttp "github.com/benbjohnson/litestream/http"
+)
+
+// ServeShutdownTimeout is the time to wait for in-flight requests on shutdown.
+const ServeShutdownTimeout = 30 * time.Second
+
+// ServeConfig represents the configuration for the "serve" command.
+type ServeConfig struct {
+	// Bind address for the replica protocol.
+	Addr string `yaml:"addr"`
+
+	// Optional TLS certificate & key. Serves plain HTTP if unset.
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+
+	// Tokens allowed to access the server. Authentication is disabled if empty.
+	Tokens []*ServeTokenConfig `yaml:"tokens"`
+
+	// Storage used for received replicas. Each database prefix is stored
+	// under its own path within this replica.
+	Replica *ReplicaConfig `yaml:"replica"`
+}
+
+// ServeTokenConfig represents a bearer token & the database prefixes it can access.
+type ServeTokenConfig struct {
+	Token string   `yaml:"token"`
+	Paths []string `yaml:"paths"`
+}
+
+// ServeCommand represents a command to receive replicas from other
+// Litestream instances over HTTP & store them in a local replica.
+type ServeCommand struct{}
+
+// Run executes the command.
+func (c *ServeCommand) Run(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("litestream-serve", flag.ContinueOnError)
+	configPath, noExpandEnv := registerConfigFlag(fs)
+	addr := fs.String("addr", "", "bind address")
+	fs.Usage = c.Usage
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	if *configPath == "" {
+		*configPath = DefaultConfigPath()
+	}
+	config, err := ReadConfigFile(*configPath, !*noExpandEnv)
+	if err != nil {
+		return err
+	}
+
+	sc := config.Serve
+	if *addr != "" {
+		sc.Addr = *addr
+	}
+
+	// Ensure required settings are set.
+	if sc.Addr == "" {
+		return fmt.Errorf("serve bind address required")
+	} else if sc.Replica == nil {
+		return fmt.Errorf("serve replica required")
+	} else if (sc.CertFile == "") != (sc.KeyFile == "") {
+		return fmt.Errorf("must specify both cert-file & key-file for serve")
+	}
+
+	h, err := NewServeHandler(&sc)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	ln, err := net.Listen("tcp", sc.Addr)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("litestream", "version", Version)
+	slog.Info("serving replicas on", "addr", ln.Addr().String(), "tls", sc.CertFile != "")
+	if len(h.Tokens) == 0 {
+		slog.Warn("no tokens specified in configuration, authentication disabled")
+	}
+
+	server := &http.Server{Handler: h}
+	errCh := make(chan error, 1)
+	go func() {
+		if sc.CertFile != "" {
+			errCh <- server.ServeTLS(ln, sc.CertFile, sc.KeyFile)
+		} else {
+			errCh <- server.Serve(ln)
+		}
+	}()
+
+	// Wait for signal or server error.
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	case <-signalChan():
+		slog.Info("signal received, litestream shutting down")
+	}
+
+	// Gracefully stop the server & close the storage clients.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ServeShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	} else if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	slog.Info("litestream shut down")
+	return nil
+}
+
+// NewServeHandler returns a protocol handler that stores data for each
+// database prefix under the configured replica.
+func NewServeHandler(sc *ServeConfig) (*lshttp.Handler, error) {
+	if sc.Replica == nil {
+		return nil, fmt.Errorf("serve replica required")
+	}
+	rc := *sc.Replica
+
+	h := lshttp.NewHandler(func(prefix string) (litestream.ReplicaClient, error) {
+		return newServeReplicaClient(&rc, prefix)
+	})
+	for _, t := range sc.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("serve token cannot be blank")
+		}
+		h.Tokens = append(h.Tokens, &lshttp.Token{Value: t.Token, Paths: t.Paths})
+	}
+	return h, nil
+}
+
+// newServeReplicaClient returns a client for rc with prefix appended to its path.
+func newServeReplicaClient(rc *ReplicaConfig, prefix string) (litestream.ReplicaClient, error) {
+	other := *rc
+	if other.URL != "" {
+		u, err := url.Parse(other.URL)
+		if err != nil {
+			return nil, err
+		}
+		u.Path = path.Join(u.Path, prefix)
+		other.URL = u.String()
+	} else {
+		other.Path = path.Join(other.Path, prefix)
+	}
+
+	// Keep each prefix's cache separate as cache keys do not include the prefix.
+	if other.Cache != nil {
+		cc := *other.Cache
+		cc.Path = filepath.Join(cc.Path, filepath.FromSlash(prefix))
+		other.Cache = &cc
+	}
+
+	r, err := NewReplicaFromConfig(&other, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.Client, nil
+}
+
+// Usage prints the help screen to STDOUT.
+func (c *ServeCommand) Usage() {
+	fmt.Printf(`
+The serve command starts a server that receives replicas from other Litestream
+instances over HTTP and stores them in the replica specified by the "serve"
+section of the configuration file. Each database is stored under the path
+prefix used in its replica URL (e.g. https://HOST:PORT/PREFIX).
+
+Usage:
+
+	litestream serve [arguments]
+
+Arguments:
+
+	-addr BIND_ADDR
+	    Overrides the bind address in the configuration file.
+
+	-config PATH
+	    Specifies the configuration file.
+	    Defaults to %s
+
+	-no-expand-env
+	    Disables environment variable expansion in configuration file.
+
+`[1:],
+		DefaultConfigPath(),
+	)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// WaitRequest is the body of a request to wait for replication. If Position
+// is nil then the database is synced and its current position is used.
+type WaitRequest struct {
+	DatabasePath string        `json:"database-path"`
+	ReplicaNames []string      `json:"replica-names"`
+	Position     *WaitPosition `json:"position"`
+	Timeout      string        `json:"timeout"`
+}
+
+// WaitPosition is the JSON representation of a WAL position.
+type WaitPosition struct {
+	Generation string `json:"generation"`
+	Index      int    `json:"index"`
+	Offset     int64  `json:"offset"`
+}
+
+type WaitResponse struct {
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Position *WaitPosition `json:"position,omitempty"`
+}
+
+// WaitHandler blocks until a database position has reached its replicas.
+type WaitHandler struct {
+	// Context to execute syncs in
+	ctx context.Context
+
+	// The command running the replication process
+	c *ReplicateCommand
+
+	// Where to send log messages, defaults to log.Default()
+	Logger *slog.Logger
+}
+
+func NewWaitHandler(ctx context.Context, c *ReplicateCommand) *WaitHandler {
+	return &WaitHandler{
+		ctx:    ctx,
+		c:      c,
+		Logger: slog.Default(),
+	}
+}
+
+func (h *WaitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.c == nil {
+		h.writeResponse(w, 500, WaitResponse{Status: "error", Error: "wait handler has not been initialized properly (ReplicateCommand is nil)"})
+		return
+	}
+
+	// Check if the request is a POST
+	if r.Method != "POST" {
+		h.writeResponse(w, 405, WaitResponse{Status: "error", Error: "method not allowed"})
+		return
+	}
+
+	// Parse request
+	var req WaitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeResponse(w, 400, WaitResponse{Status: "error", Error: "invalid request"})
+		return
+	}
+
+	var timeout time.Duration
+	if req.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(req.Timeout); err != nil || timeout <= 0 {
+			h.writeResponse(w, 400, WaitResponse{Status: "error", Error: "invalid timeout"})
+			return
+		}
+	}
+
+	// Check if the requested database is being replicated
+	var db *litestream.DB
+	for _, cdb := range h.c.DBs {
+		if cdb.Path() == req.DatabasePath {
+			db = cdb
+			break
+		}
+	}
+
+	if db == nil {
+		h.writeResponse(w, 404, WaitResponse{Status: "error", Error: fmt.Sprintf("database %s not found", req.DatabasePath)})
+		return
+	}
+
+	for _, name := range req.ReplicaNames {
+		if db.Replica(name) == nil {
+			h.writeResponse(w, 404, WaitResponse{Status: "error", Error: fmt.Sprintf("replica %s for database %s not found", name, req.DatabasePath)})
+			return
+		}
+	}
+
+	// Determine the position to wait for. This is bounded by the request
+	// context so waits are cancelled if the client disconnects.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	stop := context.AfterFunc(h.ctx, cancel)
+	defer stop()
+
+	var pos litestream.Pos
+	if req.Position != nil {
+		pos = litestream.Pos{Generation: req.Position.Generation, Index: req.Position.Index, Offset: req.Position.Offset}
+	} else {
+		var err error
+		if pos, err = db.SyncPos(ctx); errors.Is(err, litestream.ErrShadowWALThrottled) {
+			h.writeResponse(w, 503, WaitResponse{Status: "error", Error: fmt.Sprintf("cannot determine position of database %s: %s", req.DatabasePath, err)})
+			return
+		} else if err != nil {
+			h.writeResponse(w, 500, WaitResponse{Status: "error", Error: fmt.Sprintf("error issuing sync on database %s: %s", req.DatabasePath, err)})
+			return
+		}
+	}
+	res := WaitResponse{Position: &WaitPosition{Generation: pos.Generation, Index: pos.Index, Offset: pos.Offset}}
+
+	h.Logger.Debug("waiting for replication", "db", req.DatabasePath, "position", pos.String())
+	if err := db.WaitReplicated(ctx, pos, req.ReplicaNames...); errors.Is(err, context.DeadlineExceeded) {
+		res.Status, res.Error = "timeout", err.Error()
+		h.writeResponse(w, 504, res)
+		return
+	} else if errors.Is(err, litestream.ErrGenerationChanged) {
+		res.Status, res.Error = "error", err.Error()
+		h.writeResponse(w, 409, res)
+		return
+	} else if err != nil {
+		res.Status, res.Error = "error", err.Error()
+		h.writeResponse(w, 500, res)
+		return
+	}
+
+	res.Status = "ok"
+	h.writeResponse(w, 200, res)
+}
+
+func (h *WaitHandler) writeResponse(w http.ResponseWriter, code int, res WaitResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,183 @@
+package main_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	main "github.com/benbjohnson/litestream/cmd/litestream"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestWaitHandler(t *testing.T) {
+	// Ensure the current position is returned once it reaches the replica.
+	t.Run("OK", func(t *testing.T) {
+		db, sqldb, r := mustOpenWaitDB(t)
+		mustExecSync(t, db, sqldb, `CREATE TABLE foo (bar TEXT)`)
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		code, res := mustServeWait(t, db, main.WaitRequest{DatabasePath: db.Path(), Timeout: "1s"})
+		if got, want := code, http.StatusOK; got != want {
+			t.Fatalf("code=%d, want %d", got, want)
+		} else if got, want := res.Status, "ok"; got != want {
+			t.Fatalf("status=%q, want %q", got, want)
+		} else if pos := r.Pos(); res.Position == nil || *res.Position != (main.WaitPosition{Generation: pos.Generation, Index: pos.Index, Offset: pos.Offset}) {
+			t.Fatalf("position=%+v, want %s", res.Position, pos)
+		}
+	})
+
+	// Ensure a timeout is reported if the replica does not reach the position.
+	t.Run("Timeout", func(t *testing.T) {
+		db, sqldb, r := mustOpenWaitDB(t)
+		mustExecSync(t, db, sqldb, `CREATE TABLE foo (bar TEXT)`)
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		mustExecSync(t, db, sqldb, `INSERT INTO foo (bar) VALUES ('a')`)
+
+		code, res := mustServeWait(t, db, main.WaitRequest{DatabasePath: db.Path(), Timeout: "10ms"})
+		if got, want := code, http.StatusGatewayTimeout; got != want {
+			t.Fatalf("code=%d, want %d", got, want)
+		} else if got, want := res.Status, "timeout"; got != want {
+			t.Fatalf("status=%q, want %q", got, want)
+		} else if res.Position == nil || res.Position.Offset <= r.Pos().Offset {
+			t.Fatalf("unexpected position: %+v", res.Position)
+		}
+	})
+
+	t.Run("ErrInvalidPosition", func(t *testing.T) {
+		db, _, _ := mustOpenWaitDB(t)
+
+		body := `{"database-path":` + strconv.Quote(db.Path()) + `,"position":"foo"}`
+		if code, res := mustServeWaitBody(t, db, body); code != http.StatusBadRequest {
+			t.Fatalf("code=%d, want %d", code, http.StatusBadRequest)
+		} else if got, want := res.Error, "invalid request"; got != want {
+			t.Fatalf("error=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrInvalidTimeout", func(t *testing.T) {
+		db, _, _ := mustOpenWaitDB(t)
+
+		if code, res := mustServeWait(t, db, main.WaitRequest{DatabasePath: db.Path(), Timeout: "-1s"}); code != http.StatusBadRequest {
+			t.Fatalf("code=%d, want %d", code, http.StatusBadRequest)
+		} else if got, want := res.Error, "invalid timeout"; got != want {
+			t.Fatalf("error=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrDatabaseNotFound", func(t *testing.T) {
+		db, _, _ := mustOpenWaitDB(t)
+
+		if code, res := mustServeWait(t, db, main.WaitRequest{DatabasePath: "/no/such/db"}); code != http.StatusNotFound {
+			t.Fatalf("code=%d, want %d", code, http.StatusNotFound)
+		} else if got, want := res.Error, "database /no/such/db not found"; got != want {
+			t.Fatalf("error=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrReplicaNotFound", func(t *testing.T) {
+		db, _, _ := mustOpenWaitDB(t)
+
+		if code, _ := mustServeWait(t, db, main.WaitRequest{DatabasePath: db.Path(), ReplicaNames: []string{"foo"}}); code != http.StatusNotFound {
+			t.Fatalf("code=%d, want %d", code, http.StatusNotFound)
+		}
+	})
+
+	// Ensure a sync position is not reported while new frames are held in
+	// the real WAL by the throttle policy.
+	t.Run("ErrThrottled", func(t *testing.T) {
+		db, sqldb, r := mustOpenWaitDB(t)
+		db.MaxShadowWALSize, db.ShadowWALPolicy = 16<<10, litestream.ShadowWALPolicyThrottle
+		mustExecSync(t, db, sqldb, `CREATE TABLE foo (bar BLOB)`)
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			mustExecSync(t, db, sqldb, `INSERT INTO foo (bar) VALUES (randomblob(1000))`)
+		}
+
+		code, res := mustServeWait(t, db, main.WaitRequest{DatabasePath: db.Path(), Timeout: "1s"})
+		if got, want := code, http.StatusServiceUnavailable; got != want {
+			t.Fatalf("code=%d, want %d", got, want)
+		} else if got, want := res.Status, "error"; got != want {
+			t.Fatalf("status=%q, want %q", got, want)
+		}
+	})
+}
+
+// mustOpenWaitDB returns a database replicating to an in-memory client. The
+// replica is not started so tests control when it syncs.
+func mustOpenWaitDB(tb testing.TB) (*litestream.DB, *sql.DB, *litestream.Replica) {
+	tb.Helper()
+
+	db := litestream.NewDB(filepath.Join(tb.TempDir(), "db"))
+	db.MonitorInterval = 0
+	if err := db.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = db.Close(context.Background()) })
+
+	r := litestream.NewReplica(db, "mem")
+	r.Client = memory.NewReplicaClient()
+	db.Replicas = []*litestream.Replica{r}
+
+	sqldb, err := sql.Open("sqlite3", db.Path())
+	if err != nil {
+		tb.Fatal(err)
+	} else if _, err := sqldb.Exec(`PRAGMA journal_mode = wal;`); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = sqldb.Close() })
+
+	return db, sqldb, r
+}
+
+// mustExecSync executes query against sqldb & syncs db.
+func mustExecSync(tb testing.TB, db *litestream.DB, sqldb *sql.DB, query string) {
+	tb.Helper()
+	if _, err := sqldb.Exec(query); err != nil {
+		tb.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// mustServeWait sends req to a wait handler for db & returns the response.
+func mustServeWait(tb testing.TB, db *litestream.DB, req main.WaitRequest) (int, main.WaitResponse) {
+	tb.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return mustServeWaitBody(tb, db, string(body))
+}
+
+// mustServeWaitBody sends a raw request body to a wait handler for db &
+// returns the response.
+func mustServeWaitBody(tb testing.TB, db *litestream.DB, body string) (int, main.WaitResponse) {
+	tb.Helper()
+
+	c := main.NewReplicateCommand()
+	c.DBs = []*litestream.DB{db}
+	h := main.NewWaitHandler(context.Background(), c)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/wait", strings.NewReader(body)))
+
+	var res main.WaitResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		tb.Fatal(err)
+	}
+	return w.Code, res
+}
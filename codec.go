@@ -0,0 +1,186 @@
+package litestream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Compression codecs for snapshots & WAL segments.
+//
+// Object names keep their historical ".lz4" extension regardless of codec.
+// The codec is instead identified by the frame magic number at the start of
+// each object so a replica may contain a mix of codecs and restores can read
+// them transparently.
+const (
+	CodecLZ4  = "lz4"
+	CodecZstd = "zstd"
+	CodecNone = "none"
+)
+
+// DefaultCodec is the codec used by replicas unless otherwise configured.
+const DefaultCodec = CodecLZ4
+
+// Frame magic numbers used to detect the codec of an object.
+var (
+	lz4Magic  = []byte{0x04, 0x22, 0x4d, 0x18}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ValidateCodec returns an error if codec is unknown or level is out of
+// range for the codec. A level of zero uses the codec's default level.
+func ValidateCodec(codec string, level int) error {
+	switch codec {
+	case "", CodecLZ4, CodecNone:
+		if level != 0 {
+			return fmt.Errorf("compression level not supported by %q codec", codecOrDefault(codec))
+		}
+		return nil
+	case CodecZstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("invalid zstd compression level: %d", level)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown compression codec: %q", codec)
+	}
+}
+
+func codecOrDefault(codec string) string {
+	if codec == "" {
+		return DefaultCodec
+	}
+	return codec
+}
+
+// newCompressor returns a writer that compresses data to w using codec.
+// Closing the returned writer flushes the frame but does not close w.
+func newCompressor(w io.Writer, codec string, level int) (io.WriteCloser, error) {
+	if err := ValidateCodec(codec, level); err != nil {
+		return nil, err
+	}
+
+	switch codecOrDefault(codec) {
+	case CodecZstd:
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	case CodecNone:
+		return &rawZstdWriter{w: w}, nil
+	default:
+		return lz4.NewWriter(w), nil
+	}
+}
+
+// newDecompressor returns a reader that decompresses rd. The codec is
+// detected from the frame magic number. Closing the returned reader releases
+// decoder resources but does not close rd.
+func newDecompressor(rd io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(rd)
+	magic, err := br.Peek(4)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("cannot detect compression codec: %w", io.ErrUnexpectedEOF)
+	} else if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(magic, lz4Magic):
+		return io.NopCloser(lz4.NewReader(br)), nil
+	case bytes.Equal(magic, zstdMagic):
+		dec, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression codec: magic=%x", magic)
+	}
+}
+
+// rawZstdBlockSize is the maximum size of a raw zstd block.
+const rawZstdBlockSize = 128 << 10
+
+// rawZstdWriter writes data uncompressed as a zstd frame made up of raw
+// blocks. This keeps uncompressed objects identifiable by their magic number
+// and readable with standard zstd tooling.
+type rawZstdWriter struct {
+	w    io.Writer
+	buf  []byte
+	init bool
+	err  error
+}
+
+// Write buffers p and writes out any full blocks. The final block is held
+// back until Close so it can be marked as the last block of the frame.
+func (w *rawZstdWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	} else if err := w.writeHeader(); err != nil {
+		return 0, err
+	}
+
+	w.buf = append(w.buf, p...)
+	for len(w.buf) > rawZstdBlockSize {
+		if err := w.writeBlock(w.buf[:rawZstdBlockSize], false); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[rawZstdBlockSize:]
+	}
+	return len(p), nil
+}
+
+// Close writes the remaining data as the last block of the frame.
+func (w *rawZstdWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	} else if err := w.writeHeader(); err != nil {
+		return err
+	} else if err := w.writeBlock(w.buf, true); err != nil {
+		return err
+	}
+	w.buf, w.err = nil, errors.New("zstd writer closed")
+	return nil
+}
+
+// writeHeader writes the frame header with a 128KB window, no content size
+// and no checksum. Only written once.
+func (w *rawZstdWriter) writeHeader() error {
+	if w.init {
+		return nil
+	}
+	w.init = true
+
+	hdr := append(append([]byte{}, zstdMagic...), 0x00, 0x38)
+	if _, err := w.w.Write(hdr); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+func (w *rawZstdWriter) writeBlock(data []byte, last bool) error {
+	var v uint32 = uint32(len(data)) << 3 // raw block type is zero
+	if last {
+		v |= 1
+	}
+
+	var hdr [4]byte
+	binary.LittleEndian.PutUint32(hdr[:], v)
+	if _, err := w.w.Write(hdr[:3]); err != nil {
+		w.err = err
+		return err
+	} else if _, err := w.w.Write(data); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package litestream_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestValidateCodec(t *testing.T) {
+	for _, tt := range []struct {
+		codec string
+		level int
+		err   string
+	}{
+		{codec: ""},
+		{codec: "lz4"},
+		{codec: "none"},
+		{codec: "zstd"},
+		{codec: "zstd", level: 19},
+		{codec: "zstd", level: 23, err: `invalid zstd compression level: 23`},
+		{codec: "lz4", level: 1, err: `compression level not supported by "lz4" codec`},
+		{codec: "gzip", err: `unknown compression codec: "gzip"`},
+	} {
+		err := litestream.ValidateCodec(tt.codec, tt.level)
+		if tt.err == "" && err != nil {
+			t.Fatalf("%s/%d: unexpected error: %s", tt.codec, tt.level, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Fatalf("%s/%d: unexpected error: %v", tt.codec, tt.level, err)
+		}
+	}
+}
+
+// Ensure a replica written with a different codec for each object can be
+// restored in full.
+func TestReplica_Restore_MixedCodecs(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	c := memory.NewReplicaClient()
+	r := litestream.NewReplica(db, "")
+	r.Client = c
+
+	// Large uncompressed snapshot spanning several raw blocks.
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar BLOB);`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r.Codec = litestream.CodecNone
+	if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+		t.Fatal(err)
+	}
+	info, err := r.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertObjectMagic(t, c.SnapshotReader, info.Generation, info.Index, []byte{0x28, 0xb5, 0x2f, 0xfd})
+
+	// Follow with WAL segments written using zstd & then lz4.
+	for _, codec := range []string{litestream.CodecZstd, litestream.CodecLZ4} {
+		r.Codec = codec
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var want string
+	if err := sqldb.QueryRow(`SELECT hex(group_concat(bar)) FROM foo`).Scan(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := litestream.NewReplica(nil, "")
+	rr.Client = c
+
+	opt := litestream.NewRestoreOptions()
+	opt.OutputPath = filepath.Join(t.TempDir(), "db")
+	generation, _, err := rr.CalcRestoreTarget(context.Background(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt.Generation = generation
+	if err := rr.Restore(context.Background(), opt); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := MustOpenSQLDB(t, opt.OutputPath)
+	defer MustCloseSQLDB(t, restored)
+
+	var got string
+	if err := restored.QueryRow(`SELECT hex(group_concat(bar)) FROM foo`).Scan(&got); err != nil {
+		t.Fatal(err)
+	} else if got != want {
+		t.Fatal("restored data mismatch")
+	}
+}
+
+// Ensure an invalid codec is reported when writing a snapshot.
+func TestReplica_Snapshot_ErrUnknownCodec(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	r := litestream.NewReplica(db, "")
+	r.Client = memory.NewReplicaClient()
+	r.Codec = "gzip"
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if _, err := r.Snapshot(context.Background()); err == nil || err.Error() != `unknown compression codec: "gzip"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func assertObjectMagic(tb testing.TB, fn func(context.Context, string, int) (io.ReadCloser, error), generation string, index int, magic []byte) {
+	tb.Helper()
+
+	rc, err := fn(context.Background(), generation, index)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf := make([]byte, len(magic))
+	if _, err := io.ReadFull(rc, buf); err != nil {
+		tb.Fatal(err)
+	} else if !bytes.Equal(buf, magic) {
+		tb.Fatalf("magic=%x, want %x", buf, magic)
+	}
+}
@@ -0,0 +1,194 @@
+package litestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"filippo.io/age"
+)
+
+// CompactWAL merges the WAL segments of each WAL index in a generation into a
+// single segment & deletes the originals. Only indexes with at least
+// minSegments segments are compacted. The latest index is skipped as it may
+// still be written to. Returns the number of segments removed.
+//
+// The merged segment replaces the first segment of the index so it is written
+// at the time of compaction. Timestamp-based restores treat the index as
+// written at that time.
+//
+// The writer lease is renewed before each index is compacted, if enabled, so
+// compaction does not race another writer replacing the same segments.
+func (r *Replica) CompactWAL(ctx context.Context, generation string, minSegments int) (n int, err error) {
+	if minSegments < 2 {
+		minSegments = 2
+	}
+
+	// Existing segments must be decrypted to be merged.
+	if len(r.AgeRecipients) > 0 && len(r.AgeIdentities) == 0 {
+		return 0, fmt.Errorf("age identities required to compact encrypted wal segments")
+	}
+
+	itr, err := r.Client.WALSegments(ctx, generation)
+	if err != nil {
+		return 0, fmt.Errorf("fetch wal segments: %w", err)
+	}
+	infos, err := SliceWALSegmentIterator(itr)
+	if err != nil {
+		return 0, err
+	}
+	sort.Sort(WALSegmentInfoSlice(infos))
+
+	for len(infos) > 0 {
+		// Split off the segments for the next index.
+		i := 1
+		for i < len(infos) && infos[i].Index == infos[0].Index {
+			i++
+		}
+		segments := infos[:i]
+		if infos = infos[i:]; len(infos) == 0 {
+			break // latest index
+		} else if len(segments) < minSegments {
+			continue
+		}
+
+		if err := r.renewLease(ctx); err != nil {
+			return n, fmt.Errorf("lease: %w", err)
+		} else if err := r.compactWALIndex(ctx, segments); err != nil {
+			return n, fmt.Errorf("compact wal %s/%08x: %w", generation, segments[0].Index, err)
+		}
+		n += len(segments) - 1
+	}
+	return n, nil
+}
+
+// compactWALIndex writes the contents of segments as a single segment at the
+// position of the first segment & deletes the remaining segments. Clients
+// replace the first segment atomically so a failed write leaves the original
+// segments intact, and the remaining segments are only deleted once the
+// merged segment has been written.
+func (r *Replica) compactWALIndex(ctx context.Context, segments []WALSegmentInfo) (err error) {
+	pos := segments[0].Pos()
+	offsets := make([]int64, len(segments))
+	for i := range segments {
+		offsets[i] = segments[i].Offset
+	}
+
+	startTime := time.Now()
+
+	// Read every source segment before writing as the merged segment replaces
+	// the first one & some clients truncate the target when it is opened.
+	sp := r.newCompactionSpool()
+	defer sp.Close()
+
+	if err := r.encodeWALSegments(ctx, sp, pos.Generation, pos.Index, offsets); err != nil {
+		return err
+	}
+
+	info, err := r.Client.WriteWALSegment(ctx, pos, sp.Reader())
+	if err != nil {
+		return err
+	}
+
+	// Delete the segments that were merged. Restores ignore the overlap if
+	// compaction is interrupted before this completes.
+	a := make([]Pos, 0, len(segments)-1)
+	for _, info := range segments[1:] {
+		a = append(a, info.Pos())
+	}
+	if err := r.Client.DeleteWALSegments(ctx, a); err != nil {
+		return fmt.Errorf("delete wal segments: %w", err)
+	}
+
+	r.Logger().Info("wal segments compacted", "position", pos.String(), "n", len(segments), "elapsed", time.Since(startTime).String(), "sz", info.Size)
+	return nil
+}
+
+// newCompactionSpool returns a spool for merged segments. Data is spooled to
+// the database's meta directory or, for replicas without a database, the
+// system temporary directory.
+func (r *Replica) newCompactionSpool() *spool {
+	if r.db == nil {
+		return newSpool(os.TempDir(), nil)
+	}
+	return newSpool(filepath.Join(r.db.MetaPath(), "spool"), r.db.dirInfo)
+}
+
+// encodeWALSegments writes the contents of the segments at offsets to w,
+// compressed & encrypted.
+func (r *Replica) encodeWALSegments(ctx context.Context, w io.Writer, generation string, index int, offsets []int64) (err error) {
+	var ew io.WriteCloser = nopWriteCloser{w}
+
+	// Add encryption if we have recipients.
+	if len(r.AgeRecipients) > 0 {
+		if ew, err = age.Encrypt(w, r.AgeRecipients...); err != nil {
+			return err
+		}
+		defer ew.Close()
+	}
+
+	zw, err := newCompressor(ew, r.Codec, r.CompressionLevel)
+	if err != nil {
+		return err
+	}
+	defer zw.Close()
+
+	if _, err := r.copyWALSegments(ctx, zw, generation, index, offsets); err != nil {
+		return err
+	} else if err := zw.Close(); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// copyWALSegments writes the decrypted & decompressed contents of the
+// segments at offsets to w, in order. Data that overlaps a previous segment,
+// such as from an interrupted compaction, is skipped. Returns the number of
+// bytes written.
+func (r *Replica) copyWALSegments(ctx context.Context, w io.Writer, generation string, index int, offsets []int64) (int64, error) {
+	if len(offsets) == 0 {
+		return 0, nil
+	}
+
+	// Hide io.ReaderFrom as the lz4 writer only supports a single ReadFrom().
+	w = struct{ io.Writer }{w}
+
+	end := offsets[0]
+	for _, offset := range offsets {
+		if offset > end {
+			return end - offsets[0], fmt.Errorf("wal segment gap: generation=%s index=%08x offset=%d, expected %d", generation, index, offset, end)
+		}
+
+		if err := func() error {
+			rd, err := r.openWALSegment(ctx, Pos{Generation: generation, Index: index, Offset: offset})
+			if err != nil {
+				return err
+			}
+			defer rd.Close()
+
+			// Skip data already written by a previous, overlapping segment.
+			if skip := end - offset; skip > 0 {
+				if _, err := io.CopyN(io.Discard, rd, skip); errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+
+			n, err := io.Copy(w, rd)
+			end += n
+			if err != nil {
+				return err
+			}
+			return rd.Close()
+		}(); err != nil {
+			return end - offsets[0], err
+		}
+	}
+	return end - offsets[0], nil
+}
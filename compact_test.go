@@ -0,0 +1,187 @@
+package litestream_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestReplica_CompactWAL(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := memory.NewReplicaClient()
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+		generation := mustCompactSetup(t, db, sqldb, r)
+
+		before := mustWALSegmentInfos(t, c, generation)
+		if n, err := r.CompactWAL(context.Background(), generation, 0); err != nil {
+			t.Fatal(err)
+		} else if n == 0 {
+			t.Fatal("expected segments to be removed")
+		} else if got, want := len(mustWALSegmentInfos(t, c, generation)), len(before)-n; got != want {
+			t.Fatalf("len(segments)=%d, want %d", got, want)
+		}
+
+		// Only the latest index has more than one segment.
+		counts := make(map[int]int)
+		latest := before[len(before)-1].Index
+		for _, info := range mustWALSegmentInfos(t, c, generation) {
+			if counts[info.Index]++; info.Index != latest && counts[info.Index] > 1 {
+				t.Fatalf("index %08x not compacted", info.Index)
+			}
+		}
+		if counts[latest] < 2 {
+			t.Fatal("latest index compacted")
+		}
+
+		mustRestoreMatches(t, sqldb, c)
+	})
+
+	// Ensure restores skip segments left behind by an interrupted compaction.
+	t.Run("Interrupted", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := memory.NewReplicaClient()
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+		generation := mustCompactSetup(t, db, sqldb, r)
+
+		// Save a segment that will be merged into the one before it.
+		infos := mustWALSegmentInfos(t, c, generation)
+		var info litestream.WALSegmentInfo
+		for i := 1; i < len(infos); i++ {
+			if infos[i].Index == infos[i-1].Index {
+				info = infos[i]
+				break
+			}
+		}
+		data := mustReadWALSegment(t, c, info.Pos())
+
+		if _, err := r.CompactWAL(context.Background(), generation, 0); err != nil {
+			t.Fatal(err)
+		} else if _, err := c.WriteWALSegment(context.Background(), info.Pos(), bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		pos := litestream.Pos{Generation: generation, Index: info.Index}
+		merged := mustReadWALSegment(t, c, pos)
+
+		mustRestoreMatches(t, sqldb, c)
+
+		// Compacting again skips the overlapping data.
+		if n, err := r.CompactWAL(context.Background(), generation, 0); err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Fatalf("n=%d, want 1", n)
+		} else if !bytes.Equal(mustReadWALSegment(t, c, pos), merged) {
+			t.Fatal("merged segment mismatch")
+		}
+	})
+
+	// Ensure source segments are read before the merged segment overwrites
+	// the first one on clients that truncate objects when opened for writing.
+	t.Run("TruncateOnWrite", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := &truncatingReplicaClient{ReplicaClient: memory.NewReplicaClient()}
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+		generation := mustCompactSetup(t, db, sqldb, r)
+
+		if n, err := r.CompactWAL(context.Background(), generation, 0); err != nil {
+			t.Fatal(err)
+		} else if n == 0 {
+			t.Fatal("expected segments to be removed")
+		}
+		mustRestoreMatches(t, sqldb, c)
+	})
+
+	// Ensure segments are not compacted while another writer holds the lease.
+	t.Run("ErrLeaseHeld", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := memory.NewReplicaClient()
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+		generation := mustCompactSetup(t, db, sqldb, r)
+		before := mustWALSegmentInfos(t, c, generation)
+
+		if err := newLeaseReplica(c, "host-a").AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		}
+		r.LeaseTimeout, r.LeaseHolder = time.Minute, "host-b"
+		if _, err := r.CompactWAL(context.Background(), generation, 0); !errors.Is(err, litestream.ErrLeaseHeld) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := len(mustWALSegmentInfos(t, c, generation)), len(before); got != want {
+			t.Fatalf("len(segments)=%d, want %d", got, want)
+		}
+	})
+}
+
+// truncatingReplicaClient empties an existing WAL segment before reading the
+// data to write, like clients that open the target with O_TRUNC.
+type truncatingReplicaClient struct {
+	*memory.ReplicaClient
+}
+
+func (c *truncatingReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (litestream.WALSegmentInfo, error) {
+	if _, err := c.ReplicaClient.WriteWALSegment(ctx, pos, bytes.NewReader(nil)); err != nil {
+		return litestream.WALSegmentInfo{}, err
+	}
+	return c.ReplicaClient.WriteWALSegment(ctx, pos, rd)
+}
+
+// mustCompactSetup writes several WAL segments to two WAL indexes & returns
+// the generation.
+func mustCompactSetup(tb testing.TB, db *litestream.DB, sqldb *sql.DB, r *litestream.Replica) string {
+	tb.Helper()
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar BLOB);`); err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+				tb.Fatal(err)
+			} else if err := db.Sync(context.Background()); err != nil {
+				tb.Fatal(err)
+			} else if err := r.Sync(context.Background()); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		if i == 0 {
+			if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return r.Pos().Generation
+}
+
+func mustWALSegmentInfos(tb testing.TB, c litestream.ReplicaClient, generation string) []litestream.WALSegmentInfo {
+	tb.Helper()
+
+	itr, err := c.WALSegments(context.Background(), generation)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	infos, err := litestream.SliceWALSegmentIterator(itr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sort.Sort(litestream.WALSegmentInfoSlice(infos))
+	return infos
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/benbjohnson/litestream/internal"
 )
@@ -28,12 +29,40 @@ import (
 // Default DB settings.
 const (
 	DefaultMonitorInterval    = 1 * time.Second
+	DefaultMonitorDebounce    = 10 * time.Millisecond
 	DefaultCheckpointInterval = 1 * time.Minute
 	DefaultMinCheckpointPageN = 1000
 	DefaultMaxCheckpointPageN = 10000
 	DefaultTruncatePageN      = 500000
 )
 
+// Monitor modes.
+const (
+	// MonitorModePoll checks the WAL for changes every MonitorInterval.
+	MonitorModePoll = "poll"
+
+	// MonitorModeInotify syncs when the WAL changes on disk, with polling
+	// every MonitorInterval as a fallback. Only supported on Linux.
+	MonitorModeInotify = "inotify"
+)
+
+// Shadow WAL size policies. Applied when the shadow WAL retained for a
+// lagging replica exceeds MaxShadowWALSize.
+const (
+	// ShadowWALPolicyAlert logs a warning but retains the shadow WAL.
+	ShadowWALPolicyAlert = "alert"
+
+	// ShadowWALPolicyDrop releases the shadow WAL retained for the most
+	// lagging replicas. Dropped replicas write a new snapshot on their next
+	// successful sync.
+	ShadowWALPolicyDrop = "drop"
+
+	// ShadowWALPolicyThrottle stops copying new WAL frames to the shadow WAL
+	// & suspends checkpoints until replicas catch up. New changes are held
+	// in the database's WAL in the meantime.
+	ShadowWALPolicyThrottle = "throttle"
+)
+
 // MaxIndex is the maximum possible WAL index.
 // If this index is reached then a new generation will be started.
 const MaxIndex = 0x7FFFFFFF
@@ -56,6 +85,15 @@ type DB struct {
 	fileInfo os.FileInfo // db info cached during init
 	dirInfo  os.FileInfo // parent dir info cached during init
 
+	clearedPos    Pos    // last position of generation cleared during init
+	clearedReason string // reason the generation was cleared
+
+	shadowWALOver bool // shadow WAL exceeded MaxShadowWALSize on last clean
+	throttled     bool // last sync left new frames in the real WAL
+
+	sharedMu sync.Mutex               // protects shared
+	shared   map[string]*sharedObject // encoded objects shared by replicas
+
 	ctx    context.Context
 	cancel func()
 	wg     sync.WaitGroup
@@ -104,6 +142,21 @@ type DB struct {
 	// Frequency at which to perform db sync.
 	MonitorInterval time.Duration
 
+	// Maximum number of shadow WAL bytes retained for a replica that has not
+	// yet replicated them, before ShadowWALPolicy is applied. Disabled if zero.
+	MaxShadowWALSize int64
+
+	// Determines what happens when the shadow WAL exceeds MaxShadowWALSize.
+	// See the ShadowWALPolicy constants. Defaults to ShadowWALPolicyAlert.
+	ShadowWALPolicy string
+
+	// Determines how WAL changes are detected. Defaults to MonitorModePoll.
+	MonitorMode string
+
+	// Time to wait after a WAL change is detected before syncing so that
+	// bursts of writes are coalesced. Only used by MonitorModeInotify.
+	MonitorDebounce time.Duration
+
 	// List of replicas for the database.
 	// Must be set before calling Open().
 	Replicas []*Replica
@@ -126,6 +179,9 @@ func NewDB(path string) *DB {
 		TruncatePageN:      DefaultTruncatePageN,
 		CheckpointInterval: DefaultCheckpointInterval,
 		MonitorInterval:    DefaultMonitorInterval,
+		MonitorMode:        MonitorModePoll,
+		MonitorDebounce:    DefaultMonitorDebounce,
+		ShadowWALPolicy:    ShadowWALPolicyAlert,
 		Logger:             slog.With("db", path),
 	}
 
@@ -278,6 +334,57 @@ func (db *DB) Pos() (Pos, error) {
 	return Pos{Generation: generation, Index: index, Offset: frameAlign(fi.Size(), db.pageSize)}, nil
 }
 
+// SyncPos syncs the database to the shadow WAL & returns the current position.
+// The position includes all transactions committed before the call and can
+// be passed to WaitReplicated() to wait until they reach the replicas.
+//
+// Returns ErrShadowWALThrottled if the sync did not copy all frames from the
+// real WAL as the shadow WAL position would not include them.
+func (db *DB) SyncPos(ctx context.Context) (Pos, error) {
+	if err := db.Sync(ctx); err != nil {
+		return Pos{}, err
+	}
+
+	db.mu.RLock()
+	throttled := db.throttled
+	db.mu.RUnlock()
+	if throttled {
+		return Pos{}, ErrShadowWALThrottled
+	}
+	return db.Pos()
+}
+
+// WaitReplicated blocks until the named replicas have replicated up to at
+// least pos. Waits on all replicas if no names are specified.
+func (db *DB) WaitReplicated(ctx context.Context, pos Pos, replicaNames ...string) error {
+	replicas := db.Replicas
+	if len(replicaNames) > 0 {
+		replicas = make([]*Replica, 0, len(replicaNames))
+		for _, name := range replicaNames {
+			r := db.Replica(name)
+			if r == nil {
+				return fmt.Errorf("replica not found: %q", name)
+			}
+			replicas = append(replicas, r)
+		}
+	}
+	if len(replicas) == 0 {
+		return fmt.Errorf("no replicas to wait on")
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, r := range replicas {
+		r := r
+		g.Go(func() error {
+			if err := r.WaitPos(ctx, pos); err != nil {
+				return fmt.Errorf("replica %q: %w", r.Name(), err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
 // Notify returns a channel that closes when the shadow WAL changes.
 func (db *DB) Notify() <-chan struct{} {
 	db.mu.RLock()
@@ -301,6 +408,11 @@ func (db *DB) Open() (err error) {
 	if db.MinCheckpointPageN <= 0 {
 		return fmt.Errorf("minimum checkpoint page count required")
 	}
+	switch db.MonitorMode {
+	case "", MonitorModePoll, MonitorModeInotify:
+	default:
+		return fmt.Errorf("invalid monitor mode: %q", db.MonitorMode)
+	}
 
 	// Validate that all replica names are unique.
 	m := make(map[string]struct{})
@@ -316,10 +428,23 @@ func (db *DB) Open() (err error) {
 		return fmt.Errorf("cannot remove tmp files: %w", err)
 	}
 
+	// Shared objects spooled before a crash are never reused.
+	if err := os.RemoveAll(filepath.Join(db.metaPath, "spool")); err != nil {
+		return fmt.Errorf("cannot remove spool: %w", err)
+	}
+
 	// Start monitoring SQLite database in a separate goroutine.
-	if db.MonitorInterval > 0 {
+	// The WAL watch is registered before returning so no changes are missed.
+	if db.MonitorInterval > 0 || db.MonitorMode == MonitorModeInotify {
+		var walWatch *internal.FileWatch
+		if db.MonitorMode == MonitorModeInotify {
+			if walWatch, err = db.watchWAL(); err != nil {
+				db.Logger.Warn("cannot watch wal, falling back to polling", "error", err)
+			}
+		}
+
 		db.wg.Add(1)
-		go func() { defer db.wg.Done(); db.monitor() }()
+		go func() { defer db.wg.Done(); db.monitor(walWatch) }()
 	}
 
 	// Start replication.
@@ -352,6 +477,7 @@ func (db *DB) Close(ctx context.Context) (err error) {
 		}
 		r.Stop(true)
 	}
+	db.closeSharedObjects()
 
 	// Release the read lock to allow other applications to handle checkpointing.
 	if db.rtx != nil {
@@ -490,6 +616,8 @@ func (db *DB) init(ctx context.Context) (err error) {
 	// If we have an existing shadow WAL, ensure the headers match.
 	if err := db.verifyHeadersMatch(); err != nil {
 		db.Logger.Warn("init: cannot determine last wal position, clearing generation", "error", err)
+		db.clearedPos, _ = db.Pos()
+		db.clearedReason = err.Error()
 		if err := os.Remove(db.GenerationNamePath()); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("remove generation name: %w", err)
 		}
@@ -580,11 +708,66 @@ func (db *DB) cleanWAL() error {
 	generation, err := db.CurrentGeneration()
 	if err != nil {
 		return err
+	} else if generation == "" {
+		return nil
+	}
+
+	// Determine the size of each shadow WAL file in the generation.
+	dir := db.ShadowWALDir(generation)
+	sizes, err := shadowWALSizes(dir)
+	if err != nil {
+		return err
+	}
+
+	// Determine bytes retained for each replica & apply the size limit.
+	retained := make([]int64, len(db.Replicas))
+	for i, r := range db.Replicas {
+		retained[i] = shadowWALRetained(r, generation, sizes)
+		replicaShadowWALRetainedBytesGaugeVec.WithLabelValues(db.Path(), r.Name()).Set(float64(retained[i]))
+	}
+	if db.MaxShadowWALSize > 0 {
+		db.enforceShadowWALSize(retained)
 	}
 
-	// Determine lowest index that's been replicated to all replicas.
+	// Determine lowest index that's been replicated to all replicas. Only the
+	// latest files are retained if all replicas have been dropped.
+	min := db.minReplicaIndex(generation)
+	if min == -1 && len(db.Replicas) > 0 {
+		for index := range sizes {
+			if index > min {
+				min = index
+			}
+		}
+	}
+
+	// Skip if our lowest index is too small.
+	if min <= 0 {
+		return nil
+	}
+	min-- // Keep an extra WAL file.
+
+	// Remove all WAL files for the generation before the lowest index.
+	for index := range sizes {
+		if index >= min {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, FormatWALPath(index))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// minReplicaIndex returns the lowest WAL index replicated to all replicas,
+// excluding replicas whose shadow WAL has been dropped. Returns -1 if there
+// are no such replicas.
+func (db *DB) minReplicaIndex(generation string) int {
 	min := -1
 	for _, r := range db.Replicas {
+		if r.shadowWALDropped() {
+			continue
+		}
+
 		pos := r.Pos()
 		if pos.Generation != generation {
 			pos = Pos{} // different generation, reset index to zero
@@ -593,30 +776,96 @@ func (db *DB) cleanWAL() error {
 			min = pos.Index
 		}
 	}
+	return min
+}
 
-	// Skip if our lowest index is too small.
-	if min <= 0 {
-		return nil
+// enforceShadowWALSize applies ShadowWALPolicy if the shadow WAL retained for
+// any replica exceeds MaxShadowWALSize. retained holds the bytes retained for
+// each replica & is updated as replicas are dropped.
+func (db *DB) enforceShadowWALSize(retained []int64) {
+	// Find the replica with the most shadow WAL retained for it.
+	lagging := func() (index int, n int64) {
+		index = -1
+		for i, r := range db.Replicas {
+			if !r.shadowWALDropped() && (index == -1 || retained[i] > n) {
+				index, n = i, retained[i]
+			}
+		}
+		return index, n
 	}
-	min-- // Keep an extra WAL file.
 
-	// Remove all WAL files for the generation before the lowest index.
-	dir := db.ShadowWALDir(generation)
-	fis, err := os.ReadDir(dir)
+	// Release the shadow WAL for the most lagging replicas until the rest fits.
+	i, size := lagging()
+	if db.ShadowWALPolicy == ShadowWALPolicyDrop {
+		for i != -1 && size > db.MaxShadowWALSize {
+			r := db.Replicas[i]
+			db.Logger.Warn("shadow wal size limit exceeded, dropping lagging replica",
+				"replica", r.Name(), "position", r.Pos().String(), "size", size, "limit", db.MaxShadowWALSize)
+			r.dropShadowWAL()
+
+			retained[i] = 0
+			replicaShadowWALRetainedBytesGaugeVec.WithLabelValues(db.Path(), r.Name()).Set(0)
+			i, size = lagging()
+		}
+	}
+
+	// Log when the limit is first exceeded & once it is no longer exceeded.
+	over := size > db.MaxShadowWALSize
+	if over && !db.shadowWALOver {
+		db.Logger.Warn("shadow wal size limit exceeded", "size", size, "limit", db.MaxShadowWALSize, "policy", db.ShadowWALPolicy)
+	} else if !over && db.shadowWALOver {
+		db.Logger.Info("shadow wal size within limit", "size", size, "limit", db.MaxShadowWALSize)
+	}
+	db.shadowWALOver = over
+}
+
+// shadowWALRetained returns the number of shadow WAL bytes in sizes that r
+// has not yet replicated. Returns zero if the replica has been dropped.
+func shadowWALRetained(r *Replica, generation string, sizes map[int]int64) (n int64) {
+	if r.shadowWALDropped() {
+		return 0
+	}
+
+	pos := r.Pos()
+	if pos.Generation != generation {
+		pos = Pos{}
+	}
+	for index, size := range sizes {
+		if index >= pos.Index {
+			n += size
+		}
+	}
+	if n -= pos.Offset; n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// shadowWALSizes returns the size of each shadow WAL file in dir by index.
+func shadowWALSizes(dir string) (map[int]int64, error) {
+	des, err := os.ReadDir(dir)
 	if os.IsNotExist(err) {
-		return nil
+		return nil, nil
 	} else if err != nil {
-		return err
+		return nil, err
 	}
-	for _, fi := range fis {
-		if idx, err := ParseWALPath(fi.Name()); err != nil || idx >= min {
+
+	m := make(map[int]int64)
+	for _, de := range des {
+		index, err := ParseWALPath(de.Name())
+		if err != nil {
 			continue
 		}
-		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil {
-			return err
+
+		fi, err := de.Info()
+		if os.IsNotExist(err) {
+			continue // file was deleted after os.ReadDir returned
+		} else if err != nil {
+			return nil, err
 		}
+		m[index] = fi.Size()
 	}
-	return nil
+	return m, nil
 }
 
 // acquireReadLock begins a read transaction on the database to prevent checkpointing.
@@ -677,7 +926,7 @@ func (db *DB) CurrentGeneration() (string, error) {
 // createGeneration starts a new generation by creating the generation
 // directory, snapshotting to each replica, and updating the current
 // generation name.
-func (db *DB) createGeneration() (string, error) {
+func (db *DB) createGeneration(parent Pos, reason string) (string, error) {
 	// Generate random generation hex name.
 	buf := make([]byte, GenerationNameLen/2)
 	_, _ = rand.New(rand.NewSource(time.Now().UnixNano())).Read(buf)
@@ -689,6 +938,11 @@ func (db *DB) createGeneration() (string, error) {
 		return "", err
 	}
 
+	// Record where the generation came from before it becomes current.
+	if err := db.writeGenerationMeta(generation, parent, reason); err != nil {
+		return "", fmt.Errorf("write generation metadata: %w", err)
+	}
+
 	// Initialize shadow WAL with copy of header.
 	if _, err := db.initShadowWALFile(db.ShadowWALPath(generation, 0)); err != nil {
 		return "", fmt.Errorf("initialize shadow wal: %w", err)
@@ -759,23 +1013,40 @@ func (db *DB) Sync(ctx context.Context) (err error) {
 
 	// If we are unable to verify the WAL state then we start a new generation.
 	if info.reason != "" {
+		// Determine last position of the previous generation, if any. This is
+		// only recorded for lineage so errors are ignored. If the generation
+		// was cleared on init then use its position & reason instead.
+		parent, _ := db.Pos()
+		if parent.IsZero() && !db.clearedPos.IsZero() {
+			parent, info.reason = db.clearedPos, db.clearedReason
+		}
+		db.clearedPos, db.clearedReason = Pos{}, ""
+
 		// Start new generation & notify user via log message.
-		if info.generation, err = db.createGeneration(); err != nil {
+		if info.generation, err = db.createGeneration(parent, info.reason); err != nil {
 			return fmt.Errorf("create generation: %w", err)
 		}
-		db.Logger.Info("sync: new generation", "generation", info.generation, "reason", info.reason)
+		db.Logger.Info("sync: new generation", "generation", info.generation, "reason", info.reason, "parent", parent.String())
 
 		// Clear shadow wal info.
 		info.shadowWALPath = db.ShadowWALPath(info.generation, 0)
 		info.shadowWALSize = WALHeaderSize
 		info.restart = false
 		info.reason = ""
+		db.shadowWALOver = false
 
 	}
 
-	// Synchronize real WAL with current shadow WAL.
-	origWALSize, newWALSize, err := db.syncWAL(info)
-	if err != nil {
+	// Synchronize real WAL with current shadow WAL. If throttled, new frames
+	// are left in the real WAL while replicas drain the shadow WAL. Replicas
+	// are still notified so that failed replicas retry.
+	throttled := db.ShadowWALPolicy == ShadowWALPolicyThrottle && db.shadowWALOver
+	db.throttled = throttled
+	var origWALSize, newWALSize int64
+	if throttled {
+		db.Logger.Debug("sync: shadow wal size limit exceeded, throttling")
+		changed = true
+	} else if origWALSize, newWALSize, err = db.syncWAL(info); err != nil {
 		return fmt.Errorf("sync wal: %w", err)
 	}
 
@@ -793,8 +1064,9 @@ func (db *DB) Sync(ctx context.Context) (err error) {
 		checkpoint = true
 	}
 
-	// Issue the checkpoint.
-	if checkpoint {
+	// Issue the checkpoint. Suspended while throttled as new frames have not
+	// been copied to the shadow WAL.
+	if checkpoint && !throttled {
 		changed = true
 
 		if err := db.checkpoint(ctx, info.generation, checkpointMode); err != nil {
@@ -1431,18 +1703,40 @@ func (db *DB) execCheckpoint(ctx context.Context, mode string) (err error) {
 }
 
 // monitor runs in a separate goroutine and monitors the database & WAL.
-func (db *DB) monitor() {
-	db.Logger.Info("starting database monitoring")
+// If walWatch is not nil, changes to the WAL also trigger a sync.
+func (db *DB) monitor(walWatch *internal.FileWatch) {
+	db.Logger.Info("starting database monitoring", "mode", db.MonitorMode)
 
-	ticker := time.NewTicker(db.MonitorInterval)
-	defer ticker.Stop()
+	// Poll on an interval. This is also a fallback when watching files.
+	var tickerCh <-chan time.Time
+	if db.MonitorInterval > 0 {
+		ticker := time.NewTicker(db.MonitorInterval)
+		defer ticker.Stop()
+		tickerCh = ticker.C
+	}
+
+	var changeCh <-chan struct{}
+	if walWatch != nil {
+		defer func() { _ = walWatch.Close() }()
+		changeCh = walWatch.C()
+	}
 
+	var debounceCh <-chan time.Time
 	for {
-		// Wait for ticker or context close.
+		// Wait for ticker, file change or context close.
 		select {
 		case <-db.ctx.Done():
 			return
-		case <-ticker.C:
+		case <-tickerCh:
+		case <-changeCh:
+			// Delay the sync so a burst of writes is coalesced. Additional
+			// changes during the delay do not extend it so lag stays bounded.
+			if debounceCh == nil {
+				debounceCh = time.After(db.MonitorDebounce)
+			}
+			continue
+		case <-debounceCh:
+			debounceCh = nil
 		}
 
 		// Sync the database to the shadow WAL.
@@ -1452,6 +1746,27 @@ func (db *DB) monitor() {
 	}
 }
 
+// watchWAL returns a watch on the WAL file using the shared file watcher. The
+// WAL is watched through its parent directory so it is still detected after
+// being recreated.
+func (db *DB) watchWAL() (*internal.FileWatch, error) {
+	fileWatcher.once.Do(func() {
+		fileWatcher.w, fileWatcher.err = internal.NewFileWatcher()
+	})
+	if fileWatcher.err != nil {
+		return nil, fileWatcher.err
+	}
+	return fileWatcher.w.Watch(db.WALPath())
+}
+
+// fileWatcher is shared by all databases in the process since the number of
+// inotify instances per user is limited, typically to 128.
+var fileWatcher struct {
+	once sync.Once
+	w    *internal.FileWatcher
+	err  error
+}
+
 // CalcRestoreTarget returns a replica & generation to restore from based on opt criteria.
 func (db *DB) CalcRestoreTarget(ctx context.Context, opt RestoreOptions) (*Replica, string, error) {
 	var target struct {
@@ -1567,6 +1882,10 @@ func (db *DB) EndSnapshot() {
 // DefaultRestoreParallelism is the default parallelism when downloading WAL files.
 const DefaultRestoreParallelism = 8
 
+// DefaultSnapshotChunkSize is the default size of each ranged read when
+// downloading a snapshot in parallel.
+const DefaultSnapshotChunkSize = 32 * 1024 * 1024 // 32MB
+
 // RestoreOptions represents options for DB.Restore().
 type RestoreOptions struct {
 	// Target path to restore into.
@@ -1590,7 +1909,13 @@ type RestoreOptions struct {
 	Timestamp time.Time
 
 	// Specifies how many WAL files are downloaded in parallel during restore.
+	// Also limits the number of parallel chunks when downloading snapshots
+	// from clients that support ranged reads.
 	Parallelism int
+
+	// Size of each chunk when downloading a snapshot in parallel.
+	// Defaults to DefaultSnapshotChunkSize if zero.
+	SnapshotChunkSize int64
 }
 
 // NewRestoreOptions returns a new instance of RestoreOptions with defaults.
@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
 )
 
 func TestDB_Path(t *testing.T) {
@@ -591,6 +593,173 @@ func TestDB_Sync(t *testing.T) {
 	})
 }
 
+func TestDB_Monitor(t *testing.T) {
+	// Ensure WAL changes trigger a sync without relying on the poll interval.
+	t.Run("Inotify", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("inotify only supported on linux")
+		}
+
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		db.MonitorMode = litestream.MonitorModeInotify
+		db.MonitorInterval = 0 // disable polling
+		if err := db.Open(); err != nil {
+			t.Fatal(err)
+		}
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseDBs(t, db, sqldb)
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+
+		// Wait for the monitor to sync the database.
+		for timeout := time.After(5 * time.Second); ; {
+			if pos, err := db.Pos(); err != nil {
+				t.Fatal(err)
+			} else if pos.Generation != "" {
+				break
+			}
+
+			select {
+			case <-timeout:
+				t.Fatal("timeout waiting for sync")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	})
+
+	t.Run("ErrInvalidMode", func(t *testing.T) {
+		db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+		db.MonitorMode = "foo"
+		if err := db.Open(); err == nil || err.Error() != `invalid monitor mode: "foo"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestDB_MaxShadowWALSize(t *testing.T) {
+	// Ensure a lagging replica is dropped & writes a new snapshot on return.
+	t.Run("Drop", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := memory.NewReplicaClient()
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+		db.Replicas = []*litestream.Replica{r}
+		mustShadowWALSetup(t, db, sqldb, r)
+		db.MaxShadowWALSize, db.ShadowWALPolicy = 16<<10, litestream.ShadowWALPolicyDrop
+
+		// Write across several WAL indexes while the replica is not syncing.
+		for i := 0; i < 3; i++ {
+			mustShadowWALInsert(t, db, sqldb, 10)
+			if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the latest shadow WAL files are retained.
+		pos, err := db.Pos()
+		if err != nil {
+			t.Fatal(err)
+		} else if des, err := os.ReadDir(db.ShadowWALDir(pos.Generation)); err != nil {
+			t.Fatal(err)
+		} else if len(des) > 2 {
+			t.Fatalf("shadow wal files=%d, want <= 2", len(des))
+		}
+
+		// Returning replica writes a new snapshot & continues from it.
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if snapshots, err := r.Snapshots(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(snapshots), 2; got != want {
+			t.Fatalf("len(snapshots)=%d, want %d", got, want)
+		}
+		mustShadowWALInsert(t, db, sqldb, 1)
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		mustRestoreMatches(t, sqldb, c)
+	})
+
+	// Ensure the shadow WAL stops growing until the replica catches up.
+	t.Run("Throttle", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := memory.NewReplicaClient()
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+		db.Replicas = []*litestream.Replica{r}
+		mustShadowWALSetup(t, db, sqldb, r)
+		db.MaxShadowWALSize, db.ShadowWALPolicy = 16<<10, litestream.ShadowWALPolicyThrottle
+
+		mustShadowWALInsert(t, db, sqldb, 20)
+		pos, err := db.Pos()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustShadowWALInsert(t, db, sqldb, 1)
+		if got, err := db.Pos(); err != nil {
+			t.Fatal(err)
+		} else if got != pos {
+			t.Fatalf("Pos()=%s, want %s", got, pos)
+		}
+
+		// The synced position would not include frames left in the real WAL.
+		if _, err := db.SyncPos(context.Background()); err != litestream.ErrShadowWALThrottled {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Copying resumes once the replica catches up.
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, err := db.Pos(); err != nil {
+			t.Fatal(err)
+		} else if got == pos {
+			t.Fatal("expected shadow wal to advance")
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		mustRestoreMatches(t, sqldb, c)
+	})
+}
+
+// mustShadowWALSetup creates a table & replicates it to r.
+func mustShadowWALSetup(tb testing.TB, db *litestream.DB, sqldb *sql.DB, r *litestream.Replica) {
+	tb.Helper()
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar BLOB);`); err != nil {
+		tb.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		tb.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// mustShadowWALInsert inserts n rows, syncing the database after each one.
+func mustShadowWALInsert(tb testing.TB, db *litestream.DB, sqldb *sql.DB, n int) {
+	tb.Helper()
+
+	for i := 0; i < n; i++ {
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+			tb.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
 // MustOpenDBs returns a new instance of a DB & associated SQL DB.
 func MustOpenDBs(tb testing.TB) (*litestream.DB, *sql.DB) {
 	tb.Helper()
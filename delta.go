@@ -0,0 +1,389 @@
+package litestream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/benbjohnson/litestream/internal"
+)
+
+// Delta snapshots contain only the pages changed since a base snapshot. The
+// object begins with an unencrypted header identifying the base snapshot so
+// the chain can be resolved without decryption identities. The remainder is
+// compressed & encrypted like a full snapshot and contains:
+//
+//	page size, page count, changed page count (uint32 each)
+//	page number (uint32) & page data, for each changed page
+const (
+	deltaSnapshotMagic      = "LSDELTA1"
+	deltaSnapshotHeaderSize = 12
+	deltaPagesHeaderSize    = 12
+)
+
+// Size of the header of the local page checksums file: snapshot index,
+// delta chain length, page size & page count (uint32 each).
+const pageChecksumsHeaderSize = 16
+
+// snapshotPlan describes how a snapshot is written: either as the full
+// database or as the pages changed since a base snapshot.
+type snapshotPlan struct {
+	index    int      // index of snapshot being written
+	base     int      // base snapshot index; -1 if full snapshot
+	chainN   int      // delta snapshots since last full snapshot
+	pageSize int      // database page size
+	pageN    int      // database size, in pages
+	pgnos    []uint32 // changed pages, if delta snapshot
+
+	path string   // page checksums file
+	f    *os.File // pending page checksums file; nil if deltas disabled
+}
+
+// IsDelta returns true if only changed pages are written.
+func (p *snapshotPlan) IsDelta() bool { return p.base >= 0 }
+
+// WriteHeader writes the unencrypted delta header to w, if a delta snapshot.
+func (p *snapshotPlan) WriteHeader(w io.Writer) error {
+	if !p.IsDelta() {
+		return nil
+	}
+
+	buf := make([]byte, deltaSnapshotHeaderSize)
+	copy(buf, deltaSnapshotMagic)
+	binary.BigEndian.PutUint32(buf[8:], uint32(p.base))
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteData writes the full database or the changed pages from f to w.
+func (p *snapshotPlan) WriteData(w io.Writer, f *os.File) error {
+	if !p.IsDelta() {
+		_, err := io.Copy(w, f)
+		return err
+	}
+
+	hdr := make([]byte, deltaPagesHeaderSize)
+	binary.BigEndian.PutUint32(hdr[0:], uint32(p.pageSize))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(p.pageN))
+	binary.BigEndian.PutUint32(hdr[8:], uint32(len(p.pgnos)))
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+p.pageSize)
+	for _, pgno := range p.pgnos {
+		binary.BigEndian.PutUint32(buf[:4], pgno)
+		if _, err := f.ReadAt(buf[4:], int64(pgno-1)*int64(p.pageSize)); err != nil {
+			return fmt.Errorf("read page %d: %w", pgno, err)
+		} else if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit saves the page checksums once the snapshot has been written so the
+// next snapshot can be written as a delta against it.
+func (p *snapshotPlan) Commit() error {
+	if p.f == nil {
+		return nil
+	}
+
+	hdr := make([]byte, pageChecksumsHeaderSize)
+	binary.BigEndian.PutUint32(hdr[0:], uint32(p.index))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(p.chainN))
+	binary.BigEndian.PutUint32(hdr[8:], uint32(p.pageSize))
+	binary.BigEndian.PutUint32(hdr[12:], uint32(p.pageN))
+	if _, err := p.f.WriteAt(hdr, 0); err != nil {
+		return err
+	} else if err := p.f.Sync(); err != nil {
+		return err
+	} else if err := p.f.Close(); err != nil {
+		return err
+	}
+	p.f = nil
+
+	return os.Rename(p.path+".tmp", p.path)
+}
+
+// Close discards the pending page checksums, if not committed.
+func (p *snapshotPlan) Close() error {
+	if p.f == nil {
+		return nil
+	}
+	_ = p.f.Close()
+	p.f = nil
+	return os.Remove(p.path + ".tmp")
+}
+
+// pageChecksumsPath returns the path of the checksums of the pages in the
+// last snapshot written by the replica for a generation.
+func (r *Replica) pageChecksumsPath(generation string) string {
+	return filepath.Join(r.db.GenerationPath(generation), "checksums", r.Name())
+}
+
+// planSnapshot checksums each page of the database file, f, & compares them
+// against the last snapshot to determine if a delta snapshot can be written.
+// The file must not change until the snapshot is written.
+func (r *Replica) planSnapshot(ctx context.Context, pos Pos, f *os.File) (_ *snapshotPlan, err error) {
+	plan := &snapshotPlan{
+		index: pos.Index,
+		base:  -1,
+		path:  r.pageChecksumsPath(pos.Generation),
+	}
+
+	// Remove stale checksums so they are never compared against snapshots
+	// written while delta snapshots were disabled.
+	if r.MaxDeltaSnapshots <= 0 {
+		if err := os.Remove(plan.path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return plan, nil
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	plan.pageSize = r.db.PageSize()
+	if plan.pageSize <= 0 || fi.Size()%int64(plan.pageSize) != 0 {
+		return plan, nil
+	}
+	plan.pageN = int(fi.Size() / int64(plan.pageSize))
+
+	// Open checksums from the previous snapshot, if they can be used as a base.
+	prev, err := r.openPageChecksums(plan)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		defer prev.Close()
+	}
+
+	// Write new checksums to a temporary file. The header is written on commit.
+	if err := internal.MkdirAll(filepath.Dir(plan.path), r.db.dirInfo); err != nil {
+		return nil, err
+	}
+	if plan.f, err = internal.CreateFile(plan.path+".tmp", r.db.fileInfo); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = plan.Close()
+		}
+	}()
+	if _, err := plan.f.Seek(pageChecksumsHeaderSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var prd *bufio.Reader
+	if prev != nil {
+		prd = bufio.NewReader(prev)
+	}
+	rd := bufio.NewReaderSize(io.NewSectionReader(f, 0, fi.Size()), 1<<20)
+	bw := bufio.NewWriter(plan.f)
+	table := crc64.MakeTable(crc64.ISO)
+	buf := make([]byte, plan.pageSize)
+	var sum, prevSum [8]byte
+	for pgno := uint32(1); int(pgno) <= plan.pageN; pgno++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		} else if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, fmt.Errorf("read page %d: %w", pgno, err)
+		}
+
+		binary.BigEndian.PutUint64(sum[:], crc64.Checksum(buf, table))
+		if _, err := bw.Write(sum[:]); err != nil {
+			return nil, err
+		}
+
+		// Compare against the previous checksum, if still comparing.
+		if prd == nil {
+			continue
+		} else if int(pgno) <= prev.pageN {
+			if _, err := io.ReadFull(prd, prevSum[:]); err != nil {
+				return nil, fmt.Errorf("read page checksum %d: %w", pgno, err)
+			} else if sum == prevSum {
+				continue
+			}
+		}
+
+		// Stop comparing once a delta would exceed half the database.
+		if plan.pgnos = append(plan.pgnos, pgno); len(plan.pgnos)*2 > plan.pageN {
+			prd, plan.pgnos = nil, nil
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Only write a delta if the base snapshot still exists on the replica.
+	if prd != nil {
+		if ok, err := r.snapshotExists(ctx, pos.Generation, prev.index); err != nil {
+			return nil, err
+		} else if ok {
+			plan.base, plan.chainN = prev.index, prev.chainN+1
+		} else {
+			plan.pgnos = nil
+		}
+	}
+
+	return plan, nil
+}
+
+// pageChecksumsFile is an open page checksums file positioned at the first
+// checksum, along with the values from its header.
+type pageChecksumsFile struct {
+	*os.File
+	index  int // snapshot index
+	chainN int // delta snapshots since last full snapshot
+	pageN  int // database size, in pages
+}
+
+// openPageChecksums opens the checksums of the previous snapshot. Returns nil
+// if the checksums do not exist or cannot be used as the base for a delta.
+func (r *Replica) openPageChecksums(plan *snapshotPlan) (*pageChecksumsFile, error) {
+	f, err := os.Open(plan.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	hdr := make([]byte, pageChecksumsHeaderSize)
+	if _, err := io.ReadFull(f, hdr); err != nil {
+		_ = f.Close()
+		return nil, nil
+	}
+
+	pf := &pageChecksumsFile{
+		File:   f,
+		index:  int(binary.BigEndian.Uint32(hdr[0:])),
+		chainN: int(binary.BigEndian.Uint32(hdr[4:])),
+		pageN:  int(binary.BigEndian.Uint32(hdr[12:])),
+	}
+	pageSize := int(binary.BigEndian.Uint32(hdr[8:]))
+
+	if pf.index >= plan.index ||
+		pf.chainN >= r.MaxDeltaSnapshots ||
+		pageSize != plan.pageSize ||
+		fi.Size() != pageChecksumsHeaderSize+int64(pf.pageN)*8 {
+		_ = f.Close()
+		return nil, nil
+	}
+	return pf, nil
+}
+
+// snapshotExists returns true if the snapshot exists on the replica.
+func (r *Replica) snapshotExists(ctx context.Context, generation string, index int) (bool, error) {
+	itr, err := r.Client.Snapshots(ctx, generation)
+	if err != nil {
+		return false, err
+	}
+	defer itr.Close()
+
+	var found bool
+	for itr.Next() {
+		if itr.Snapshot().Index == index {
+			found = true
+		}
+	}
+	return found, itr.Close()
+}
+
+// snapshotBase returns the index of the snapshot that a delta snapshot is
+// built upon. Returns -1 if the snapshot is a full snapshot.
+func (r *Replica) snapshotBase(ctx context.Context, generation string, index int) (int, error) {
+	var rd io.ReadCloser
+	var err error
+	if rr, ok := UnwrapClient[SnapshotRangeReader](r.Client); ok {
+		rd, err = rr.SnapshotRangeReader(ctx, generation, index, 0, deltaSnapshotHeaderSize)
+	} else {
+		rd, err = r.Client.SnapshotReader(ctx, generation, index)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rd.Close()
+
+	buf := make([]byte, deltaSnapshotHeaderSize)
+	if _, err := io.ReadFull(rd, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return -1, nil
+	} else if err != nil {
+		return 0, err
+	} else if !bytes.Equal(buf[:8], []byte(deltaSnapshotMagic)) {
+		return -1, nil
+	}
+
+	base := int(binary.BigEndian.Uint32(buf[8:]))
+	if base >= index {
+		return 0, fmt.Errorf("invalid delta snapshot base: %s/%08x", generation, base)
+	}
+	return base, nil
+}
+
+// SnapshotChain returns the indexes of the snapshots required to restore the
+// snapshot at index, starting with the full snapshot & ending with index.
+func (r *Replica) SnapshotChain(ctx context.Context, generation string, index int) ([]int, error) {
+	a := []int{index}
+	for {
+		base, err := r.snapshotBase(ctx, generation, a[0])
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s/%08x: %w", generation, a[0], err)
+		} else if base < 0 {
+			return a, nil
+		}
+		a = append([]int{base}, a...)
+	}
+}
+
+// applyDeltaSnapshot writes the pages from a decompressed delta snapshot to f
+// & truncates f to the size of the database.
+func applyDeltaSnapshot(f *os.File, rd io.Reader) error {
+	hdr := make([]byte, deltaPagesHeaderSize)
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		return fmt.Errorf("read delta header: %w", err)
+	}
+	pageSize := int(binary.BigEndian.Uint32(hdr[0:]))
+	pageN := binary.BigEndian.Uint32(hdr[4:])
+	n := int(binary.BigEndian.Uint32(hdr[8:]))
+	if pageSize < 512 || pageSize > 65536 {
+		return fmt.Errorf("invalid delta page size: %d", pageSize)
+	}
+
+	buf := make([]byte, 4+pageSize)
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return fmt.Errorf("read delta page: %w", err)
+		}
+
+		pgno := binary.BigEndian.Uint32(buf[:4])
+		if pgno == 0 || pgno > pageN {
+			return fmt.Errorf("invalid delta page number: %d", pgno)
+		} else if _, err := f.WriteAt(buf[4:], int64(pgno-1)*int64(pageSize)); err != nil {
+			return err
+		}
+	}
+
+	// Ensure no trailing data remains in the delta.
+	if _, err := io.ReadFull(rd, buf[:1]); err == nil {
+		return errors.New("unexpected data after delta pages")
+	} else if err != io.EOF {
+		return err
+	}
+
+	return f.Truncate(int64(pageN) * int64(pageSize))
+}
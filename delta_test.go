@@ -0,0 +1,180 @@
+package litestream_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestReplica_Snapshot_Delta(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := memory.NewReplicaClient()
+		r := litestream.NewReplica(db, "")
+		r.Client, r.MaxDeltaSnapshots = c, 2
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar BLOB);`); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 200; i++ {
+			if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Initial sync writes a full snapshot. Subsequent snapshots only
+		// contain changed pages until the limit is reached.
+		delta := mustDeltaSnapshot(t, db, sqldb, r, 2)
+		if snapshots, err := r.Snapshots(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if full := snapshots[0]; delta.Size*10 > full.Size {
+			t.Fatalf("delta snapshot too large: %d, full snapshot %d", delta.Size, full.Size)
+		}
+		mustDeltaSnapshot(t, db, sqldb, r, 3)
+
+		// Restore the end of the chain.
+		mustRestoreMatches(t, sqldb, c)
+
+		// Limit reached so a full snapshot is written.
+		mustDeltaSnapshot(t, db, sqldb, r, 1)
+		mustRestoreMatches(t, sqldb, c)
+	})
+
+	// Ensure retention keeps the snapshots a retained delta is built upon.
+	t.Run("Retention", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := memory.NewReplicaClient()
+		r := litestream.NewReplica(db, "")
+		r.Client, r.MaxDeltaSnapshots = c, 10
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar BLOB);`); err != nil {
+			t.Fatal(err)
+		}
+		mustDeltaSnapshot(t, db, sqldb, r, 2)
+
+		// Nothing is retained so retention writes a new delta snapshot.
+		mustDeltaAdvance(t, db, sqldb, r)
+		r.Retention = time.Nanosecond
+		if err := r.EnforceRetention(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if snapshots, err := r.Snapshots(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(snapshots), 3; got != want {
+			t.Fatalf("len(snapshots)=%d, want %d", got, want)
+		}
+		mustRestoreMatches(t, sqldb, c)
+	})
+
+	// Ensure bundles include the base snapshots of a delta snapshot.
+	t.Run("Export", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		r := litestream.NewReplica(db, "")
+		r.Client, r.MaxDeltaSnapshots = memory.NewReplicaClient(), 10
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar BLOB);`); err != nil {
+			t.Fatal(err)
+		}
+		mustDeltaSnapshot(t, db, sqldb, r, 2)
+
+		opt := litestream.NewRestoreOptions()
+		opt.Generation = r.Pos().Generation
+
+		var buf bytes.Buffer
+		manifest, err := r.Export(context.Background(), &buf, opt)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(manifest.BaseSnapshots), 1; got != want {
+			t.Fatalf("len(BaseSnapshots)=%d, want %d", got, want)
+		}
+
+		c := memory.NewReplicaClient()
+		rr := litestream.NewReplica(nil, "")
+		rr.Client = c
+		if _, err := rr.Import(context.Background(), &buf); err != nil {
+			t.Fatal(err)
+		}
+		mustRestoreMatches(t, sqldb, c)
+	})
+}
+
+// mustDeltaAdvance inserts a row & moves the database to a new WAL index.
+func mustDeltaAdvance(tb testing.TB, db *litestream.DB, sqldb *sql.DB, r *litestream.Replica) {
+	tb.Helper()
+
+	if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+		tb.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		tb.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		tb.Fatal(err)
+	} else if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+		tb.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// mustDeltaSnapshot advances the database, writes a snapshot & verifies the
+// length of its snapshot chain.
+func mustDeltaSnapshot(tb testing.TB, db *litestream.DB, sqldb *sql.DB, r *litestream.Replica, chainN int) litestream.SnapshotInfo {
+	tb.Helper()
+
+	mustDeltaAdvance(tb, db, sqldb, r)
+	info, err := r.Snapshot(context.Background())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	if chain, err := r.SnapshotChain(context.Background(), info.Generation, info.Index); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(chain), chainN; got != want {
+		tb.Fatalf("len(chain)=%d, want %d", got, want)
+	}
+	return info
+}
+
+// mustRestoreMatches restores the latest state from the client & verifies it
+// matches the contents of sqldb.
+func mustRestoreMatches(tb testing.TB, sqldb *sql.DB, c litestream.ReplicaClient) {
+	tb.Helper()
+
+	rr := litestream.NewReplica(nil, "")
+	rr.Client = c
+
+	opt := litestream.NewRestoreOptions()
+	opt.OutputPath = filepath.Join(tb.TempDir(), "db")
+	generation, _, err := rr.CalcRestoreTarget(context.Background(), opt)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	opt.Generation = generation
+	if err := rr.Restore(context.Background(), opt); err != nil {
+		tb.Fatal(err)
+	}
+
+	restored := MustOpenSQLDB(tb, opt.OutputPath)
+	defer MustCloseSQLDB(tb, restored)
+
+	var got, want string
+	if err := sqldb.QueryRow(`SELECT hex(group_concat(bar)) FROM foo`).Scan(&want); err != nil {
+		tb.Fatal(err)
+	} else if err := restored.QueryRow(`SELECT hex(group_concat(bar)) FROM foo`).Scan(&got); err != nil {
+		tb.Fatal(err)
+	} else if got != want {
+		tb.Fatal("restored data mismatch")
+	}
+}
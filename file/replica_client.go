@@ -15,6 +15,9 @@ import (
 const ReplicaClientType = "file"
 
 var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.SnapshotRangeReader = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
 
 // ReplicaClient is a client for writing snapshots & WAL segments to disk.
 type ReplicaClient struct {
@@ -56,6 +59,14 @@ func (c *ReplicaClient) GenerationsDir() (string, error) {
 	return filepath.Join(c.path, "generations"), nil
 }
 
+// LeasePath returns the path to the replica lease file.
+func (c *ReplicaClient) LeasePath() (string, error) {
+	if c.path == "" {
+		return "", fmt.Errorf("file replica path required")
+	}
+	return filepath.Join(c.path, "lease"), nil
+}
+
 // GenerationDir returns the path to a generation's root directory.
 func (c *ReplicaClient) GenerationDir(generation string) (string, error) {
 	dir, err := c.GenerationsDir()
@@ -67,6 +78,15 @@ func (c *ReplicaClient) GenerationDir(generation string) (string, error) {
 	return filepath.Join(dir, generation), nil
 }
 
+// GenerationMetaPath returns the path to a generation's metadata file.
+func (c *ReplicaClient) GenerationMetaPath(generation string) (string, error) {
+	dir, err := c.GenerationDir(generation)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "meta.json"), nil
+}
+
 // SnapshotsDir returns the path to a generation's snapshot directory.
 func (c *ReplicaClient) SnapshotsDir(generation string) (string, error) {
 	dir, err := c.GenerationDir(generation)
@@ -244,6 +264,21 @@ func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, i
 	return os.Open(filename)
 }
 
+// SnapshotRangeReader returns a reader for size bytes of snapshot data
+// starting at offset.
+func (c *ReplicaClient) SnapshotRangeReader(ctx context.Context, generation string, index int, offset, size int64) (io.ReadCloser, error) {
+	filename, err := c.SnapshotPath(generation, index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewReadCloser(io.NewSectionReader(f, offset, size), f), nil
+}
+
 // DeleteSnapshot deletes a snapshot with the given generation & index.
 func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
 	filename, err := c.SnapshotPath(generation, index)
@@ -373,3 +408,81 @@ func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Po
 	}
 	return nil
 }
+
+// GenerationMetaReader returns a reader for the metadata of a generation.
+// Returns os.ErrNotExist if no metadata exists.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	filename, err := c.GenerationMetaPath(generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+	return os.Open(filename)
+}
+
+// WriteGenerationMeta atomically writes the metadata of a generation.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	filename, err := c.GenerationMetaPath(generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+	return c.writeFile(filename, rd)
+}
+
+// LeaseReader returns a reader for the replica lease.
+// Returns os.ErrNotExist if no lease exists.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	filename, err := c.LeasePath()
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine lease path: %w", err)
+	}
+	return os.Open(filename)
+}
+
+// WriteLease atomically writes the replica lease, replacing any existing lease.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	filename, err := c.LeasePath()
+	if err != nil {
+		return fmt.Errorf("cannot determine lease path: %w", err)
+	}
+	return c.writeFile(filename, rd)
+}
+
+// DeleteLease deletes the replica lease, if it exists.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	filename, err := c.LeasePath()
+	if err != nil {
+		return fmt.Errorf("cannot determine lease path: %w", err)
+	}
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeFile writes rd to a temporary file next to filename & atomically
+// renames it into place once synced.
+func (c *ReplicaClient) writeFile(filename string, rd io.Reader) error {
+	var fileInfo, dirInfo os.FileInfo
+	if db := c.db(); db != nil {
+		fileInfo, dirInfo = db.FileInfo(), db.DirInfo()
+	}
+
+	if err := internal.MkdirAll(filepath.Dir(filename), dirInfo); err != nil {
+		return err
+	}
+
+	f, err := internal.CreateFile(filename+".tmp", fileInfo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, rd); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
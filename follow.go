@@ -0,0 +1,823 @@
+package litestream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultFollowInterval is the default time between checks for new WAL segments.
+const DefaultFollowInterval = 1 * time.Second
+
+// FollowStateSuffix is appended to the output path of a follower to store its
+// last applied position so it can resume after a restart.
+const FollowStateSuffix = "-litestream-follow"
+
+// errWALSegmentGap is returned when the next WAL segment to apply is missing
+// from the replica, typically because it was removed by retention.
+var errWALSegmentGap = errors.New("wal segment gap")
+
+// Follower continuously restores a replica into a local database so that it
+// can be used as a read-only hot standby.
+//
+// The output database is kept in rollback journal mode & WAL frames are
+// written directly to the database file while holding an exclusive lock.
+// Readers must open the database as read-only. Readers that hold a database
+// open across a generation change continue to see the previous generation
+// until they reopen the file.
+type Follower struct {
+	mu          sync.RWMutex
+	opened      bool
+	pos         Pos                 // last applied position
+	last        WALSegmentInfo      // last applied segment
+	chain       walChain            // wal checksum chain at last applied position
+	lag         time.Duration       // age of oldest unapplied segment
+	generations map[string]struct{} // generations last seen on replica
+	h           *followHandle       // open handle to output database
+
+	lagGauge       prometheus.Gauge
+	walIndexGauge  prometheus.Gauge
+	walOffsetGauge prometheus.Gauge
+	restoreCounter prometheus.Counter
+
+	// Replica to follow.
+	Replica *Replica
+
+	// Path of the local database.
+	OutputPath string
+
+	// Time between checks for new WAL segments.
+	Interval time.Duration
+
+	// Number of parallel downloads used when restoring a snapshot.
+	Parallelism int
+
+	// Where to send log messages, defaults to global slog with output path.
+	Logger *slog.Logger
+}
+
+// NewFollower returns a new instance of Follower.
+func NewFollower(r *Replica, outputPath string) *Follower {
+	return &Follower{
+		Replica:     r,
+		OutputPath:  outputPath,
+		Interval:    DefaultFollowInterval,
+		Parallelism: DefaultRestoreParallelism,
+		Logger:      slog.With("path", outputPath),
+
+		lagGauge:       followLagGaugeVec.WithLabelValues(outputPath),
+		walIndexGauge:  followWALIndexGaugeVec.WithLabelValues(outputPath),
+		walOffsetGauge: followWALOffsetGaugeVec.WithLabelValues(outputPath),
+		restoreCounter: followRestoreTotalCounterVec.WithLabelValues(outputPath),
+	}
+}
+
+// Pos returns the last position applied to the output database.
+func (f *Follower) Pos() Pos {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.pos
+}
+
+// Lag returns the age of the oldest WAL segment on the replica that has not
+// yet been applied. Returns zero if the follower is caught up.
+func (f *Follower) Lag() time.Duration {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.lag
+}
+
+// Run syncs the output database every interval until ctx is canceled.
+func (f *Follower) Run(ctx context.Context) error {
+	defer func() { _ = f.Close() }()
+
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Sync(ctx); err != nil && ctx.Err() == nil {
+			f.Logger.Error("follow error", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close releases the handle to the output database.
+func (f *Follower) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.h == nil {
+		return nil
+	}
+	err := f.h.Close()
+	f.h = nil
+	return err
+}
+
+// Sync applies any new WAL segments from the replica to the output database.
+// The latest snapshot is restored first if the output database does not exist,
+// the replica has moved to a new generation, or WAL segments are missing.
+func (f *Follower) Sync(ctx context.Context) error {
+	if !f.opened {
+		if err := f.Open(); err != nil {
+			return err
+		}
+	}
+
+	generation, err := f.targetGeneration(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation: %w", err)
+	} else if generation == "" {
+		f.Logger.Debug("no generation available on replica, waiting")
+		return nil
+	}
+
+	// Restore from scratch if following a new generation.
+	if pos := f.Pos(); pos.Generation != generation {
+		if !pos.IsZero() {
+			f.Logger.Info("generation changed, restoring", "generation", generation, "prev", pos.Generation)
+		}
+		return f.restore(ctx, generation)
+	}
+
+	if err := f.apply(ctx, f.h); errors.Is(err, errWALSegmentGap) {
+		f.Logger.Warn("wal segments missing, restoring", "error", err)
+		return f.restore(ctx, generation)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Open loads the last applied position, if available, & opens the output
+// database. Returns an error if the output path exists but was not created by
+// a follower. Called automatically by Sync() if not called beforehand.
+func (f *Follower) Open() error {
+	state, err := f.readState()
+	if err != nil {
+		return err
+	}
+
+	// Refuse to overwrite a database that was not created by a follower.
+	if _, err := os.Stat(f.OutputPath); os.IsNotExist(err) {
+		f.opened = true
+		return nil
+	} else if err != nil {
+		return err
+	} else if state == nil {
+		return fmt.Errorf("cannot follow, output path already exists: %s", f.OutputPath)
+	} else if state.Dirty {
+		// Interrupted while applying a segment so restore from scratch.
+		f.opened = true
+		return nil
+	}
+
+	h, err := openFollowHandle(f.OutputPath)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.h, f.opened = h, true
+	f.mu.Unlock()
+	f.setPos(state.Pos())
+	return nil
+}
+
+// targetGeneration returns the generation to follow. The target is only
+// recalculated when the set of generations on the replica changes.
+func (f *Follower) targetGeneration(ctx context.Context) (string, error) {
+	generations, err := f.Replica.Client.Generations(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	changed := len(generations) != len(f.generations)
+	m := make(map[string]struct{}, len(generations))
+	for _, generation := range generations {
+		if _, ok := f.generations[generation]; !ok {
+			changed = true
+		}
+		m[generation] = struct{}{}
+	}
+	f.generations = m
+
+	if pos := f.Pos(); !changed && pos.Generation != "" {
+		return pos.Generation, nil
+	}
+
+	generation, _, err := f.Replica.CalcRestoreTarget(ctx, NewRestoreOptions())
+	return generation, err
+}
+
+// restore restores the latest snapshot of generation to a temporary path,
+// applies available WAL segments & then moves it to the output path.
+func (f *Follower) restore(ctx context.Context, generation string) (err error) {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	f.setPos(Pos{})
+
+	snapshotIndex, err := f.Replica.SnapshotIndexAt(ctx, generation, time.Time{})
+	if err != nil {
+		return fmt.Errorf("cannot find snapshot index: %w", err)
+	}
+
+	tmpPath := f.OutputPath + ".tmp"
+	if err := removeFollowFiles(tmpPath); err != nil {
+		return err
+	}
+	defer func() { _ = removeFollowFiles(tmpPath) }()
+
+	f.Logger.Info("restoring snapshot", "generation", generation, "index", snapshotIndex)
+	if err := f.Replica.restoreSnapshot(ctx, generation, snapshotIndex, tmpPath, f.Parallelism, DefaultSnapshotChunkSize); err != nil {
+		return fmt.Errorf("cannot restore snapshot: %w", err)
+	} else if err := setJournalModeDelete(tmpPath); err != nil {
+		return fmt.Errorf("cannot set journal mode: %w", err)
+	}
+	f.setPos(Pos{Generation: generation, Index: snapshotIndex})
+
+	// Catch up on the temporary database so readers never see stale data.
+	h, err := openFollowHandle(tmpPath)
+	if err != nil {
+		return err
+	} else if err := f.apply(ctx, h); err != nil {
+		_ = h.Close()
+		return err
+	} else if err := h.Close(); err != nil {
+		return err
+	}
+
+	// Mark state as dirty until the new database is in place.
+	if err := f.writeState(true); err != nil {
+		return err
+	} else if err := os.Rename(tmpPath, f.OutputPath); err != nil {
+		return err
+	} else if err := f.writeState(false); err != nil {
+		return err
+	}
+
+	if h, err = openFollowHandle(f.OutputPath); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.h = h
+	f.mu.Unlock()
+
+	f.restoreCounter.Inc()
+	f.Logger.Info("restore complete", "position", f.Pos().String())
+	return nil
+}
+
+// apply applies all available WAL segments after the current position.
+func (f *Follower) apply(ctx context.Context, h *followHandle) error {
+	pos := f.Pos()
+
+	itr, err := f.Replica.Client.WALSegments(ctx, pos.Generation)
+	if err != nil {
+		return err
+	}
+	infos, err := SliceWALSegmentIterator(itr)
+	if err != nil {
+		return err
+	}
+	sort.Sort(WALSegmentInfoSlice(infos))
+
+	// Only keep segments that have not been applied.
+	var covering WALSegmentInfo
+	pending := infos[:0]
+	for _, info := range infos {
+		if info.Index > pos.Index || (info.Index == pos.Index && info.Offset >= pos.Offset) {
+			pending = append(pending, info)
+		} else if info.Index == pos.Index {
+			covering = info
+		}
+	}
+
+	// Segments may be merged by compaction after they were partially applied
+	// so a segment may no longer start at the current position. Re-read the
+	// segment before it, unless it was the last one applied, & skip the data
+	// that has already been applied.
+	if covering.Generation != "" && len(pending) > 0 && pending[0].Pos() != pos && covering != f.last {
+		pending = append([]WALSegmentInfo{covering}, pending...)
+	}
+
+	for i, info := range pending {
+		f.setLag(pending[i:])
+
+		// Segments must contain the current position or start the next WAL.
+		pos := f.Pos()
+		offset := pos.Offset
+		if info.Index == pos.Index+1 && info.Offset == 0 {
+			offset = 0
+		} else if info.Index != pos.Index || info.Offset > pos.Offset {
+			return fmt.Errorf("%w: expected %s, found %s", errWALSegmentGap, pos, info.Pos())
+		}
+
+		// Frames before an invalid frame are still applied so the position
+		// advances up to the invalid frame before the error is returned.
+		n, err := f.applyWALSegment(ctx, h, info, offset)
+		if err != nil && n == 0 {
+			return fmt.Errorf("cannot apply wal segment %s: %w", info.Pos(), err)
+		} else if err == nil {
+			f.last = info
+		}
+
+		f.setPos(Pos{Generation: info.Generation, Index: info.Index, Offset: info.Offset + n})
+		if h == f.h {
+			if err := f.writeState(false); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("cannot apply wal segment %s: %w", info.Pos(), err)
+		}
+		f.Logger.Debug("applied wal segment", "position", f.Pos().String())
+	}
+	f.setLag(nil)
+
+	return nil
+}
+
+// applyWALSegment writes the pages from a WAL segment, starting at the WAL
+// offset, to the database while holding an exclusive lock. Frames are verified
+// against the WAL header salt & running checksum & only the committed frames
+// before the first invalid frame are written. Returns the uncompressed size of
+// the segment, or the size up to the last written frame if a frame is invalid.
+func (f *Follower) applyWALSegment(ctx context.Context, h *followHandle, info WALSegmentInfo, offset int64) (int64, error) {
+	buf, err := f.readWALSegment(ctx, info.Pos())
+	if err != nil {
+		return 0, err
+	}
+
+	// Skip the WAL header at the start of each WAL file. The checksum chain
+	// starts from the header, otherwise it continues from the last frame.
+	var chain walChain
+	frames := buf
+	if info.Offset == 0 {
+		if len(frames) < WALHeaderSize {
+			return 0, fmt.Errorf("short wal header")
+		} else if pageSize := int(binary.BigEndian.Uint32(frames[8:])); pageSize != h.pageSize {
+			return 0, fmt.Errorf("page size mismatch: wal=%d db=%d", pageSize, h.pageSize)
+		} else if chain, err = newWALChain(info.Pos(), frames[:WALHeaderSize]); err != nil {
+			return 0, err
+		}
+		frames = frames[WALHeaderSize:]
+	}
+
+	// Skip frames that were applied from segments since merged into this one.
+	if skip := offset - max(info.Offset, WALHeaderSize); skip > 0 {
+		if skip > int64(len(frames)) {
+			return 0, fmt.Errorf("%w: segment ends before offset %d", errWALSegmentGap, offset)
+		} else if info.Offset == 0 {
+			if _, err := chain.verify(frames[:skip], h.pageSize); err != nil {
+				return 0, err
+			}
+		}
+		frames = frames[skip:]
+	}
+	if info.Offset != 0 {
+		if chain, err = f.walChainAt(ctx, Pos{Generation: info.Generation, Index: info.Index, Offset: offset}, h.pageSize); err != nil {
+			return 0, err
+		}
+	}
+
+	frameSize := WALFrameHeaderSize + h.pageSize
+	if len(frames)%frameSize != 0 {
+		return 0, fmt.Errorf("wal segment not frame aligned")
+	}
+
+	// Only write frames up to the last commit before the first invalid frame.
+	n, verr := chain.verify(frames, h.pageSize)
+	if n > 0 {
+		// Mark state as dirty so an interrupted write forces a restore on restart.
+		if h == f.h {
+			if err := f.writeState(true); err != nil {
+				return 0, err
+			}
+		}
+		if err := h.writeFrames(ctx, frames[:n]); err != nil {
+			return 0, err
+		}
+	}
+	f.chain = chain
+
+	if verr != nil {
+		if chain.pos.Offset <= offset {
+			return 0, verr
+		}
+		return chain.pos.Offset - info.Offset, verr
+	}
+	return int64(len(buf)), nil
+}
+
+// readWALSegment returns the decrypted & uncompressed contents of a segment.
+func (f *Follower) readWALSegment(ctx context.Context, pos Pos) ([]byte, error) {
+	rd, err := f.Replica.openWALSegment(ctx, pos)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	return io.ReadAll(rd)
+}
+
+// walChainAt returns the WAL checksum chain at pos. The chain is rebuilt from
+// the start of the WAL if pos is not the last applied position, such as after
+// a restart.
+func (f *Follower) walChainAt(ctx context.Context, pos Pos, pageSize int) (walChain, error) {
+	if f.chain.pos == pos {
+		return f.chain, nil
+	}
+
+	itr, err := f.Replica.Client.WALSegments(ctx, pos.Generation)
+	if err != nil {
+		return walChain{}, err
+	}
+	infos, err := SliceWALSegmentIterator(itr)
+	if err != nil {
+		return walChain{}, err
+	}
+	sort.Sort(WALSegmentInfoSlice(infos))
+
+	var chain walChain
+	var offset int64
+	for _, info := range infos {
+		if info.Index != pos.Index || offset >= pos.Offset {
+			continue
+		} else if info.Offset > offset {
+			return walChain{}, fmt.Errorf("%w: expected %s, found %s", errWALSegmentGap, Pos{Generation: pos.Generation, Index: pos.Index, Offset: offset}, info.Pos())
+		}
+
+		buf, err := f.readWALSegment(ctx, info.Pos())
+		if err != nil {
+			return walChain{}, err
+		} else if info.Offset+int64(len(buf)) <= offset {
+			continue // overlapped by segments already read
+		}
+
+		if offset == 0 {
+			if len(buf) < WALHeaderSize {
+				return walChain{}, fmt.Errorf("short wal header")
+			} else if chain, err = newWALChain(info.Pos(), buf[:WALHeaderSize]); err != nil {
+				return walChain{}, err
+			}
+			offset = WALHeaderSize
+		}
+
+		frames := buf[offset-info.Offset:]
+		if offset+int64(len(frames)) > pos.Offset {
+			frames = frames[:pos.Offset-offset]
+		}
+		if _, err := chain.verify(frames, pageSize); err != nil {
+			return walChain{}, err
+		}
+		offset = chain.pos.Offset
+	}
+
+	if offset != pos.Offset {
+		return walChain{}, fmt.Errorf("%w: wal ends before %s", errWALSegmentGap, pos)
+	}
+	return chain, nil
+}
+
+func (f *Follower) setPos(pos Pos) {
+	f.mu.Lock()
+	f.pos = pos
+	f.mu.Unlock()
+
+	f.walIndexGauge.Set(float64(pos.Index))
+	f.walOffsetGauge.Set(float64(pos.Offset))
+}
+
+// setLag sets the lag based on the oldest of the pending segments.
+func (f *Follower) setLag(pending []WALSegmentInfo) {
+	var lag time.Duration
+	for _, info := range pending {
+		if d := time.Since(info.CreatedAt); d > lag {
+			lag = d
+		}
+	}
+
+	f.mu.Lock()
+	f.lag = lag
+	f.mu.Unlock()
+
+	f.lagGauge.Set(lag.Seconds())
+}
+
+// readState returns the follower state stored next to the output path.
+// Returns nil if no state exists.
+func (f *Follower) readState() (*followState, error) {
+	buf, err := os.ReadFile(f.OutputPath + FollowStateSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var state followState
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return nil, fmt.Errorf("cannot decode follow state: %w", err)
+	}
+	return &state, nil
+}
+
+// writeState atomically writes the current position to the state file.
+func (f *Follower) writeState(dirty bool) error {
+	pos := f.Pos()
+	buf, err := json.Marshal(followState{
+		Generation: pos.Generation,
+		Index:      pos.Index,
+		Offset:     pos.Offset,
+		Dirty:      dirty,
+	})
+	if err != nil {
+		return err
+	}
+
+	filename := f.OutputPath + FollowStateSuffix
+	file, err := os.Create(filename + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(buf); err != nil {
+		return err
+	} else if err := file.Sync(); err != nil {
+		return err
+	} else if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// followState is the on-disk state of a follower.
+type followState struct {
+	Generation string `json:"generation"`
+	Index      int    `json:"index"`
+	Offset     int64  `json:"offset"`
+	Dirty      bool   `json:"dirty,omitempty"`
+}
+
+// Pos returns the position stored in the state.
+func (s *followState) Pos() Pos {
+	return Pos{Generation: s.Generation, Index: s.Index, Offset: s.Offset}
+}
+
+// walChain is the salt & running checksum of a WAL at a position. Followers
+// verify each frame against the chain before writing it to the database.
+type walChain struct {
+	pos              Pos
+	bo               binary.ByteOrder
+	salt0, salt1     uint32
+	chksum0, chksum1 uint32
+}
+
+// newWALChain returns the chain following the WAL header, hdr, at pos.
+func newWALChain(pos Pos, hdr []byte) (walChain, error) {
+	bo, err := headerByteOrder(hdr)
+	if err != nil {
+		return walChain{}, err
+	}
+
+	chain := walChain{
+		pos:   Pos{Generation: pos.Generation, Index: pos.Index, Offset: WALHeaderSize},
+		bo:    bo,
+		salt0: binary.BigEndian.Uint32(hdr[16:]),
+		salt1: binary.BigEndian.Uint32(hdr[20:]),
+	}
+	chain.chksum0, chain.chksum1 = Checksum(bo, 0, 0, hdr[:24])
+	if chain.chksum0 != binary.BigEndian.Uint32(hdr[24:]) || chain.chksum1 != binary.BigEndian.Uint32(hdr[28:]) {
+		return walChain{}, fmt.Errorf("wal header checksum mismatch")
+	}
+	return chain, nil
+}
+
+// verify checks the salt & checksum of each frame & advances the chain past
+// the last commit frame before the first invalid frame. Returns the number of
+// bytes of frames the chain advanced by.
+func (c *walChain) verify(frames []byte, pageSize int) (int, error) {
+	frameSize := WALFrameHeaderSize + pageSize
+	offset := c.pos.Offset
+	chksum0, chksum1 := c.chksum0, c.chksum1
+
+	var n int
+	for i := 0; i < len(frames); i += frameSize {
+		if i+frameSize > len(frames) {
+			return n, fmt.Errorf("wal segment not frame aligned")
+		}
+		frame := frames[i : i+frameSize]
+
+		if binary.BigEndian.Uint32(frame[8:]) != c.salt0 || binary.BigEndian.Uint32(frame[12:]) != c.salt1 {
+			return n, fmt.Errorf("wal frame salt mismatch at offset %d", offset+int64(i))
+		}
+
+		chksum0, chksum1 = Checksum(c.bo, chksum0, chksum1, frame[:8])
+		chksum0, chksum1 = Checksum(c.bo, chksum0, chksum1, frame[WALFrameHeaderSize:])
+		if chksum0 != binary.BigEndian.Uint32(frame[16:]) || chksum1 != binary.BigEndian.Uint32(frame[20:]) {
+			return n, fmt.Errorf("wal frame checksum mismatch at offset %d", offset+int64(i))
+		}
+
+		// Only advance the chain on commit frames.
+		if binary.BigEndian.Uint32(frame[4:]) != 0 {
+			n = i + frameSize
+			c.pos.Offset, c.chksum0, c.chksum1 = offset+int64(n), chksum0, chksum1
+		}
+	}
+
+	if n < len(frames) {
+		return n, fmt.Errorf("wal segment does not end with a commit")
+	}
+	return n, nil
+}
+
+// followHandle holds a SQLite connection for locking & a file descriptor for
+// writing pages. The file descriptor is held open for the life of the handle
+// since closing any descriptor releases the process's POSIX locks on the file.
+type followHandle struct {
+	db       *sql.DB
+	f        *os.File
+	pageSize int
+}
+
+func openFollowHandle(path string) (_ *followHandle, err error) {
+	h := &followHandle{}
+	defer func() {
+		if err != nil {
+			_ = h.Close()
+		}
+	}()
+
+	if h.f, err = os.OpenFile(path, os.O_RDWR, 0); err != nil {
+		return nil, err
+	}
+
+	hdr := make([]byte, 100)
+	if _, err := io.ReadFull(h.f, hdr); err != nil {
+		return nil, fmt.Errorf("cannot read database header: %w", err)
+	}
+	if h.pageSize = int(binary.BigEndian.Uint16(hdr[16:])); h.pageSize == 1 {
+		h.pageSize = 65536
+	}
+
+	dsn := fmt.Sprintf("%s?_busy_timeout=%d&_txlock=exclusive", path, BusyTimeout.Milliseconds())
+	if h.db, err = sql.Open("sqlite3", dsn); err != nil {
+		return nil, err
+	}
+	h.db.SetMaxOpenConns(1)
+
+	return h, nil
+}
+
+// Close closes the SQLite connection & the file descriptor.
+func (h *followHandle) Close() (err error) {
+	if h.db != nil {
+		if e := h.db.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	if h.f != nil {
+		if e := h.f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// writeFrames writes WAL frames to the database file under an exclusive lock.
+func (h *followHandle) writeFrames(ctx context.Context, frames []byte) error {
+	// Obtain an exclusive lock so no readers observe a partial write.
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Read the change counter before writing pages since page 1 from the WAL
+	// may carry a counter that readers have already seen.
+	hdr := make([]byte, 100)
+	if _, err := h.f.ReadAt(hdr, 0); err != nil {
+		return fmt.Errorf("cannot read database header: %w", err)
+	}
+	changeN := binary.BigEndian.Uint32(hdr[24:]) + 1
+
+	var commit uint32
+	frameSize := WALFrameHeaderSize + h.pageSize
+	for i := 0; i < len(frames); i += frameSize {
+		pgno := binary.BigEndian.Uint32(frames[i:])
+		commit = binary.BigEndian.Uint32(frames[i+4:])
+		page := frames[i+WALFrameHeaderSize : i+frameSize]
+
+		// Keep the database in rollback journal mode.
+		if pgno == 1 {
+			page[18], page[19] = 1, 1
+		}
+
+		if _, err := h.f.WriteAt(page, int64(pgno-1)*int64(h.pageSize)); err != nil {
+			return err
+		}
+	}
+
+	if commit > 0 {
+		if err := h.f.Truncate(int64(commit) * int64(h.pageSize)); err != nil {
+			return err
+		}
+	}
+
+	// Update change counter & in-header database size so readers invalidate
+	// their caches. The version-valid-for number must match the counter.
+	binary.BigEndian.PutUint32(hdr[24:], changeN)
+	if commit > 0 {
+		binary.BigEndian.PutUint32(hdr[28:], commit)
+	} else if _, err := h.f.ReadAt(hdr[28:32], 28); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(hdr[92:], changeN)
+	if _, err := h.f.WriteAt(hdr[24:32], 24); err != nil {
+		return err
+	} else if _, err := h.f.WriteAt(hdr[92:96], 92); err != nil {
+		return err
+	} else if err := h.f.Sync(); err != nil {
+		return err
+	}
+
+	return tx.Rollback()
+}
+
+// setJournalModeDelete switches a database to rollback journal mode.
+func setJournalModeDelete(path string) error {
+	d, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	var mode string
+	if err := d.QueryRow(`PRAGMA journal_mode = DELETE`).Scan(&mode); err != nil {
+		return err
+	} else if mode != "delete" {
+		return fmt.Errorf("unexpected journal mode: %q", mode)
+	}
+	return d.Close()
+}
+
+// removeFollowFiles removes a database & its auxiliary files, if they exist.
+func removeFollowFiles(path string) error {
+	for _, filename := range []string{path, path + "-journal", path + "-wal", path + "-shm"} {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Follower metrics.
+var (
+	followLagGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "litestream",
+		Subsystem: "follow",
+		Name:      "lag_seconds",
+		Help:      "Age of the oldest WAL segment not yet applied",
+	}, []string{"path"})
+
+	followWALIndexGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "litestream",
+		Subsystem: "follow",
+		Name:      "wal_index",
+		Help:      "The last applied WAL index",
+	}, []string{"path"})
+
+	followWALOffsetGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "litestream",
+		Subsystem: "follow",
+		Name:      "wal_offset",
+		Help:      "The last applied WAL offset",
+	}, []string{"path"})
+
+	followRestoreTotalCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "litestream",
+		Subsystem: "follow",
+		Name:      "restore_total",
+		Help:      "The number of full restores performed",
+	}, []string{"path"})
+)
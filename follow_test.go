@@ -0,0 +1,313 @@
+package litestream_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/file"
+	"github.com/pierrec/lz4/v4"
+)
+
+func TestFollower_Sync(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := file.NewReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "")
+		c.Replica, r.Client = r, c
+
+		// Write data, sync & snapshot.
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('a');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Initial sync should restore the database.
+		outputPath := filepath.Join(t.TempDir(), "db")
+		f := litestream.NewFollower(litestream.NewReplica(nil, ""), outputPath)
+		f.Replica.Client = c
+		if err := f.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		// Open a long-lived reader to ensure it sees subsequent changes.
+		reader, err := sql.Open("sqlite3", "file:"+outputPath+"?mode=ro")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+		if got, want := mustQueryFoo(t, reader), "a"; got != want {
+			t.Fatalf("foo=%q, want %q", got, want)
+		}
+
+		// Write more data & ensure it is applied incrementally.
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('b');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := f.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := mustQueryFoo(t, reader), "a,b"; got != want {
+			t.Fatalf("foo=%q, want %q", got, want)
+		} else if got, want := f.Pos(), r.Pos(); got != want {
+			t.Fatalf("Pos()=%s, want %s", got, want)
+		} else if f.Lag() != 0 {
+			t.Fatalf("unexpected lag: %s", f.Lag())
+		}
+
+		// Checkpoint to start a new WAL index & ensure it is applied.
+		if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+			t.Fatal(err)
+		} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('c');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := f.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := mustQueryFoo(t, reader), "a,b,c"; got != want {
+			t.Fatalf("foo=%q, want %q", got, want)
+		}
+
+		var result string
+		if err := reader.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+			t.Fatal(err)
+		} else if result != "ok" {
+			t.Fatalf("integrity check: %s", result)
+		}
+
+		// Ensure a new follower resumes from the saved position.
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f = litestream.NewFollower(litestream.NewReplica(nil, ""), outputPath)
+		f.Replica.Client = c
+		if err := f.Open(); err != nil {
+			t.Fatal(err)
+		} else if got, want := f.Pos(), r.Pos(); got != want {
+			t.Fatalf("Pos()=%s, want %s", got, want)
+		}
+	})
+
+	// Ensure data is not skipped when a partially applied WAL index is merged
+	// into a single segment by compaction.
+	t.Run("Compacted", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := file.NewReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "")
+		c.Replica, r.Client = r, c
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if _, err := sqldb.Exec(`CREATE TABLE baz (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+		mustFollowExec(t, db, sqldb, r, `INSERT INTO foo (bar) VALUES ('a');`)
+
+		outputPath := filepath.Join(t.TempDir(), "db")
+		f := litestream.NewFollower(litestream.NewReplica(nil, ""), outputPath)
+		f.Replica.Client = c
+		if err := f.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		// Apply part of the WAL index before it is compacted.
+		mustFollowExec(t, db, sqldb, r, `INSERT INTO foo (bar) VALUES ('b');`)
+		if err := f.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Write to a separate page so later frames do not overwrite it.
+		mustFollowExec(t, db, sqldb, r, `INSERT INTO baz (bar) VALUES ('c');`)
+
+		// Start a new WAL index so the previous one can be compacted.
+		if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+			t.Fatal(err)
+		}
+		mustFollowExec(t, db, sqldb, r, `INSERT INTO foo (bar) VALUES ('d');`)
+		if n, err := r.CompactWAL(context.Background(), r.Pos().Generation, 0); err != nil {
+			t.Fatal(err)
+		} else if n == 0 {
+			t.Fatal("expected segments to be removed")
+		}
+
+		if err := f.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := f.Pos(), r.Pos(); got != want {
+			t.Fatalf("Pos()=%s, want %s", got, want)
+		}
+
+		reader, err := sql.Open("sqlite3", "file:"+outputPath+"?mode=ro")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		var baz string
+		if got, want := mustQueryFoo(t, reader), "a,b,d"; got != want {
+			t.Fatalf("foo=%q, want %q", got, want)
+		} else if err := reader.QueryRow(`SELECT group_concat(bar) FROM baz`).Scan(&baz); err != nil {
+			t.Fatal(err)
+		} else if got, want := baz, "c"; got != want {
+			t.Fatalf("baz=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure frames after an invalid frame in a segment are not applied.
+	t.Run("ErrChecksumMismatch", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := file.NewReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "")
+		c.Replica, r.Client = r, c
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+		mustFollowExec(t, db, sqldb, r, `INSERT INTO foo (bar) VALUES ('a');`)
+
+		outputPath := filepath.Join(t.TempDir(), "db")
+		f := litestream.NewFollower(litestream.NewReplica(nil, ""), outputPath)
+		f.Replica.Client = c
+		if err := f.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		prev := f.Pos()
+
+		// Write two transactions to a single segment & corrupt the last frame.
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('b');`); err != nil {
+			t.Fatal(err)
+		}
+		mustFollowExec(t, db, sqldb, r, `INSERT INTO foo (bar) VALUES ('c');`)
+		mustCorruptLastWALSegment(t, c, r.Pos().Generation)
+
+		if err := f.Sync(context.Background()); err == nil || !strings.Contains(err.Error(), "wal frame checksum mismatch") {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got := f.Pos(); got.Index != prev.Index || got.Offset <= prev.Offset || got.Offset >= r.Pos().Offset {
+			t.Fatalf("unexpected position: %s", got)
+		}
+
+		reader, err := sql.Open("sqlite3", "file:"+outputPath+"?mode=ro")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+		if got, want := mustQueryFoo(t, reader), "a,b"; got != want {
+			t.Fatalf("foo=%q, want %q", got, want)
+		}
+
+		// Ensure a restarted follower rebuilds the checksum chain & stops at
+		// the same frame when the corrupt segment is read again.
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		mustFollowExec(t, db, sqldb, r, `INSERT INTO foo (bar) VALUES ('d');`)
+		f = litestream.NewFollower(litestream.NewReplica(nil, ""), outputPath)
+		f.Replica.Client = c
+		if err := f.Sync(context.Background()); err == nil || !strings.Contains(err.Error(), "wal frame checksum mismatch") {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := mustQueryFoo(t, reader), "a,b"; got != want {
+			t.Fatalf("foo=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure an existing database not created by a follower is not overwritten.
+	t.Run("ErrOutputExists", func(t *testing.T) {
+		db := MustOpenDB(t)
+		defer MustCloseDB(t, db)
+
+		sqldb := MustOpenSQLDB(t, db.Path())
+		defer MustCloseSQLDB(t, sqldb)
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+
+		f := litestream.NewFollower(litestream.NewReplica(nil, ""), db.Path())
+		if err := f.Open(); err == nil || !strings.Contains(err.Error(), "output path already exists") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func mustQueryFoo(tb testing.TB, d *sql.DB) string {
+	tb.Helper()
+	var s string
+	if err := d.QueryRow(`SELECT group_concat(bar) FROM (SELECT bar FROM foo ORDER BY bar)`).Scan(&s); err != nil {
+		tb.Fatal(err)
+	}
+	return s
+}
+
+// mustFollowExec executes a query & syncs it to the replica.
+func mustFollowExec(tb testing.TB, db *litestream.DB, sqldb *sql.DB, r *litestream.Replica, query string) {
+	tb.Helper()
+	if _, err := sqldb.Exec(query); err != nil {
+		tb.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		tb.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// mustCorruptLastWALSegment flips a byte in the last page of the last WAL
+// segment of generation.
+func mustCorruptLastWALSegment(tb testing.TB, c *file.ReplicaClient, generation string) {
+	tb.Helper()
+
+	itr, err := c.WALSegments(context.Background(), generation)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	infos, err := litestream.SliceWALSegmentIterator(itr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sort.Sort(litestream.WALSegmentInfoSlice(infos))
+	info := infos[len(infos)-1]
+
+	rc, err := c.WALSegmentReader(context.Background(), info.Pos())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+	buf, err := io.ReadAll(lz4.NewReader(rc))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	buf[len(buf)-1] ^= 0xFF
+
+	var compressed bytes.Buffer
+	zw := lz4.NewWriter(&compressed)
+	if _, err := zw.Write(buf); err != nil {
+		tb.Fatal(err)
+	} else if err := zw.Close(); err != nil {
+		tb.Fatal(err)
+	} else if _, err := c.WriteWALSegment(context.Background(), info.Pos(), &compressed); err != nil {
+		tb.Fatal(err)
+	}
+}
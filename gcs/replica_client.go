@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path"
 	"strings"
@@ -14,12 +15,16 @@ import (
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/internal"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 )
 
 // ReplicaClientType is the client type for this package.
 const ReplicaClientType = "gcs"
 
 var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.SnapshotRangeReader = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
 
 // ReplicaClient is a client for writing snapshots & WAL segments to disk.
 type ReplicaClient struct {
@@ -30,6 +35,19 @@ type ReplicaClient struct {
 	// GCS bucket information
 	Bucket string
 	Path   string
+
+	// Service account credentials, as a path to a JSON key file or as inline
+	// JSON. If neither is set, Application Default Credentials are used.
+	CredentialsPath string
+	CredentialsJSON string
+
+	// Custom API endpoint (e.g. "https://storage.example.com/storage/v1/").
+	Endpoint string
+
+	// Host of a GCS emulator, such as fake-gcs-server (e.g. "localhost:4443").
+	// Requests are sent unauthenticated over HTTP unless a scheme is specified.
+	// Works the same as the STORAGE_EMULATOR_HOST environment variable.
+	EmulatorHost string
 }
 
 // NewReplicaClient returns a new instance of ReplicaClient.
@@ -51,7 +69,12 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 		return nil
 	}
 
-	if c.client, err = storage.NewClient(ctx); err != nil {
+	opts, err := c.clientOptions()
+	if err != nil {
+		return err
+	}
+
+	if c.client, err = storage.NewClient(ctx, opts...); err != nil {
 		return err
 	}
 	c.bkt = c.client.Bucket(c.Bucket)
@@ -59,6 +82,42 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 	return nil
 }
 
+// clientOptions returns the options used to connect to GCS.
+func (c *ReplicaClient) clientOptions() ([]option.ClientOption, error) {
+	if c.CredentialsPath != "" && c.CredentialsJSON != "" {
+		return nil, fmt.Errorf("cannot specify both gcs credentials path & json")
+	} else if c.EmulatorHost != "" && c.Endpoint != "" {
+		return nil, fmt.Errorf("cannot specify both gcs endpoint & emulator host")
+	}
+
+	var opts []option.ClientOption
+	if c.CredentialsPath != "" {
+		opts = append(opts, option.WithCredentialsFile(c.CredentialsPath))
+	}
+	if c.CredentialsJSON != "" {
+		opts = append(opts, option.WithCredentialsJSON([]byte(c.CredentialsJSON)))
+	}
+	if c.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(c.Endpoint))
+	}
+
+	// Emulators do not support authentication so credentials are not sent.
+	if c.EmulatorHost != "" {
+		u := &url.URL{Scheme: "http", Host: c.EmulatorHost}
+		if strings.Contains(c.EmulatorHost, "://") {
+			var err error
+			if u, err = url.Parse(c.EmulatorHost); err != nil {
+				return nil, fmt.Errorf("invalid gcs emulator host: %w", err)
+			}
+		}
+		u.Path = "/storage/v1/"
+
+		opts = []option.ClientOption{option.WithoutAuthentication(), option.WithEndpoint(u.String())}
+	}
+
+	return opts, nil
+}
+
 // Generations returns a list of available generation names.
 func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
 	if err := c.Init(ctx); err != nil {
@@ -197,6 +256,31 @@ func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, i
 	return r, nil
 }
 
+// SnapshotRangeReader returns a reader for size bytes of snapshot data
+// starting at offset.
+func (c *ReplicaClient) SnapshotRangeReader(ctx context.Context, generation string, index int, offset, size int64) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	r, err := c.bkt.Object(key).NewRangeReader(ctx, offset, size)
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot start new range reader for %q: %w", key, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(r.Remain()))
+
+	return r, nil
+}
+
 // DeleteSnapshot deletes a snapshot with the given generation & index.
 func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
 	if err := c.Init(ctx); err != nil {
@@ -308,6 +392,112 @@ func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Po
 	return nil
 }
 
+// GenerationMetaReader returns a reader for the metadata of a generation.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	r, err := c.bkt.Object(key).NewReader(ctx)
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot start new reader for %q: %w", key, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(r.Attrs.Size))
+
+	return r, nil
+}
+
+// WriteGenerationMeta writes the metadata of a generation.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	key, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	w := c.bkt.Object(key).NewWriter(ctx)
+	defer w.Close()
+
+	n, err := io.Copy(w, rd)
+	if err != nil {
+		return err
+	} else if err := w.Close(); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+	return nil
+}
+
+// LeaseReader returns a reader for the replica lease.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	key := litestream.LeasePath(c.Path)
+	r, err := c.bkt.Object(key).NewReader(ctx)
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot start new reader for %q: %w", key, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(r.Attrs.Size))
+
+	return r, nil
+}
+
+// WriteLease writes the replica lease, replacing any existing lease.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	w := c.bkt.Object(litestream.LeasePath(c.Path)).NewWriter(ctx)
+	defer w.Close()
+
+	n, err := io.Copy(w, rd)
+	if err != nil {
+		return err
+	} else if err := w.Close(); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+	return nil
+}
+
+// DeleteLease deletes the replica lease, if it exists.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	key := litestream.LeasePath(c.Path)
+	if err := c.bkt.Object(key).Delete(ctx); err != nil && !isNotExists(err) {
+		return fmt.Errorf("cannot delete lease %q: %w", key, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
 type snapshotIterator struct {
 	generation string
 
@@ -0,0 +1,183 @@
+package gcs_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/benbjohnson/litestream/gcs"
+)
+
+func TestReplicaClient_Type(t *testing.T) {
+	if got, want := gcs.NewReplicaClient().Type(), "gcs"; got != want {
+		t.Fatalf("Type()=%v, want %v", got, want)
+	}
+}
+
+func TestReplicaClient_Init(t *testing.T) {
+	t.Run("ErrCredentialsPathAndJSON", func(t *testing.T) {
+		c := gcs.NewReplicaClient()
+		c.CredentialsPath, c.CredentialsJSON = "/foo.json", "{}"
+		if err := c.Init(context.Background()); err == nil || err.Error() != `cannot specify both gcs credentials path & json` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrEndpointAndEmulatorHost", func(t *testing.T) {
+		c := gcs.NewReplicaClient()
+		c.Endpoint, c.EmulatorHost = "https://storage.example.com/storage/v1/", "localhost:4443"
+		if err := c.Init(context.Background()); err == nil || err.Error() != `cannot specify both gcs endpoint & emulator host` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// Ensure requests are sent unauthenticated to the emulator's JSON API.
+func TestReplicaClient_EmulatorHost(t *testing.T) {
+	t.Run("URL", func(t *testing.T) {
+		s := NewServer(t)
+		c := gcs.NewReplicaClient()
+		c.Bucket, c.Path, c.EmulatorHost = "bkt", "db", s.URL
+		s.MustGenerations(t, c)
+
+		if req := s.LastRequest(); req.URL.Path != "/storage/v1/b/bkt/o" {
+			t.Fatalf("unexpected path: %s", req.URL.Path)
+		} else if auth := req.Header.Get("Authorization"); auth != "" {
+			t.Fatalf("unexpected authorization: %q", auth)
+		}
+	})
+
+	// A host without a scheme defaults to HTTP.
+	t.Run("Host", func(t *testing.T) {
+		s := NewServer(t)
+		c := gcs.NewReplicaClient()
+		c.Bucket, c.Path, c.EmulatorHost = "bkt", "db", strings.TrimPrefix(s.URL, "http://")
+		s.MustGenerations(t, c)
+
+		if req := s.LastRequest(); req.URL.Path != "/storage/v1/b/bkt/o" {
+			t.Fatalf("unexpected path: %s", req.URL.Path)
+		}
+	})
+}
+
+// Ensure service account credentials are used to authenticate requests to a
+// custom endpoint.
+func TestReplicaClient_Credentials(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		s := NewServer(t)
+		c := gcs.NewReplicaClient()
+		c.Bucket, c.Path, c.Endpoint = "bkt", "db", s.URL+"/storage/v1/"
+		c.CredentialsJSON = s.MustCredentialsJSON(t)
+		s.MustGenerations(t, c)
+
+		if req := s.LastRequest(); req.URL.Path != "/storage/v1/b/bkt/o" {
+			t.Fatalf("unexpected path: %s", req.URL.Path)
+		} else if got, want := req.Header.Get("Authorization"), "Bearer TOKEN"; got != want {
+			t.Fatalf("Authorization=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Path", func(t *testing.T) {
+		s := NewServer(t)
+		filename := filepath.Join(t.TempDir(), "credentials.json")
+		if err := os.WriteFile(filename, []byte(s.MustCredentialsJSON(t)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		c := gcs.NewReplicaClient()
+		c.Bucket, c.Path, c.Endpoint = "bkt", "db", s.URL+"/storage/v1/"
+		c.CredentialsPath = filename
+		s.MustGenerations(t, c)
+
+		if got, want := s.LastRequest().Header.Get("Authorization"), "Bearer TOKEN"; got != want {
+			t.Fatalf("Authorization=%q, want %q", got, want)
+		}
+	})
+}
+
+// Server is a fake GCS JSON API & OAuth2 token server. Object listings
+// return a single generation.
+type Server struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	last *http.Request
+}
+
+// NewServer returns a running server that is closed when tb completes.
+func NewServer(tb testing.TB) *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path == "/token" {
+		_, _ = w.Write([]byte(`{"access_token":"TOKEN","token_type":"Bearer","expires_in":3600}`))
+		return
+	}
+
+	s.mu.Lock()
+	s.last = r
+	s.mu.Unlock()
+
+	_, _ = w.Write([]byte(`{"kind":"storage#objects","prefixes":["db/generations/b16ddcf5c697540f/"]}`))
+}
+
+// LastRequest returns the last storage API request received.
+func (s *Server) LastRequest() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// MustGenerations lists generations using c & verifies the server response.
+func (s *Server) MustGenerations(tb testing.TB, c *gcs.ReplicaClient) {
+	tb.Helper()
+
+	if generations, err := c.Generations(context.Background()); err != nil {
+		tb.Fatal(err)
+	} else if got, want := generations, []string{"b16ddcf5c697540f"}; !reflect.DeepEqual(got, want) {
+		tb.Fatalf("Generations()=%v, want %v", got, want)
+	} else if s.LastRequest() == nil {
+		tb.Fatal("expected storage request")
+	}
+}
+
+// MustCredentialsJSON returns service account credentials that fetch tokens
+// from the server.
+func (s *Server) MustCredentialsJSON(tb testing.TB) string {
+	tb.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	buf, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"client_email":   "test@test.iam.gserviceaccount.com",
+		"token_uri":      s.URL + "/token",
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(buf)
+}
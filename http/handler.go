@@ -0,0 +1,477 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/benbjohnson/litestream"
+)
+
+// Token represents a bearer token that is allowed to access the server.
+type Token struct {
+	Value string
+
+	// Database path prefixes that the token can access. A token can access a
+	// prefix if it is equal to or nested under one of these paths. If empty,
+	// the token can access all prefixes.
+	Paths []string
+}
+
+// allows returns true if the token can access the given database prefix.
+func (t *Token) allows(prefix string) bool {
+	if len(t.Paths) == 0 {
+		return true
+	}
+	for _, p := range t.Paths {
+		p = strings.Trim(p, "/")
+		if p == "" || prefix == p || strings.HasPrefix(prefix, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler serves the replica protocol and stores data using replica clients
+// returned from ClientFunc. One client is created & cached per database prefix.
+type Handler struct {
+	mu      sync.Mutex
+	clients map[string]litestream.ReplicaClient
+
+	// Returns the client used to store data for a database prefix.
+	ClientFunc func(prefix string) (litestream.ReplicaClient, error)
+
+	// Tokens allowed to access the server. Authentication is disabled if empty.
+	Tokens []*Token
+
+	// Where to send log messages, defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// NewHandler returns a new instance of Handler.
+func NewHandler(fn func(prefix string) (litestream.ReplicaClient, error)) *Handler {
+	return &Handler{
+		clients:    make(map[string]litestream.ReplicaClient),
+		ClientFunc: fn,
+		Logger:     slog.Default(),
+	}
+}
+
+// Close closes any cached clients that implement io.Closer.
+func (h *Handler) Close() (err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for prefix, client := range h.clients {
+		if c, ok := client.(io.Closer); ok {
+			if e := c.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		delete(h.clients, prefix)
+	}
+	return err
+}
+
+// client returns the cached client for prefix or creates a new one.
+func (h *Handler) client(prefix string) (litestream.ReplicaClient, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if c := h.clients[prefix]; c != nil {
+		return c, nil
+	}
+
+	c, err := h.ClientFunc(prefix)
+	if err != nil {
+		return nil, err
+	}
+	h.clients[prefix] = c
+	return c, nil
+}
+
+// ServeHTTP routes protocol requests to the replica client for the prefix.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, APIPrefix) {
+		h.writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	// Split the database prefix from the replica path. The prefix can contain
+	// any number of segments so we match against the last "generations" segment.
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIPrefix), "/"), "/")
+	i := len(segments) - 1
+	for ; i >= 0; i-- {
+		if segments[i] == "generations" {
+			break
+		}
+	}
+	if i < 0 {
+		h.writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	prefix, rest := strings.Join(segments[:i], "/"), segments[i+1:]
+
+	// Disallow empty & relative segments so a prefix cannot escape its root.
+	for _, s := range segments[:i] {
+		if s == "" || s == "." || s == ".." {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid database prefix"))
+			return
+		}
+	}
+
+	if code, err := h.authorize(r, prefix); err != nil {
+		h.writeError(w, code, err)
+		return
+	}
+
+	client, err := h.client(prefix)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// List generations if no generation is specified.
+	if len(rest) == 0 {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		h.handleGetGenerations(w, r, client)
+		return
+	}
+
+	generation := rest[0]
+	if !litestream.IsGenerationName(generation) {
+		h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid generation name: %q", generation))
+		return
+	}
+
+	switch {
+	case len(rest) == 1:
+		switch r.Method {
+		case http.MethodDelete:
+			h.handleDeleteGeneration(w, r, client, generation)
+		default:
+			h.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		}
+
+	case len(rest) == 2 && rest[1] == "meta.json":
+		switch r.Method {
+		case http.MethodGet:
+			h.handleGetGenerationMeta(w, r, client, generation)
+		case http.MethodPut:
+			h.handlePutGenerationMeta(w, r, client, generation)
+		default:
+			h.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		}
+
+	case len(rest) == 2 && rest[1] == "snapshots":
+		switch r.Method {
+		case http.MethodGet:
+			h.handleGetSnapshots(w, r, client, generation)
+		default:
+			h.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		}
+
+	case len(rest) == 3 && rest[1] == "snapshots":
+		index, err := litestream.ParseSnapshotPath(rest[2])
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			h.handleGetSnapshot(w, r, client, generation, index)
+		case http.MethodPut:
+			h.handlePutSnapshot(w, r, client, generation, index)
+		case http.MethodDelete:
+			h.handleDeleteSnapshot(w, r, client, generation, index)
+		default:
+			h.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		}
+
+	case len(rest) == 2 && rest[1] == "wal":
+		switch r.Method {
+		case http.MethodGet:
+			h.handleGetWALSegments(w, r, client, generation)
+		case http.MethodDelete:
+			h.handleDeleteWALSegments(w, r, client, generation)
+		default:
+			h.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		}
+
+	case len(rest) == 3 && rest[1] == "wal":
+		index, offset, err := litestream.ParseWALSegmentPath(rest[2])
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		pos := litestream.Pos{Generation: generation, Index: index, Offset: offset}
+
+		switch r.Method {
+		case http.MethodGet:
+			h.handleGetWALSegment(w, r, client, pos)
+		case http.MethodPut:
+			h.handlePutWALSegment(w, r, client, pos)
+		default:
+			h.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		}
+
+	default:
+		h.writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+	}
+}
+
+// authorize verifies the request's bearer token can access prefix.
+// Returns the HTTP status code to return on failure.
+func (h *Handler) authorize(r *http.Request, prefix string) (int, error) {
+	if len(h.Tokens) == 0 {
+		return 0, nil
+	}
+
+	value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || value == "" {
+		return http.StatusUnauthorized, fmt.Errorf("bearer token required")
+	}
+
+	var token *Token
+	for _, t := range h.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Value), []byte(value)) == 1 {
+			token = t
+			break
+		}
+	}
+
+	if token == nil {
+		return http.StatusUnauthorized, fmt.Errorf("invalid token")
+	} else if !token.allows(prefix) {
+		return http.StatusForbidden, fmt.Errorf("token cannot access database prefix: %q", prefix)
+	}
+	return 0, nil
+}
+
+func (h *Handler) handleGetGenerations(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient) {
+	generations, err := client.Generations(r.Context())
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+
+	if generations == nil {
+		generations = []string{}
+	}
+	h.writeJSON(w, &GenerationsResponse{Generations: generations})
+}
+
+func (h *Handler) handleDeleteGeneration(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string) {
+	if err := client.DeleteGeneration(r.Context(), generation); err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetGenerationMeta returns the metadata of a generation. Returns a 404
+// if the underlying client does not store metadata.
+func (h *Handler) handleGetGenerationMeta(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string) {
+	mc, ok := litestream.UnwrapClient[litestream.GenerationMetaClient](client)
+	if !ok {
+		h.writeError(w, http.StatusNotFound, fmt.Errorf("%s client does not support generation metadata", client.Type()))
+		return
+	}
+
+	rc, err := mc.GenerationMetaReader(r.Context(), generation)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	h.writeBody(w, rc)
+}
+
+func (h *Handler) handlePutGenerationMeta(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string) {
+	mc, ok := litestream.UnwrapClient[litestream.GenerationMetaClient](client)
+	if !ok {
+		h.writeError(w, http.StatusNotImplemented, fmt.Errorf("%s client does not support generation metadata", client.Type()))
+		return
+	}
+
+	if err := mc.WriteGenerationMeta(r.Context(), generation, r.Body); err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleGetSnapshots(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string) {
+	itr, err := client.Snapshots(r.Context(), generation)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	defer itr.Close()
+
+	infos, err := litestream.SliceSnapshotIterator(itr)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+
+	resp := SnapshotsResponse{Snapshots: make([]SnapshotInfo, 0, len(infos))}
+	for _, info := range infos {
+		resp.Snapshots = append(resp.Snapshots, SnapshotInfo{
+			Index:     info.Index,
+			Size:      info.Size,
+			CreatedAt: info.CreatedAt,
+		})
+	}
+	h.writeJSON(w, &resp)
+}
+
+func (h *Handler) handleGetSnapshot(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string, index int) {
+	rc, err := client.SnapshotReader(r.Context(), generation, index)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	h.writeBody(w, rc)
+}
+
+func (h *Handler) handlePutSnapshot(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string, index int) {
+	info, err := client.WriteSnapshot(r.Context(), generation, index, r.Body)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+
+	h.writeJSON(w, &SnapshotInfo{
+		Index:     info.Index,
+		Size:      info.Size,
+		CreatedAt: info.CreatedAt,
+	})
+}
+
+func (h *Handler) handleDeleteSnapshot(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string, index int) {
+	if err := client.DeleteSnapshot(r.Context(), generation, index); err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleGetWALSegments(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string) {
+	itr, err := client.WALSegments(r.Context(), generation)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	defer itr.Close()
+
+	infos, err := litestream.SliceWALSegmentIterator(itr)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+
+	resp := WALSegmentsResponse{WALSegments: make([]WALSegmentInfo, 0, len(infos))}
+	for _, info := range infos {
+		resp.WALSegments = append(resp.WALSegments, WALSegmentInfo{
+			Index:     info.Index,
+			Offset:    info.Offset,
+			Size:      info.Size,
+			CreatedAt: info.CreatedAt,
+		})
+	}
+	h.writeJSON(w, &resp)
+}
+
+func (h *Handler) handleDeleteWALSegments(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, generation string) {
+	var req DeleteWALSegmentsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	a := make([]litestream.Pos, len(req.Positions))
+	for i, pos := range req.Positions {
+		a[i] = litestream.Pos{Generation: generation, Index: pos.Index, Offset: pos.Offset}
+	}
+
+	if err := client.DeleteWALSegments(r.Context(), a); err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleGetWALSegment(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, pos litestream.Pos) {
+	rc, err := client.WALSegmentReader(r.Context(), pos)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	h.writeBody(w, rc)
+}
+
+func (h *Handler) handlePutWALSegment(w http.ResponseWriter, r *http.Request, client litestream.ReplicaClient, pos litestream.Pos) {
+	info, err := client.WriteWALSegment(r.Context(), pos, r.Body)
+	if err != nil {
+		h.writeClientError(w, err)
+		return
+	}
+
+	h.writeJSON(w, &WALSegmentInfo{
+		Index:     info.Index,
+		Offset:    info.Offset,
+		Size:      info.Size,
+		CreatedAt: info.CreatedAt,
+	})
+}
+
+// writeBody streams rc to the response as an octet stream.
+func (h *Handler) writeBody(w http.ResponseWriter, rc io.Reader) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := io.Copy(w, rc); err != nil {
+		h.Logger.Error("cannot write response body", "error", err)
+	}
+}
+
+// writeJSON writes v as a JSON response body.
+func (h *Handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.Logger.Error("cannot write response body", "error", err)
+	}
+}
+
+// writeClientError writes a replica client error. Missing objects are
+// returned as a 404 and all other errors are logged & returned as a 500.
+func (h *Handler) writeClientError(w http.ResponseWriter, err error) {
+	if os.IsNotExist(err) || errors.Is(err, os.ErrNotExist) {
+		h.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	h.Logger.Error("replica client error", "error", err)
+	h.writeError(w, http.StatusInternalServerError, err)
+}
+
+// writeError writes err as a JSON error response with the given status code.
+func (h *Handler) writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(&ErrorResponse{Error: err.Error()})
+}
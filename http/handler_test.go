@@ -0,0 +1,97 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	lshttp "github.com/benbjohnson/litestream/http"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestHandler_GenerationMeta(t *testing.T) {
+	h := lshttp.NewHandler(func(prefix string) (litestream.ReplicaClient, error) {
+		return memory.NewReplicaClient(), nil
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c := lshttp.NewReplicaClient()
+	c.Endpoint, c.Path = s.URL, "db"
+
+	if _, err := c.GenerationMetaReader(context.Background(), "0123456789abcdef"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := c.WriteGenerationMeta(context.Background(), "0123456789abcdef", strings.NewReader(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := c.GenerationMetaReader(context.Background(), "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if buf, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `{}`; got != want {
+		t.Fatalf("meta=%s, want %s", got, want)
+	}
+}
+
+func TestHandler_Auth(t *testing.T) {
+	h := lshttp.NewHandler(func(prefix string) (litestream.ReplicaClient, error) {
+		return memory.NewReplicaClient(), nil
+	})
+	h.Tokens = []*lshttp.Token{
+		{Value: "ALICE", Paths: []string{"alice"}},
+		{Value: "ADMIN"},
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	newClient := func(path, token string) *lshttp.ReplicaClient {
+		c := lshttp.NewReplicaClient()
+		c.Endpoint, c.Path, c.Token = s.URL, path, token
+		return c
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		for _, c := range []*lshttp.ReplicaClient{
+			newClient("alice", "ALICE"),
+			newClient("alice/db", "ALICE"),
+			newClient("bob/db", "ADMIN"),
+		} {
+			if _, err := c.WriteSnapshot(context.Background(), "0123456789abcdef", 0, strings.NewReader("foo")); err != nil {
+				t.Fatalf("%s: %s", c.Path, err)
+			}
+		}
+	})
+
+	t.Run("ErrNoToken", func(t *testing.T) {
+		_, err := newClient("alice", "").Generations(context.Background())
+		if e := (*lshttp.StatusError)(nil); !errors.As(err, &e) || e.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrInvalidToken", func(t *testing.T) {
+		_, err := newClient("alice", "BOB").Generations(context.Background())
+		if e := (*lshttp.StatusError)(nil); !errors.As(err, &e) || e.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrForbiddenPrefix", func(t *testing.T) {
+		for _, path := range []string{"", "bob", "alicex/db"} {
+			_, err := newClient(path, "ALICE").Generations(context.Background())
+			if e := (*lshttp.StatusError)(nil); !errors.As(err, &e) || e.StatusCode != http.StatusForbidden {
+				t.Fatalf("%q: unexpected error: %v", path, err)
+			}
+		}
+	})
+}
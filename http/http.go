@@ -0,0 +1,78 @@
+// Package http implements a small HTTP protocol for replicating to a remote
+// Litestream server. The protocol mirrors the litestream.ReplicaClient
+// interface and uses the same path layout as the file replica:
+//
+//	GET    /v1/PREFIX/generations
+//	DELETE /v1/PREFIX/generations/GEN
+//	GET    /v1/PREFIX/generations/GEN/meta.json
+//	PUT    /v1/PREFIX/generations/GEN/meta.json
+//	GET    /v1/PREFIX/generations/GEN/snapshots
+//	PUT    /v1/PREFIX/generations/GEN/snapshots/INDEX.snapshot.lz4
+//	GET    /v1/PREFIX/generations/GEN/snapshots/INDEX.snapshot.lz4
+//	DELETE /v1/PREFIX/generations/GEN/snapshots/INDEX.snapshot.lz4
+//	GET    /v1/PREFIX/generations/GEN/wal
+//	DELETE /v1/PREFIX/generations/GEN/wal
+//	PUT    /v1/PREFIX/generations/GEN/wal/INDEX_OFFSET.wal.lz4
+//	GET    /v1/PREFIX/generations/GEN/wal/INDEX_OFFSET.wal.lz4
+//
+// PREFIX is an optional, slash-separated path that identifies a database so
+// that multiple databases & tenants can share a single server. Requests are
+// authenticated with a bearer token which may be restricted to a set of
+// prefixes. Listings & errors are encoded as JSON.
+package http
+
+import (
+	"time"
+)
+
+// ReplicaClientType is the client type for this package.
+const ReplicaClientType = "http"
+
+// APIPrefix is the path prefix for all protocol endpoints.
+const APIPrefix = "/v1/"
+
+// GenerationsResponse is the response body for listing generations.
+type GenerationsResponse struct {
+	Generations []string `json:"generations"`
+}
+
+// SnapshotInfo is the wire representation of litestream.SnapshotInfo.
+type SnapshotInfo struct {
+	Index     int       `json:"index"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+// SnapshotsResponse is the response body for listing snapshots.
+type SnapshotsResponse struct {
+	Snapshots []SnapshotInfo `json:"snapshots"`
+}
+
+// WALSegmentInfo is the wire representation of litestream.WALSegmentInfo.
+type WALSegmentInfo struct {
+	Index     int       `json:"index"`
+	Offset    int64     `json:"offset"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+// WALSegmentsResponse is the response body for listing WAL segments.
+type WALSegmentsResponse struct {
+	WALSegments []WALSegmentInfo `json:"wal-segments"`
+}
+
+// Pos is the wire representation of a WAL segment position within a generation.
+type Pos struct {
+	Index  int   `json:"index"`
+	Offset int64 `json:"offset"`
+}
+
+// DeleteWALSegmentsRequest is the request body for deleting WAL segments.
+type DeleteWALSegmentsRequest struct {
+	Positions []Pos `json:"positions"`
+}
+
+// ErrorResponse is the response body returned for any failed request.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,527 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/internal"
+)
+
+// Default settings for replica client.
+const (
+	DefaultTimeout = 30 * time.Second
+)
+
+var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
+
+// ReplicaClient is a client for writing snapshots & WAL segments to a
+// remote "litestream serve" server.
+type ReplicaClient struct {
+	mu     sync.Mutex
+	client *http.Client
+
+	// Server connection info. Endpoint is the base URL of the server
+	// (e.g. "https://backup.local:9090") and Path is the database prefix.
+	Endpoint   string
+	Path       string
+	Token      string
+	SkipVerify bool
+	Timeout    time.Duration
+}
+
+// NewReplicaClient returns a new instance of ReplicaClient.
+func NewReplicaClient() *ReplicaClient {
+	return &ReplicaClient{
+		Timeout: DefaultTimeout,
+	}
+}
+
+// Type returns "http" as the client type.
+func (c *ReplicaClient) Type() string {
+	return ReplicaClientType
+}
+
+// Init initializes the HTTP client. No-op if already initialized.
+func (c *ReplicaClient) Init(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		return nil
+	}
+
+	if c.Endpoint == "" {
+		return fmt.Errorf("http endpoint required")
+	} else if _, err := url.Parse(c.Endpoint); err != nil {
+		return fmt.Errorf("invalid http endpoint: %w", err)
+	}
+
+	// The timeout only applies to connecting & waiting on response headers so
+	// that large uploads & downloads are not interrupted.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: c.Timeout}).DialContext
+	transport.ResponseHeaderTimeout = c.Timeout
+	if c.SkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	c.client = &http.Client{Transport: transport}
+
+	return nil
+}
+
+// Generations returns a list of available generation names.
+func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	var resp GenerationsResponse
+	if err := c.getJSON(ctx, litestream.GenerationsPath(c.Path), &resp); err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+	return resp.Generations, nil
+}
+
+// DeleteGeneration deletes all snapshots & WAL segments within a generation.
+func (c *ReplicaClient) DeleteGeneration(ctx context.Context, generation string) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	dir, err := litestream.GenerationPath(c.Path, generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation path: %w", err)
+	}
+
+	if err := c.delete(ctx, dir, nil); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot delete generation: %w", err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
+// Snapshots returns an iterator over all available snapshots for a generation.
+func (c *ReplicaClient) Snapshots(ctx context.Context, generation string) (litestream.SnapshotIterator, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	dir, err := litestream.SnapshotsPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshots path: %w", err)
+	}
+
+	var resp SnapshotsResponse
+	if err := c.getJSON(ctx, dir, &resp); err != nil {
+		return nil, err
+	}
+
+	infos := make([]litestream.SnapshotInfo, 0, len(resp.Snapshots))
+	for _, info := range resp.Snapshots {
+		infos = append(infos, litestream.SnapshotInfo{
+			Generation: generation,
+			Index:      info.Index,
+			Size:       info.Size,
+			CreatedAt:  info.CreatedAt.UTC(),
+		})
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+	return litestream.NewSnapshotInfoSliceIterator(infos), nil
+}
+
+// WriteSnapshot writes LZ4 compressed data from rd to the server.
+func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (info litestream.SnapshotInfo, err error) {
+	if err := c.Init(ctx); err != nil {
+		return info, err
+	}
+
+	filename, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return info, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	var resp SnapshotInfo
+	n, err := c.put(ctx, filename, rd, &resp)
+	if err != nil {
+		return info, fmt.Errorf("cannot write snapshot: %w", err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+
+	return litestream.SnapshotInfo{
+		Generation: generation,
+		Index:      index,
+		Size:       resp.Size,
+		CreatedAt:  resp.CreatedAt.UTC(),
+	}, nil
+}
+
+// SnapshotReader returns a reader for snapshot data at the given generation/index.
+// Returns os.ErrNotExist if no matching index is found.
+func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	filename, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	rc, err := c.get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	return rc, nil
+}
+
+// DeleteSnapshot deletes a snapshot with the given generation & index.
+func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	filename, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	if err := c.delete(ctx, filename, nil); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot delete snapshot: %w", err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
+// WALSegments returns an iterator over all available WAL files for a generation.
+func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	dir, err := litestream.WALPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine wal path: %w", err)
+	}
+
+	var resp WALSegmentsResponse
+	if err := c.getJSON(ctx, dir, &resp); err != nil {
+		return nil, err
+	}
+
+	infos := make([]litestream.WALSegmentInfo, 0, len(resp.WALSegments))
+	for _, info := range resp.WALSegments {
+		infos = append(infos, litestream.WALSegmentInfo{
+			Generation: generation,
+			Index:      info.Index,
+			Offset:     info.Offset,
+			Size:       info.Size,
+			CreatedAt:  info.CreatedAt.UTC(),
+		})
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+	return litestream.NewWALSegmentInfoSliceIterator(infos), nil
+}
+
+// WriteWALSegment writes LZ4 compressed data from rd to the server.
+func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (info litestream.WALSegmentInfo, err error) {
+	if err := c.Init(ctx); err != nil {
+		return info, err
+	}
+
+	filename, err := litestream.WALSegmentPath(c.Path, pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return info, fmt.Errorf("cannot determine wal segment path: %w", err)
+	}
+
+	var resp WALSegmentInfo
+	n, err := c.put(ctx, filename, rd, &resp)
+	if err != nil {
+		return info, fmt.Errorf("cannot write wal segment: %w", err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+
+	return litestream.WALSegmentInfo{
+		Generation: pos.Generation,
+		Index:      pos.Index,
+		Offset:     pos.Offset,
+		Size:       resp.Size,
+		CreatedAt:  resp.CreatedAt.UTC(),
+	}, nil
+}
+
+// WALSegmentReader returns a reader for a section of WAL data at the given index.
+// Returns os.ErrNotExist if no matching index/offset is found.
+func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	filename, err := litestream.WALSegmentPath(c.Path, pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine wal segment path: %w", err)
+	}
+
+	rc, err := c.get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	return rc, nil
+}
+
+// DeleteWALSegments deletes WAL segments with at the given positions.
+// Positions are grouped by generation and deleted with one request each.
+func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Pos) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	var generations []string
+	m := make(map[string][]Pos)
+	for _, pos := range a {
+		if _, err := litestream.WALSegmentPath(c.Path, pos.Generation, pos.Index, pos.Offset); err != nil {
+			return fmt.Errorf("cannot determine wal segment path: %w", err)
+		}
+
+		if _, ok := m[pos.Generation]; !ok {
+			generations = append(generations, pos.Generation)
+		}
+		m[pos.Generation] = append(m[pos.Generation], Pos{Index: pos.Index, Offset: pos.Offset})
+	}
+
+	for _, generation := range generations {
+		dir, err := litestream.WALPath(c.Path, generation)
+		if err != nil {
+			return fmt.Errorf("cannot determine wal path: %w", err)
+		}
+
+		if err := c.delete(ctx, dir, &DeleteWALSegmentsRequest{Positions: m[generation]}); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot delete wal segments: %w", err)
+		}
+		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Add(float64(len(m[generation])))
+	}
+
+	return nil
+}
+
+// GenerationMetaReader returns a reader for the metadata of a generation.
+// Returns os.ErrNotExist if no metadata exists.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	filename, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	rc, err := c.get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	return rc, nil
+}
+
+// WriteGenerationMeta writes the metadata of a generation.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	filename, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	n, err := c.put(ctx, filename, rd, nil)
+	if err != nil {
+		return fmt.Errorf("cannot write generation metadata: %w", err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+
+	return nil
+}
+
+// urlFor returns the full URL for a protocol path relative to the endpoint.
+func (c *ReplicaClient) urlFor(p string) string {
+	u, _ := url.Parse(c.Endpoint)
+	u.Path = path.Join("/", u.Path, APIPrefix, p)
+	return u.String()
+}
+
+// newRequest returns a new HTTP request with authentication applied.
+func (c *ReplicaClient) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.urlFor(p), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+// do executes req and returns an error for non-2xx responses. A 404 response
+// is converted to os.ErrNotExist. The caller must close the response body.
+func (c *ReplicaClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+
+	// Attach the server's error message, if one was returned.
+	var body ErrorResponse
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body)
+	return nil, &StatusError{Method: req.Method, URL: req.URL.Redacted(), StatusCode: resp.StatusCode, Message: body.Error}
+}
+
+// getJSON decodes the JSON response body for p into v.
+func (c *ReplicaClient) getJSON(ctx context.Context, p string, v any) error {
+	req, err := c.newRequest(ctx, http.MethodGet, p, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("cannot decode response: %w", err)
+	}
+	return nil
+}
+
+// get returns the body of the object at p.
+func (c *ReplicaClient) get(ctx context.Context, p string) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// put uploads the contents of rd to p and decodes the JSON response into v,
+// if v is not nil. Returns the number of bytes written.
+func (c *ReplicaClient) put(ctx context.Context, p string, rd io.Reader, v any) (int64, error) {
+	if rd == nil {
+		rd = bytes.NewReader(nil)
+	}
+	counter := internal.NewReadCounter(rd)
+
+	req, err := c.newRequest(ctx, http.MethodPut, p, counter)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if v == nil {
+		return counter.N(), nil
+	} else if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return 0, fmt.Errorf("cannot decode response: %w", err)
+	}
+	return counter.N(), nil
+}
+
+// delete removes the object or collection at p. If body is not nil then it
+// is sent as the JSON request body.
+func (c *ReplicaClient) delete(ctx context.Context, p string, body any) error {
+	var rd io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(buf)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodDelete, p, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// StatusError is returned when the server returns an unexpected status code.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+// Error returns the string representation of the error.
+func (e *StatusError) Error() string {
+	s := fmt.Sprintf("http: %s %s: unexpected status: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
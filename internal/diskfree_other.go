@@ -0,0 +1,13 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!windows
+
+package internal
+
+import (
+	"errors"
+)
+
+// DiskFree is not supported on this platform.
+func DiskFree(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,18 @@
+//go:build darwin || dragonfly || freebsd || linux
+// +build darwin dragonfly freebsd linux
+
+package internal
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// DiskFree returns the number of bytes available to unprivileged users on
+// the filesystem containing path.
+func DiskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"errors"
 	"io"
 	"os"
 	"syscall"
@@ -127,6 +128,10 @@ func MkdirAll(path string, fi os.FileInfo) error {
 	return nil
 }
 
+// ErrFileWatcherNotSupported is returned when file watching is unavailable on
+// the current platform.
+var ErrFileWatcherNotSupported = errors.New("file watcher not supported on this platform")
+
 // Shared replica metrics.
 var (
 	OperationTotalCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
@@ -0,0 +1,197 @@
+//go:build linux
+// +build linux
+
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// FileWatcher watches files for changes using inotify. Files are watched via
+// their parent directory so that files which are created, deleted or replaced
+// (such as the SQLite WAL) continue to be tracked. A single watcher can be
+// shared by many files to avoid exhausting the per-user inotify instance limit.
+type FileWatcher struct {
+	mu      sync.Mutex
+	f       *os.File
+	dirs    map[string]*watchedDir // by directory path
+	wds     map[int]*watchedDir    // by watch descriptor
+	watches map[string]map[*FileWatch]struct{}
+}
+
+type watchedDir struct {
+	path string
+	wd   int
+	refN int
+}
+
+// NewFileWatcher returns a new, running instance of FileWatcher.
+func NewFileWatcher() (*FileWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &FileWatcher{
+		// Wrapping a non-blocking descriptor registers it with the runtime
+		// poller so that Close() interrupts a pending Read().
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		dirs:    make(map[string]*watchedDir),
+		wds:     make(map[int]*watchedDir),
+		watches: make(map[string]map[*FileWatch]struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops the watcher. Existing watches stop receiving notifications.
+func (w *FileWatcher) Close() error {
+	return w.f.Close()
+}
+
+// Watch returns a watch that is notified whenever any of the given files are
+// created, modified, moved or removed.
+func (w *FileWatcher) Watch(paths ...string) (*FileWatch, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fw := &FileWatch{w: w, ch: make(chan struct{}, 1)}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if err := w.addDir(filepath.Dir(path)); err != nil {
+			w.remove(fw)
+			return nil, err
+		}
+		fw.paths = append(fw.paths, path)
+
+		if w.watches[path] == nil {
+			w.watches[path] = make(map[*FileWatch]struct{})
+		}
+		w.watches[path][fw] = struct{}{}
+	}
+	return fw, nil
+}
+
+// addDir adds an inotify watch for a directory or increments its reference count.
+func (w *FileWatcher) addDir(path string) error {
+	if d := w.dirs[path]; d != nil {
+		d.refN++
+		return nil
+	}
+
+	const mask = unix.IN_MODIFY | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_CLOSE_WRITE
+	wd, err := unix.InotifyAddWatch(int(w.f.Fd()), path, mask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+
+	d := &watchedDir{path: path, wd: wd, refN: 1}
+	w.dirs[path], w.wds[wd] = d, d
+	return nil
+}
+
+// remove unregisters fw & releases any directories no longer referenced.
+func (w *FileWatcher) remove(fw *FileWatch) {
+	for _, path := range fw.paths {
+		delete(w.watches[path], fw)
+		if len(w.watches[path]) == 0 {
+			delete(w.watches, path)
+		}
+
+		d := w.dirs[filepath.Dir(path)]
+		if d == nil {
+			continue
+		} else if d.refN--; d.refN > 0 {
+			continue
+		}
+		_, _ = unix.InotifyRmWatch(int(w.f.Fd()), uint32(d.wd))
+		delete(w.dirs, d.path)
+		delete(w.wds, d.wd)
+	}
+	fw.paths = nil
+}
+
+// run reads events until the watcher is closed.
+func (w *FileWatcher) run() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		} else if err != nil || n < unix.SizeofInotifyEvent {
+			continue
+		}
+
+		w.mu.Lock()
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			if nameEnd > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			offset = nameEnd
+
+			// Notify everyone if the kernel queue overflowed since events were lost.
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				for _, m := range w.watches {
+					for fw := range m {
+						fw.notify()
+					}
+				}
+				continue
+			}
+
+			d := w.wds[int(event.Wd)]
+			if d == nil {
+				continue
+			}
+
+			// Directory was removed so the kernel has dropped the watch.
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(w.dirs, d.path)
+				delete(w.wds, d.wd)
+				continue
+			}
+
+			for fw := range w.watches[filepath.Join(d.path, name)] {
+				fw.notify()
+			}
+		}
+		w.mu.Unlock()
+	}
+}
+
+// FileWatch represents a set of files watched by a FileWatcher.
+type FileWatch struct {
+	w     *FileWatcher
+	ch    chan struct{}
+	paths []string
+}
+
+// C returns a channel that receives a value when a watched file changes.
+// Multiple changes that occur before the channel is read are coalesced.
+func (fw *FileWatch) C() <-chan struct{} { return fw.ch }
+
+// Close stops watching the files.
+func (fw *FileWatch) Close() error {
+	fw.w.mu.Lock()
+	defer fw.w.mu.Unlock()
+	fw.w.remove(fw)
+	return nil
+}
+
+func (fw *FileWatch) notify() {
+	select {
+	case fw.ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package internal
+
+// FileWatcher watches files for changes. It is only supported on Linux.
+type FileWatcher struct{}
+
+// NewFileWatcher returns ErrFileWatcherNotSupported on this platform.
+func NewFileWatcher() (*FileWatcher, error) {
+	return nil, ErrFileWatcherNotSupported
+}
+
+// Close is a no-op.
+func (w *FileWatcher) Close() error { return nil }
+
+// Watch returns ErrFileWatcherNotSupported on this platform.
+func (w *FileWatcher) Watch(paths ...string) (*FileWatch, error) {
+	return nil, ErrFileWatcherNotSupported
+}
+
+// FileWatch represents a set of files watched by a FileWatcher.
+type FileWatch struct{}
+
+// C returns a nil channel.
+func (fw *FileWatch) C() <-chan struct{} { return nil }
+
+// Close is a no-op.
+func (fw *FileWatch) Close() error { return nil }
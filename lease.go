@@ -0,0 +1,262 @@
+package litestream
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Lease represents a writer lease stored in a replica. Only the holder of an
+// unexpired lease may write snapshots & WAL segments to the replica.
+type Lease struct {
+	// Identity of the writer, typically the hostname.
+	Holder string `json:"holder"`
+
+	// Random identifier assigned when the lease is acquired. It is kept across
+	// renewals and used to detect concurrent acquisitions by the same holder.
+	ID string `json:"id"`
+
+	RenewedAt time.Time `json:"renewed-at"`
+	ExpiresAt time.Time `json:"expires-at"`
+}
+
+// Expired returns true if the lease has expired as of t.
+func (l *Lease) Expired(t time.Time) bool {
+	return !t.Before(l.ExpiresAt)
+}
+
+// LeaseHeldError is returned when the replica lease is held by another writer.
+type LeaseHeldError struct {
+	Lease *Lease
+}
+
+// Error implements the error interface.
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("replica lease held by %q until %s", e.Lease.Holder, e.Lease.ExpiresAt.Format(time.RFC3339))
+}
+
+// Unwrap returns ErrLeaseHeld so errors.Is() can be used to check the error.
+func (e *LeaseHeldError) Unwrap() error { return ErrLeaseHeld }
+
+// ReadLease returns the lease currently stored in the replica. Returns nil if
+// no lease exists.
+func (r *Replica) ReadLease(ctx context.Context) (*Lease, error) {
+	client, ok := UnwrapClient[LeaseClient](r.Client)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support leases", r.Client.Type())
+	}
+
+	rc, err := client.LeaseReader(ctx)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	var lease Lease
+	if err := json.NewDecoder(rc).Decode(&lease); err != nil {
+		return nil, fmt.Errorf("cannot decode lease: %w", err)
+	}
+	return &lease, nil
+}
+
+// AcquireLease acquires or renews the writer lease for the replica. Returns a
+// *LeaseHeldError if an unexpired lease is held by another writer or if the
+// lease ID changed since it was last renewed. If force is true then the lease
+// is taken regardless of its current holder.
+func (r *Replica) AcquireLease(ctx context.Context, force bool) error {
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+	return r.acquireLease(ctx, force)
+}
+
+func (r *Replica) acquireLease(ctx context.Context, force bool) (err error) {
+	// The lease is no longer trusted after any error so it is reacquired on
+	// the next sync. Its ID is only forgotten once another writer holds the
+	// lease so that transient errors do not cause us to conflict with our own
+	// lease on the next attempt.
+	defer func() {
+		if err != nil {
+			r.lease = nil
+		}
+		if _, ok := err.(*LeaseHeldError); ok {
+			r.leaseID = ""
+		}
+		r.updateLeaseMetrics(err)
+	}()
+
+	client, ok := UnwrapClient[LeaseClient](r.Client)
+	if !ok {
+		return fmt.Errorf("%s client does not support leases", r.Client.Type())
+	}
+
+	curr, err := r.ReadLease(ctx)
+	if err != nil {
+		return fmt.Errorf("read lease: %w", err)
+	}
+
+	// Stop writing if the lease was taken over or removed since it was last
+	// renewed, even by a writer with the same holder name.
+	now := time.Now()
+	held := r.leaseID != "" && curr != nil && curr.ID == r.leaseID
+	if r.leaseID != "" && !held && !force {
+		if curr == nil {
+			r.leaseID = ""
+			return fmt.Errorf("lease removed since last renewal")
+		}
+		return &LeaseHeldError{Lease: curr}
+	}
+
+	// Refuse to take an unexpired lease from another writer, including another
+	// process using the same holder name.
+	if curr != nil && !held && !curr.Expired(now) && !force {
+		return &LeaseHeldError{Lease: curr}
+	} else if curr != nil && !held {
+		r.Logger().Warn("taking over replica lease", "holder", curr.Holder, "expires", curr.ExpiresAt, "force", force)
+	}
+
+	// Keep our lease ID while renewing so a changed ID can be detected.
+	id := ""
+	if held {
+		id = r.leaseID
+	} else if id, err = generateLeaseID(); err != nil {
+		return err
+	}
+
+	lease := &Lease{
+		Holder:    r.LeaseHolder,
+		ID:        id,
+		RenewedAt: now.UTC(),
+		ExpiresAt: now.Add(r.LeaseTimeout).UTC(),
+	}
+	buf, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	} else if err := client.WriteLease(ctx, bytes.NewReader(buf)); err != nil {
+		return fmt.Errorf("write lease: %w", err)
+	}
+	r.leaseID = id
+
+	// Read the lease back to catch another writer acquiring it concurrently.
+	// This is best-effort; any remaining race is caught on the next renewal.
+	if other, err := r.ReadLease(ctx); err != nil {
+		return fmt.Errorf("verify lease: %w", err)
+	} else if other == nil {
+		r.leaseID = ""
+		return fmt.Errorf("lease removed during acquisition")
+	} else if other.ID != lease.ID {
+		return &LeaseHeldError{Lease: other}
+	}
+
+	r.lease = lease
+	return nil
+}
+
+// renewLease acquires the lease if it is not held or renews it once a third
+// of the lease timeout has elapsed. Does nothing if leases are disabled.
+func (r *Replica) renewLease(ctx context.Context) error {
+	if r.LeaseTimeout <= 0 {
+		return nil
+	}
+
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+
+	if r.lease != nil && time.Since(r.lease.RenewedAt) < r.LeaseTimeout/3 {
+		return nil
+	}
+	return r.acquireLease(ctx, false)
+}
+
+// ReleaseLease deletes the lease from the replica if it is held by this replica.
+func (r *Replica) ReleaseLease(ctx context.Context) error {
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+
+	if r.leaseID == "" {
+		return nil
+	}
+	id := r.leaseID
+	r.lease, r.leaseID = nil, ""
+	r.updateLeaseMetrics(nil)
+
+	// Ensure the lease was not taken over before removing it.
+	if curr, err := r.ReadLease(ctx); err != nil {
+		return err
+	} else if curr == nil || curr.ID != id {
+		return nil
+	}
+
+	client, _ := UnwrapClient[LeaseClient](r.Client)
+	return client.DeleteLease(ctx)
+}
+
+// BreakLease deletes the lease from the replica regardless of its holder.
+func (r *Replica) BreakLease(ctx context.Context) error {
+	client, ok := UnwrapClient[LeaseClient](r.Client)
+	if !ok {
+		return fmt.Errorf("%s client does not support leases", r.Client.Type())
+	}
+	return client.DeleteLease(ctx)
+}
+
+// updateLeaseMetrics sets the lease gauges based on the result of an acquisition.
+func (r *Replica) updateLeaseMetrics(err error) {
+	if r.db == nil {
+		return
+	}
+
+	var held, conflict float64
+	if r.lease != nil {
+		held = 1
+	}
+	if _, ok := err.(*LeaseHeldError); ok {
+		conflict = 1
+	}
+	replicaLeaseHeldGaugeVec.WithLabelValues(r.db.Path(), r.Name()).Set(held)
+	replicaLeaseConflictGaugeVec.WithLabelValues(r.db.Path(), r.Name()).Set(conflict)
+}
+
+// defaultLeaseHolder returns the hostname or a random name if unavailable.
+func defaultLeaseHolder() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	id, _ := generateLeaseID()
+	return id
+}
+
+func generateLeaseID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", fmt.Errorf("generate lease id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Lease metrics.
+var (
+	replicaLeaseHeldGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "litestream",
+		Subsystem: "replica",
+		Name:      "lease_held",
+		Help:      "Set to 1 while the replica holds its writer lease",
+	}, []string{"db", "name"})
+
+	replicaLeaseConflictGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "litestream",
+		Subsystem: "replica",
+		Name:      "lease_conflict",
+		Help:      "Set to 1 while the writer lease is held by another writer",
+	}, []string{"db", "name"})
+)
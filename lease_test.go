@@ -0,0 +1,204 @@
+package litestream_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+	"github.com/benbjohnson/litestream/mock"
+)
+
+func TestReplica_AcquireLease(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		r := newLeaseReplica(c, "host-a")
+		if err := r.AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		}
+
+		lease, err := r.ReadLease(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := lease.Holder, "host-a"; got != want {
+			t.Fatalf("Holder=%q, want %q", got, want)
+		} else if lease.Expired(time.Now()) {
+			t.Fatal("expected unexpired lease")
+		}
+
+		// Renewing keeps the lease ID.
+		if err := r.AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		} else if other, err := r.ReadLease(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := other.ID, lease.ID; got != want {
+			t.Fatalf("ID=%q, want %q", got, want)
+		}
+
+		// Releasing removes the lease.
+		if err := r.ReleaseLease(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if lease, err := r.ReadLease(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if lease != nil {
+			t.Fatalf("expected no lease, got %#v", lease)
+		}
+	})
+
+	t.Run("ErrLeaseHeld", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		if err := newLeaseReplica(c, "host-a").AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		}
+
+		var heldErr *litestream.LeaseHeldError
+		err := newLeaseReplica(c, "host-b").AcquireLease(context.Background(), false)
+		if !errors.Is(err, litestream.ErrLeaseHeld) || !errors.As(err, &heldErr) {
+			t.Fatalf("unexpected error: %#v", err)
+		} else if got, want := heldErr.Lease.Holder, "host-a"; got != want {
+			t.Fatalf("Holder=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure a second process with the same holder name cannot take the lease.
+	t.Run("ErrSameHolder", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		if err := newLeaseReplica(c, "host-a").AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		} else if err := newLeaseReplica(c, "host-a").AcquireLease(context.Background(), false); !errors.Is(err, litestream.ErrLeaseHeld) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure renewal fails once the lease ID changes, even for the same holder.
+	t.Run("ErrLeaseTakenOver", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		r := newLeaseReplica(c, "host-a")
+		if err := r.AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		} else if err := newLeaseReplica(c, "host-a").AcquireLease(context.Background(), true); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.AcquireLease(context.Background(), false); !errors.Is(err, litestream.ErrLeaseHeld) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Subsequent attempts fail while the other lease is unexpired.
+		if err := r.AcquireLease(context.Background(), false); !errors.Is(err, litestream.ErrLeaseHeld) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure a transient error while renewing does not cause the replica to
+	// conflict with its own lease on the next attempt.
+	t.Run("TransientError", func(t *testing.T) {
+		c := &failingLeaseClient{ReplicaClient: memory.NewReplicaClient()}
+		r := newLeaseReplica(c, "host-a")
+		if err := r.AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		}
+		lease, err := r.ReadLease(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.readErr = errors.New("marker")
+		if err := r.AcquireLease(context.Background(), false); err == nil || err.Error() != `read lease: marker` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := r.AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		} else if other, err := r.ReadLease(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := other.ID, lease.ID; got != want {
+			t.Fatalf("ID=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		if err := c.WriteLease(context.Background(), strings.NewReader(`{"holder":"host-a","id":"x","expires-at":"2000-01-01T00:00:00Z"}`)); err != nil {
+			t.Fatal(err)
+		}
+
+		r := newLeaseReplica(c, "host-b")
+		if err := r.AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		} else if lease, err := r.ReadLease(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := lease.Holder, "host-b"; got != want {
+			t.Fatalf("Holder=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		if err := newLeaseReplica(c, "host-a").AcquireLease(context.Background(), false); err != nil {
+			t.Fatal(err)
+		} else if err := newLeaseReplica(c, "host-b").AcquireLease(context.Background(), true); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrNotSupported", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "")
+		r.Client = &mock.ReplicaClient{}
+		if err := r.AcquireLease(context.Background(), false); err == nil || err.Error() != `mock client does not support leases` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// Ensure a replica refuses to sync while another writer holds the lease.
+func TestReplica_Sync_ErrLeaseHeld(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	c := memory.NewReplicaClient()
+	if err := newLeaseReplica(c, "host-a").AcquireLease(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	r := litestream.NewReplica(db, "")
+	r.Client, r.LeaseTimeout, r.LeaseHolder = c, time.Minute, "host-b"
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := r.Sync(context.Background()); !errors.Is(err, litestream.ErrLeaseHeld) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if generations, err := c.Generations(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if len(generations) != 0 {
+		t.Fatalf("unexpected generations: %v", generations)
+	}
+}
+
+// failingLeaseClient returns readErr from the next call to LeaseReader().
+type failingLeaseClient struct {
+	*memory.ReplicaClient
+	readErr error
+}
+
+func (c *failingLeaseClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	if err := c.readErr; err != nil {
+		c.readErr = nil
+		return nil, err
+	}
+	return c.ReplicaClient.LeaseReader(ctx)
+}
+
+func newLeaseReplica(c litestream.ReplicaClient, holder string) *litestream.Replica {
+	r := litestream.NewReplica(nil, "")
+	r.Client, r.LeaseTimeout, r.LeaseHolder = c, time.Minute, holder
+	return r
+}
@@ -0,0 +1,156 @@
+package litestream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/litestream/internal"
+)
+
+// GenerationMeta records how a generation was started. It is written locally
+// when the generation is created and copied to each replica so the history
+// of a database can be traced across generations.
+type GenerationMeta struct {
+	Generation string `json:"generation"`
+
+	// Last position of the previous generation, if any.
+	ParentGeneration string `json:"parent-generation,omitempty"`
+	ParentIndex      int    `json:"parent-index,omitempty"`
+	ParentOffset     int64  `json:"parent-offset,omitempty"`
+
+	// Reason the previous generation could not be continued.
+	Reason string `json:"reason"`
+
+	Hostname  string    `json:"hostname"`
+	Version   string    `json:"version,omitempty"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+// ParentPos returns the last position of the parent generation.
+func (m *GenerationMeta) ParentPos() Pos {
+	return Pos{Generation: m.ParentGeneration, Index: m.ParentIndex, Offset: m.ParentOffset}
+}
+
+// GenerationMetaPath returns the path of a generation's metadata file.
+func (db *DB) GenerationMetaPath(generation string) string {
+	return filepath.Join(db.GenerationPath(generation), "meta.json")
+}
+
+// GenerationMeta returns the local metadata for a generation. Returns nil if
+// the generation was created before metadata was recorded.
+func (db *DB) GenerationMeta(generation string) (*GenerationMeta, error) {
+	buf, err := os.ReadFile(db.GenerationMetaPath(generation))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var meta GenerationMeta
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		return nil, fmt.Errorf("cannot decode generation metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// writeGenerationMeta writes the metadata for a new generation to disk.
+func (db *DB) writeGenerationMeta(generation string, parent Pos, reason string) error {
+	hostname, _ := os.Hostname()
+	meta := GenerationMeta{
+		Generation:       generation,
+		ParentGeneration: parent.Generation,
+		ParentIndex:      parent.Index,
+		ParentOffset:     parent.Offset,
+		Reason:           reason,
+		Hostname:         hostname,
+		Version:          Version,
+		CreatedAt:        time.Now().UTC(),
+	}
+
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	filename := db.GenerationMetaPath(generation)
+	f, err := internal.CreateFile(filename+".tmp", db.fileInfo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(buf); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// GenerationMeta returns the metadata for a generation stored on the replica.
+// Returns nil if no metadata exists or the client does not support it.
+func (r *Replica) GenerationMeta(ctx context.Context, generation string) (*GenerationMeta, error) {
+	client, ok := UnwrapClient[GenerationMetaClient](r.Client)
+	if !ok {
+		return nil, nil
+	}
+
+	rc, err := client.GenerationMetaReader(ctx, generation)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	var meta GenerationMeta
+	if err := json.NewDecoder(rc).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("cannot decode generation metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// uploadGenerationMeta copies the local metadata for a generation to the
+// replica. Skipped if the client does not support metadata, the generation
+// has no local metadata or the metadata was already uploaded. The replica
+// position is reset after sync errors so the uploaded generation is tracked
+// separately to avoid rewriting the metadata on every retry.
+func (r *Replica) uploadGenerationMeta(ctx context.Context, generation string) error {
+	client, ok := UnwrapClient[GenerationMetaClient](r.Client)
+	if !ok {
+		return nil
+	}
+
+	r.mu.RLock()
+	uploaded := r.metaGen == generation
+	r.mu.RUnlock()
+	if uploaded {
+		return nil
+	}
+
+	meta, err := r.db.GenerationMeta(generation)
+	if err != nil {
+		return err
+	} else if meta == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	} else if err := client.WriteGenerationMeta(ctx, generation, bytes.NewReader(buf)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.metaGen = generation
+	r.mu.Unlock()
+	return nil
+}
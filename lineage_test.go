@@ -0,0 +1,171 @@
+package litestream_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestDB_GenerationMeta(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Initial generation should have no parent.
+	pos0, err := db.Pos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := db.GenerationMeta(pos0.Generation); err != nil {
+		t.Fatal(err)
+	} else if got, want := meta.Generation, pos0.Generation; got != want {
+		t.Fatalf("Generation=%q, want %q", got, want)
+	} else if got, want := meta.Reason, "no generation exists"; got != want {
+		t.Fatalf("Reason=%q, want %q", got, want)
+	} else if meta.ParentGeneration != "" {
+		t.Fatalf("unexpected parent: %s", meta.ParentGeneration)
+	} else if meta.Hostname == "" || meta.CreatedAt.IsZero() {
+		t.Fatalf("expected hostname & creation time: %#v", meta)
+	}
+
+	// Remove shadow WAL to force a new generation.
+	if err := db.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := os.Remove(db.ShadowWALPath(pos0.Generation, pos0.Index)); err != nil {
+		t.Fatal(err)
+	}
+
+	db = MustOpenDBAt(t, db.Path())
+	defer MustCloseDB(t, db)
+	if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// New generation should link back to the previous one.
+	pos1, err := db.Pos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := db.GenerationMeta(pos1.Generation); err != nil {
+		t.Fatal(err)
+	} else if got, want := meta.ParentGeneration, pos0.Generation; got != want {
+		t.Fatalf("ParentGeneration=%q, want %q", got, want)
+	} else if got, want := meta.ParentIndex, pos0.Index; got != want {
+		t.Fatalf("ParentIndex=%d, want %d", got, want)
+	} else if got, want := meta.Reason, "no shadow wal"; got != want {
+		t.Fatalf("Reason=%q, want %q", got, want)
+	}
+}
+
+func TestReplica_GenerationMeta(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		r := litestream.NewReplica(db, "")
+		r.Client = memory.NewReplicaClient()
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Metadata should be copied to the replica on the first sync.
+		meta, err := r.GenerationMeta(context.Background(), r.Pos().Generation)
+		if err != nil {
+			t.Fatal(err)
+		} else if meta == nil {
+			t.Fatal("expected generation metadata")
+		} else if got, want := meta.Generation, r.Pos().Generation; got != want {
+			t.Fatalf("Generation=%q, want %q", got, want)
+		} else if got, want := meta.Reason, "no generation exists"; got != want {
+			t.Fatalf("Reason=%q, want %q", got, want)
+		}
+
+		// Metadata should not appear as a separate generation.
+		if generations, err := r.Client.Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if len(generations) != 1 {
+			t.Fatalf("unexpected generations: %v", generations)
+		}
+	})
+
+	// Ensure metadata is not rewritten when a failed sync resets the replica
+	// position.
+	t.Run("UploadOnce", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := &countingMetaClient{ReplicaClient: memory.NewReplicaClient()}
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		c.walErr = errors.New("marker")
+		if err := r.Sync(context.Background()); err == nil {
+			t.Fatal("expected error")
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := c.metaN, 1; got != want {
+			t.Fatalf("WriteGenerationMeta()=%d calls, want %d", got, want)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		r := litestream.NewReplica(nil, "")
+		r.Client = memory.NewReplicaClient()
+		if meta, err := r.GenerationMeta(context.Background(), "0000000000000000"); err != nil {
+			t.Fatal(err)
+		} else if meta != nil {
+			t.Fatalf("unexpected metadata: %#v", meta)
+		}
+	})
+}
+
+// countingMetaClient counts metadata writes & returns walErr from the next
+// call to WriteWALSegment().
+type countingMetaClient struct {
+	*memory.ReplicaClient
+	metaN  int
+	walErr error
+}
+
+func (c *countingMetaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	c.metaN++
+	return c.ReplicaClient.WriteGenerationMeta(ctx, generation, rd)
+}
+
+func (c *countingMetaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (litestream.WALSegmentInfo, error) {
+	if err := c.walErr; err != nil {
+		c.walErr = nil
+		return litestream.WALSegmentInfo{}, err
+	}
+	return c.ReplicaClient.WriteWALSegment(ctx, pos, rd)
+}
@@ -21,8 +21,11 @@ import (
 const (
 	MetaDirSuffix = "-litestream"
 
-	WALDirName    = "wal"
-	WALExt        = ".wal"
+	WALDirName = "wal"
+	WALExt     = ".wal"
+
+	// Segment & snapshot extensions are kept for compatibility. The actual
+	// compression codec is detected from each object's contents.
 	WALSegmentExt = ".wal.lz4"
 	SnapshotExt   = ".snapshot.lz4"
 
@@ -39,12 +42,21 @@ const (
 
 // Litestream errors.
 var (
-	ErrNoGeneration     = errors.New("no generation available")
-	ErrNoSnapshots      = errors.New("no snapshots available")
-	ErrChecksumMismatch = errors.New("invalid replica, checksum mismatch")
+	ErrNoGeneration      = errors.New("no generation available")
+	ErrNoSnapshots       = errors.New("no snapshots available")
+	ErrChecksumMismatch  = errors.New("invalid replica, checksum mismatch")
+	ErrGenerationChanged = errors.New("generation changed")
+	ErrLeaseHeld         = errors.New("replica lease held by another writer")
+
+	// ErrShadowWALThrottled is returned by DB.SyncPos() while new frames are
+	// held in the real WAL by ShadowWALPolicyThrottle.
+	ErrShadowWALThrottled = errors.New("shadow wal throttled")
 )
 
 var (
+	// Version is recorded in generation metadata. Set by the CLI on startup.
+	Version = ""
+
 	// LogWriter is the destination writer for all logging.
 	LogWriter = os.Stdout
 
@@ -407,6 +419,11 @@ func IsGenerationName(s string) bool {
 	return true
 }
 
+// LeasePath returns the path to the writer lease of a replica.
+func LeasePath(root string) string {
+	return path.Join(root, "lease")
+}
+
 // GenerationsPath returns the path to a generation root directory.
 func GenerationsPath(root string) string {
 	return path.Join(root, "generations")
@@ -421,6 +438,15 @@ func GenerationPath(root, generation string) (string, error) {
 	return path.Join(dir, generation), nil
 }
 
+// GenerationMetaPath returns the path to a generation's metadata file.
+func GenerationMetaPath(root, generation string) (string, error) {
+	dir, err := GenerationPath(root, generation)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "meta.json"), nil
+}
+
 // SnapshotsPath returns the path to a generation's snapshot directory.
 func SnapshotsPath(root, generation string) (string, error) {
 	dir, err := GenerationPath(root, generation)
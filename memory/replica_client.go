@@ -0,0 +1,384 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/internal"
+)
+
+// ReplicaClientType is the client type for this package.
+const ReplicaClientType = "mem"
+
+var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
+
+// ReplicaClient is a client for storing snapshots & WAL segments in memory.
+// Objects are keyed by the same paths used by the file-based clients so a
+// memory replica behaves identically to a persistent one. Data is lost when
+// the process exits.
+type ReplicaClient struct {
+	mu      sync.RWMutex
+	name    string
+	objects map[string]*object
+
+	// Now returns the current time. Used to set object creation times.
+	// Defaults to time.Now but can be overridden for testing.
+	Now func() time.Time
+}
+
+// object represents a single snapshot or WAL segment stored in memory.
+type object struct {
+	data      []byte
+	createdAt time.Time
+}
+
+// NewReplicaClient returns a new, empty, unnamed instance of ReplicaClient.
+func NewReplicaClient() *ReplicaClient {
+	return &ReplicaClient{
+		objects: make(map[string]*object),
+		Now:     time.Now,
+	}
+}
+
+// registry holds named clients so they can be shared within a process.
+var registry = struct {
+	mu      sync.Mutex
+	clients map[string]*ReplicaClient
+}{clients: make(map[string]*ReplicaClient)}
+
+// Named returns a process-wide client registered under name, creating it if
+// it does not exist. Clients referenced by the same "mem://NAME" URL share
+// the same underlying storage.
+func Named(name string) *ReplicaClient {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if c := registry.clients[name]; c != nil {
+		return c
+	}
+
+	c := NewReplicaClient()
+	c.name = name
+	registry.clients[name] = c
+	return c
+}
+
+// Drop removes a named client from the process-wide registry. Clients that
+// were previously returned from Named() are still usable but a subsequent
+// call to Named() will return a new, empty client.
+func Drop(name string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.clients, name)
+}
+
+// Type returns "mem" as the client type.
+func (c *ReplicaClient) Type() string {
+	return ReplicaClientType
+}
+
+// Name returns the name the client was registered under, if any.
+func (c *ReplicaClient) Name() string {
+	return c.name
+}
+
+// Generations returns a list of available generation names.
+func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	prefix := litestream.GenerationsPath("") + "/"
+
+	m := make(map[string]struct{})
+	for key := range c.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(strings.TrimPrefix(key, prefix), "/")
+		if !litestream.IsGenerationName(name) {
+			continue
+		}
+		m[name] = struct{}{}
+	}
+
+	generations := make([]string, 0, len(m))
+	for name := range m {
+		generations = append(generations, name)
+	}
+	sort.Strings(generations)
+
+	return generations, nil
+}
+
+// DeleteGeneration deletes all snapshots & WAL segments within a generation.
+func (c *ReplicaClient) DeleteGeneration(ctx context.Context, generation string) error {
+	dir, err := litestream.GenerationPath("", generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation path: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.objects {
+		if strings.HasPrefix(key, dir+"/") {
+			delete(c.objects, key)
+		}
+	}
+	return nil
+}
+
+// Snapshots returns an iterator over all available snapshots for a generation.
+func (c *ReplicaClient) Snapshots(ctx context.Context, generation string) (litestream.SnapshotIterator, error) {
+	dir, err := litestream.SnapshotsPath("", generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshots path: %w", err)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var infos []litestream.SnapshotInfo
+	for key, obj := range c.objects {
+		if path.Dir(key) != dir {
+			continue
+		}
+
+		index, err := litestream.ParseSnapshotPath(path.Base(key))
+		if err != nil {
+			continue
+		}
+
+		infos = append(infos, litestream.SnapshotInfo{
+			Generation: generation,
+			Index:      index,
+			Size:       int64(len(obj.data)),
+			CreatedAt:  obj.createdAt,
+		})
+	}
+	sort.Sort(litestream.SnapshotInfoSlice(infos))
+
+	return litestream.NewSnapshotInfoSliceIterator(infos), nil
+}
+
+// WriteSnapshot writes LZ4 compressed data from rd into memory.
+func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (info litestream.SnapshotInfo, err error) {
+	key, err := litestream.SnapshotPath("", generation, index)
+	if err != nil {
+		return info, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	obj, err := c.put(key, rd)
+	if err != nil {
+		return info, err
+	}
+
+	return litestream.SnapshotInfo{
+		Generation: generation,
+		Index:      index,
+		Size:       int64(len(obj.data)),
+		CreatedAt:  obj.createdAt,
+	}, nil
+}
+
+// SnapshotReader returns a reader for snapshot data at the given generation/index.
+// Returns os.ErrNotExist if no matching index is found.
+func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+	key, err := litestream.SnapshotPath("", generation, index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+	return c.get(key)
+}
+
+// DeleteSnapshot deletes a snapshot with the given generation & index.
+func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
+	key, err := litestream.SnapshotPath("", generation, index)
+	if err != nil {
+		return fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.objects, key)
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
+// WALSegments returns an iterator over all available WAL files for a generation.
+func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+	dir, err := litestream.WALPath("", generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine wal path: %w", err)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var infos []litestream.WALSegmentInfo
+	for key, obj := range c.objects {
+		if path.Dir(key) != dir {
+			continue
+		}
+
+		index, offset, err := litestream.ParseWALSegmentPath(path.Base(key))
+		if err != nil {
+			continue
+		}
+
+		infos = append(infos, litestream.WALSegmentInfo{
+			Generation: generation,
+			Index:      index,
+			Offset:     offset,
+			Size:       int64(len(obj.data)),
+			CreatedAt:  obj.createdAt,
+		})
+	}
+	sort.Sort(litestream.WALSegmentInfoSlice(infos))
+
+	return litestream.NewWALSegmentInfoSliceIterator(infos), nil
+}
+
+// WriteWALSegment writes LZ4 compressed data from rd into memory.
+func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (info litestream.WALSegmentInfo, err error) {
+	key, err := litestream.WALSegmentPath("", pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return info, fmt.Errorf("cannot determine wal segment path: %w", err)
+	}
+
+	obj, err := c.put(key, rd)
+	if err != nil {
+		return info, err
+	}
+
+	return litestream.WALSegmentInfo{
+		Generation: pos.Generation,
+		Index:      pos.Index,
+		Offset:     pos.Offset,
+		Size:       int64(len(obj.data)),
+		CreatedAt:  obj.createdAt,
+	}, nil
+}
+
+// WALSegmentReader returns a reader for a section of WAL data at the given position.
+// Returns os.ErrNotExist if no matching index/offset is found.
+func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+	key, err := litestream.WALSegmentPath("", pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine wal segment path: %w", err)
+	}
+	return c.get(key)
+}
+
+// DeleteWALSegments deletes WAL segments at the given positions.
+func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Pos) error {
+	keys := make([]string, len(a))
+	for i, pos := range a {
+		key, err := litestream.WALSegmentPath("", pos.Generation, pos.Index, pos.Offset)
+		if err != nil {
+			return fmt.Errorf("cannot determine wal segment path: %w", err)
+		}
+		keys[i] = key
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.objects, key)
+		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	}
+	return nil
+}
+
+// GenerationMetaReader returns a reader for the metadata of a generation.
+// Returns os.ErrNotExist if no metadata exists.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	key, err := litestream.GenerationMetaPath("", generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+	return c.get(key)
+}
+
+// WriteGenerationMeta writes the metadata of a generation.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	key, err := litestream.GenerationMetaPath("", generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+	_, err = c.put(key, rd)
+	return err
+}
+
+// LeaseReader returns a reader for the replica lease.
+// Returns os.ErrNotExist if no lease exists.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	return c.get(litestream.LeasePath(""))
+}
+
+// WriteLease writes the replica lease, replacing any existing lease.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	_, err := c.put(litestream.LeasePath(""), rd)
+	return err
+}
+
+// DeleteLease deletes the replica lease, if it exists.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.objects, litestream.LeasePath(""))
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
+// put reads all of rd and stores it under key.
+func (c *ReplicaClient) put(key string, rd io.Reader) (*object, error) {
+	var buf bytes.Buffer
+	if rd != nil {
+		if _, err := io.Copy(&buf, rd); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj := &object{data: buf.Bytes(), createdAt: c.Now().UTC()}
+	c.objects[key] = obj
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(len(obj.data)))
+	return obj, nil
+}
+
+// get returns a reader for the data stored under key.
+// Returns os.ErrNotExist if the key does not exist.
+func (c *ReplicaClient) get(key string) (io.ReadCloser, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	obj := c.objects[key]
+	if obj == nil {
+		return nil, os.ErrNotExist
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(len(obj.data)))
+
+	// Stored data is never mutated so it is safe to share the slice.
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
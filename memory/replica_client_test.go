@@ -0,0 +1,262 @@
+package memory_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+func TestReplicaClient_Type(t *testing.T) {
+	if got, want := memory.NewReplicaClient().Type(), "mem"; got != want {
+		t.Fatalf("Type()=%v, want %v", got, want)
+	}
+}
+
+func TestReplicaClient_Generations(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		mustWriteSnapshot(t, c, "5efbd9d2b2ce5a51", 0, "foo")
+		mustWriteSnapshot(t, c, "b16ddcf5c697540f", 0, "bar")
+		mustWriteWALSegment(t, c, litestream.Pos{Generation: "155fe292f8333c72", Index: 0, Offset: 0}, "baz")
+
+		if got, err := c.Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if want := []string{"155fe292f8333c72", "5efbd9d2b2ce5a51", "b16ddcf5c697540f"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Generations()=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("DeleteGeneration", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		mustWriteSnapshot(t, c, "5efbd9d2b2ce5a51", 0, "foo")
+		mustWriteWALSegment(t, c, litestream.Pos{Generation: "5efbd9d2b2ce5a51", Index: 0, Offset: 0}, "bar")
+		mustWriteSnapshot(t, c, "b16ddcf5c697540f", 0, "baz")
+
+		if err := c.DeleteGeneration(context.Background(), "5efbd9d2b2ce5a51"); err != nil {
+			t.Fatal(err)
+		} else if got, err := c.Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if want := []string{"b16ddcf5c697540f"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Generations()=%v, want %v", got, want)
+		} else if _, err := c.SnapshotReader(context.Background(), "5efbd9d2b2ce5a51", 0); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("NoGenerations", func(t *testing.T) {
+		if got, err := memory.NewReplicaClient().Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if len(got) != 0 {
+			t.Fatalf("Generations()=%v, want none", got)
+		}
+	})
+}
+
+func TestReplicaClient_Snapshots(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		now := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+		c := memory.NewReplicaClient()
+		c.Now = func() time.Time { return now }
+
+		if info, err := c.WriteSnapshot(context.Background(), "5efbd9d2b2ce5a51", 5, strings.NewReader("foobar")); err != nil {
+			t.Fatal(err)
+		} else if got, want := info, (litestream.SnapshotInfo{Generation: "5efbd9d2b2ce5a51", Index: 5, Size: 6, CreatedAt: now}); got != want {
+			t.Fatalf("WriteSnapshot()=%#v, want %#v", got, want)
+		}
+		mustWriteSnapshot(t, c, "5efbd9d2b2ce5a51", 1, "baz")
+		mustWriteSnapshot(t, c, "b16ddcf5c697540f", 2, "other")
+
+		if got, want := mustSnapshotIndexes(t, c, "5efbd9d2b2ce5a51"), []int{1, 5}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("indexes=%v, want %v", got, want)
+		} else if got, want := mustReadSnapshot(t, c, "5efbd9d2b2ce5a51", 5), "foobar"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+
+		if err := c.DeleteSnapshot(context.Background(), "5efbd9d2b2ce5a51", 5); err != nil {
+			t.Fatal(err)
+		} else if _, err := c.SnapshotReader(context.Background(), "5efbd9d2b2ce5a51", 5); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := mustSnapshotIndexes(t, c, "5efbd9d2b2ce5a51"), []int{1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("indexes=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure writing to an existing index replaces its data.
+	t.Run("Overwrite", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		mustWriteSnapshot(t, c, "5efbd9d2b2ce5a51", 1, "foo")
+		mustWriteSnapshot(t, c, "5efbd9d2b2ce5a51", 1, "bar")
+
+		if got, want := mustReadSnapshot(t, c, "5efbd9d2b2ce5a51", 1), "bar"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrNotFound", func(t *testing.T) {
+		if _, err := memory.NewReplicaClient().SnapshotReader(context.Background(), "5efbd9d2b2ce5a51", 1); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrNoGeneration", func(t *testing.T) {
+		if _, err := memory.NewReplicaClient().WriteSnapshot(context.Background(), "", 1, strings.NewReader("foo")); err == nil || err.Error() != `cannot determine snapshot path: generation required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicaClient_WALSegments(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := memory.NewReplicaClient()
+		pos0 := litestream.Pos{Generation: "5efbd9d2b2ce5a51", Index: 1, Offset: 0}
+		pos1 := litestream.Pos{Generation: "5efbd9d2b2ce5a51", Index: 1, Offset: 100}
+		pos2 := litestream.Pos{Generation: "5efbd9d2b2ce5a51", Index: 2, Offset: 0}
+		mustWriteWALSegment(t, c, pos2, "baz")
+		mustWriteWALSegment(t, c, pos1, "bar")
+		if info, err := c.WriteWALSegment(context.Background(), pos0, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		} else if got, want := info.Pos(), pos0; got != want {
+			t.Fatalf("Pos()=%s, want %s", got, want)
+		} else if got, want := info.Size, int64(3); got != want {
+			t.Fatalf("Size=%d, want %d", got, want)
+		}
+		mustWriteWALSegment(t, c, litestream.Pos{Generation: "b16ddcf5c697540f", Index: 1, Offset: 0}, "other")
+
+		if got, want := mustWALSegmentPositions(t, c, "5efbd9d2b2ce5a51"), []litestream.Pos{pos0, pos1, pos2}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("positions=%v, want %v", got, want)
+		} else if got, want := mustReadWALSegment(t, c, pos1), "bar"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+
+		if err := c.DeleteWALSegments(context.Background(), []litestream.Pos{pos0, pos2}); err != nil {
+			t.Fatal(err)
+		} else if _, err := c.WALSegmentReader(context.Background(), pos0); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := mustWALSegmentPositions(t, c, "5efbd9d2b2ce5a51"), []litestream.Pos{pos1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("positions=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrNotFound", func(t *testing.T) {
+		if _, err := memory.NewReplicaClient().WALSegmentReader(context.Background(), litestream.Pos{Generation: "5efbd9d2b2ce5a51", Index: 1}); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrNoGeneration", func(t *testing.T) {
+		if err := memory.NewReplicaClient().DeleteWALSegments(context.Background(), []litestream.Pos{{}}); err == nil || err.Error() != `cannot determine wal segment path: generation required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNamed(t *testing.T) {
+	t.Cleanup(func() { memory.Drop("TestNamed") })
+
+	c := memory.Named("TestNamed")
+	if got, want := c.Name(), "TestNamed"; got != want {
+		t.Fatalf("Name()=%v, want %v", got, want)
+	} else if memory.Named("TestNamed") != c {
+		t.Fatal("expected same client")
+	}
+	mustWriteSnapshot(t, c, "5efbd9d2b2ce5a51", 1, "foo")
+
+	// Ensure a dropped name returns a new, empty client.
+	memory.Drop("TestNamed")
+	if other := memory.Named("TestNamed"); other == c {
+		t.Fatal("expected new client")
+	} else if _, err := other.SnapshotReader(context.Background(), "5efbd9d2b2ce5a51", 1); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if got, want := mustReadSnapshot(t, c, "5efbd9d2b2ce5a51", 1), "foo"; got != want {
+		t.Fatalf("data=%q, want %q", got, want)
+	}
+}
+
+func mustWriteSnapshot(tb testing.TB, c *memory.ReplicaClient, generation string, index int, data string) {
+	tb.Helper()
+	if _, err := c.WriteSnapshot(context.Background(), generation, index, strings.NewReader(data)); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func mustWriteWALSegment(tb testing.TB, c *memory.ReplicaClient, pos litestream.Pos, data string) {
+	tb.Helper()
+	if _, err := c.WriteWALSegment(context.Background(), pos, strings.NewReader(data)); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func mustReadSnapshot(tb testing.TB, c *memory.ReplicaClient, generation string, index int) string {
+	tb.Helper()
+	rc, err := c.SnapshotReader(context.Background(), generation, index)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(buf)
+}
+
+func mustReadWALSegment(tb testing.TB, c *memory.ReplicaClient, pos litestream.Pos) string {
+	tb.Helper()
+	rc, err := c.WALSegmentReader(context.Background(), pos)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(buf)
+}
+
+// mustSnapshotIndexes returns the indexes of all snapshots in generation.
+func mustSnapshotIndexes(tb testing.TB, c *memory.ReplicaClient, generation string) []int {
+	tb.Helper()
+	itr, err := c.Snapshots(context.Background(), generation)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	infos, err := litestream.SliceSnapshotIterator(itr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	indexes := make([]int, len(infos))
+	for i := range infos {
+		indexes[i] = infos[i].Index
+	}
+	return indexes
+}
+
+// mustWALSegmentPositions returns the positions of all WAL segments in generation.
+func mustWALSegmentPositions(tb testing.TB, c *memory.ReplicaClient, generation string) []litestream.Pos {
+	tb.Helper()
+	itr, err := c.WALSegments(context.Background(), generation)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	infos, err := litestream.SliceWALSegmentIterator(itr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	a := make([]litestream.Pos, len(infos))
+	for i := range infos {
+		a[i] = infos[i].Pos()
+	}
+	return a
+}
@@ -0,0 +1,279 @@
+package litestream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/litestream/internal"
+)
+
+// Shared objects are held in memory up to this size & spooled to disk beyond it.
+const sharedObjectMemSize = 4 << 20
+
+// Shared objects not acquired by every expected replica within this time are
+// discarded so a lagging replica does not pin them indefinitely.
+const sharedObjectTTL = 1 * time.Minute
+
+// sharedObject is a compressed & encrypted WAL segment or snapshot that is
+// produced once by the DB & uploaded by every replica with the same encoding.
+type sharedObject struct {
+	key       string
+	end       Pos // position after the data, for WAL segments
+	n         int // uncompressed size, in bytes
+	spool     *spool
+	createdAt time.Time
+
+	ready chan struct{} // closed once produced
+	err   error         // production error
+
+	refs    int  // replicas yet to acquire the object
+	active  int  // replicas currently uploading the object
+	expired bool // removed from the DB, closed once inactive
+}
+
+// Reader returns a reader for the encoded data.
+func (o *sharedObject) Reader() io.Reader { return o.spool.Reader() }
+
+// encodingKey returns a key identifying the codec & encryption settings of
+// the replica. Replicas with the same key produce interchangeable objects.
+func (r *Replica) encodingKey() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s/%d", codecOrDefault(r.Codec), r.CompressionLevel)
+	for _, recipient := range r.AgeRecipients {
+		if s, ok := recipient.(fmt.Stringer); ok {
+			fmt.Fprintf(&b, "/%s", s.String())
+		} else {
+			fmt.Fprintf(&b, "/%p", recipient)
+		}
+	}
+	return b.String()
+}
+
+// sharedReplicaN returns the number of replicas that can share objects
+// encoded by r. Snapshots are only shared between replicas without delta
+// snapshots as those must checksum the exact data they upload.
+func (db *DB) sharedReplicaN(r *Replica, snapshot bool) int {
+	if snapshot && r.MaxDeltaSnapshots > 0 {
+		return 1
+	}
+
+	key, n := r.encodingKey(), 0
+	for _, other := range db.Replicas {
+		if snapshot && other.MaxDeltaSnapshots > 0 {
+			continue
+		} else if other.encodingKey() == key {
+			n++
+		}
+	}
+	return n
+}
+
+// canSpool returns true if the spool directory has space for sz bytes of
+// encoded data. Objects smaller than sharedObjectMemSize are never spooled.
+func (db *DB) canSpool(sz int64) bool {
+	if sz <= sharedObjectMemSize {
+		return true
+	}
+
+	dir := filepath.Join(db.metaPath, "spool")
+	free, err := internal.DiskFree(db.metaPath)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true
+	} else if err != nil {
+		db.Logger.Warn("cannot determine spool free space, uploading directly", "path", dir, "error", err)
+		return false
+	} else if need := uint64(sz + sz/10); free < need {
+		db.Logger.Warn("insufficient space to spool shared object, uploading directly", "path", dir, "free", free, "need", need)
+		return false
+	}
+	return true
+}
+
+// acquireSharedObject returns the object for key, producing it with fn if it
+// does not exist. If fn is nil then nil is returned if the object does not
+// exist. The object is expected to be acquired by n replicas. Each caller
+// must call releaseSharedObject() once it has finished uploading.
+func (db *DB) acquireSharedObject(ctx context.Context, key string, n int, fn func(w io.Writer) (end Pos, sz int, err error)) (*sharedObject, error) {
+	db.sharedMu.Lock()
+	db.expireSharedObjects()
+
+	// Wait for an existing object to be produced, if one exists.
+	if obj := db.shared[key]; obj != nil {
+		obj.refs--
+		obj.active++
+		db.sharedMu.Unlock()
+
+		select {
+		case <-obj.ready:
+		case <-ctx.Done():
+			db.releaseSharedObject(obj)
+			return nil, ctx.Err()
+		}
+		if obj.err != nil {
+			db.releaseSharedObject(obj)
+			return nil, obj.err
+		}
+		return obj, nil
+	}
+
+	if fn == nil {
+		db.sharedMu.Unlock()
+		return nil, nil
+	}
+
+	if db.shared == nil {
+		db.shared = make(map[string]*sharedObject)
+	}
+	obj := &sharedObject{
+		key:       key,
+		spool:     newSpool(filepath.Join(db.metaPath, "spool"), db.dirInfo),
+		createdAt: time.Now(),
+		ready:     make(chan struct{}),
+		refs:      n - 1,
+		active:    1,
+	}
+	db.shared[key] = obj
+	db.sharedMu.Unlock()
+
+	// Produce the object. Remove on error so the next caller retries.
+	obj.end, obj.n, obj.err = fn(obj.spool)
+	if obj.err != nil {
+		db.sharedMu.Lock()
+		if db.shared[key] == obj {
+			delete(db.shared, key)
+		}
+		obj.expired = true
+		db.sharedMu.Unlock()
+	}
+	close(obj.ready)
+
+	if obj.err != nil {
+		db.releaseSharedObject(obj)
+		return nil, obj.err
+	}
+	return obj, nil
+}
+
+// releaseSharedObject marks the caller as finished with the object. The
+// object is removed once all expected replicas have released it.
+func (db *DB) releaseSharedObject(obj *sharedObject) {
+	db.sharedMu.Lock()
+	defer db.sharedMu.Unlock()
+
+	obj.active--
+	if obj.refs <= 0 && !obj.expired {
+		obj.expired = true
+		if db.shared[obj.key] == obj {
+			delete(db.shared, obj.key)
+		}
+	}
+	if obj.expired && obj.active == 0 {
+		_ = obj.spool.Close()
+	}
+}
+
+// expireSharedObjects removes produced objects older than the TTL. Must be
+// called while holding sharedMu.
+func (db *DB) expireSharedObjects() {
+	for key, obj := range db.shared {
+		select {
+		case <-obj.ready:
+		default:
+			continue // still being produced
+		}
+		if time.Since(obj.createdAt) < sharedObjectTTL {
+			continue
+		}
+
+		obj.expired = true
+		delete(db.shared, key)
+		if obj.active == 0 {
+			_ = obj.spool.Close()
+		}
+	}
+}
+
+// closeSharedObjects discards all shared objects. Must be called once no
+// replicas are syncing.
+func (db *DB) closeSharedObjects() {
+	db.sharedMu.Lock()
+	defer db.sharedMu.Unlock()
+
+	for key, obj := range db.shared {
+		obj.expired = true
+		delete(db.shared, key)
+		if obj.active == 0 {
+			_ = obj.spool.Close()
+		}
+	}
+}
+
+// spool buffers written data in memory & moves it to a temporary file once
+// it exceeds sharedObjectMemSize.
+type spool struct {
+	dir     string
+	dirInfo os.FileInfo
+	buf     bytes.Buffer
+	f       *os.File
+	size    int64
+}
+
+func newSpool(dir string, dirInfo os.FileInfo) *spool {
+	return &spool{dir: dir, dirInfo: dirInfo}
+}
+
+// Write appends p to the spool.
+func (s *spool) Write(p []byte) (n int, err error) {
+	if s.f == nil && s.buf.Len()+len(p) > sharedObjectMemSize {
+		if err := internal.MkdirAll(s.dir, s.dirInfo); err != nil {
+			return 0, err
+		} else if s.f, err = os.CreateTemp(s.dir, "*.tmp"); err != nil {
+			return 0, err
+		} else if _, err := s.f.Write(s.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		s.buf = bytes.Buffer{}
+	}
+
+	if s.f != nil {
+		n, err = s.f.Write(p)
+	} else {
+		n, err = s.buf.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// Reader returns a new reader from the start of the spooled data.
+func (s *spool) Reader() io.Reader {
+	if s.f != nil {
+		return io.NewSectionReader(s.f, 0, s.size)
+	}
+	return bytes.NewReader(s.buf.Bytes())
+}
+
+// Close removes the spooled data.
+func (s *spool) Close() error {
+	s.buf = bytes.Buffer{}
+	if s.f == nil {
+		return nil
+	}
+	f := s.f
+	s.f = nil
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// nopWriteCloser wraps a writer with a no-op Close method.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,179 @@
+package litestream_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+)
+
+// Ensure replicas with the same encoding upload the same encoded objects.
+// Encryption is randomized so identical ciphertext shows each object was
+// only produced once.
+
+// Ensure objects spooled before a crash are removed when the DB is opened.
+func TestDB_Open_RemoveSpool(t *testing.T) {
+	db := litestream.NewDB(filepath.Join(t.TempDir(), "db"))
+	db.MonitorInterval = 0
+
+	dir := filepath.Join(db.MetaPath(), "spool")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(dir, "123.tmp"), []byte("stale"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer MustCloseDB(t, db)
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected spool to be removed, got %v", err)
+	}
+}
+func TestDB_SharedObjects(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, c1 := memory.NewReplicaClient(), memory.NewReplicaClient()
+	r0, r1 := litestream.NewReplica(db, "r0"), litestream.NewReplica(db, "r1")
+	r0.Client, r1.Client = c0, c1
+	r0.AgeRecipients = []age.Recipient{identity.Recipient()}
+	r1.AgeRecipients = []age.Recipient{identity.Recipient()}
+	db.Replicas = []*litestream.Replica{r0, r1}
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar BLOB);`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range db.Replicas {
+			if err := r.Sync(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Each replica tracks its own position.
+	pos := r0.Pos()
+	if got := r1.Pos(); got != pos {
+		t.Fatalf("Pos()=%s, want %s", got, pos)
+	}
+
+	// Snapshots at the same position are shared as well.
+	if info0, err := r0.Snapshot(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if info1, err := r1.Snapshot(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if info0.Index != info1.Index {
+		t.Fatalf("snapshot index mismatch: %d != %d", info0.Index, info1.Index)
+	} else if got, want := mustReadObject(t, c1.SnapshotReader, pos.Generation, info1.Index), mustReadObject(t, c0.SnapshotReader, pos.Generation, info0.Index); !bytes.Equal(got, want) {
+		t.Fatal("snapshot mismatch")
+	}
+
+	// Snapshots are not shared once the database moves to a new WAL index.
+	info0, err := r0.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+		t.Fatal(err)
+	} else if info1, err := r1.Snapshot(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if info1.Index <= info0.Index {
+		t.Fatalf("stale snapshot index: %d, previous %d", info1.Index, info0.Index)
+	}
+
+	itr, err := c1.WALSegments(context.Background(), pos.Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+
+	var n int
+	for ; itr.Next(); n++ {
+		info := itr.WALSegment()
+		segPos := info.Pos()
+		if got, want := mustReadWALSegment(t, c1, segPos), mustReadWALSegment(t, c0, segPos); !bytes.Equal(got, want) {
+			t.Fatalf("wal segment mismatch: %s", segPos)
+		}
+	}
+	if err := itr.Close(); err != nil {
+		t.Fatal(err)
+	} else if n == 0 {
+		t.Fatal("expected wal segments")
+	}
+
+	// Ensure the shared objects restore.
+	rr := litestream.NewReplica(nil, "")
+	rr.Client = c1
+	rr.AgeIdentities = []age.Identity{identity}
+
+	opt := litestream.NewRestoreOptions()
+	opt.OutputPath = filepath.Join(t.TempDir(), "db")
+	opt.Generation = pos.Generation
+	if err := rr.Restore(context.Background(), opt); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := MustOpenSQLDB(t, opt.OutputPath)
+	defer MustCloseSQLDB(t, restored)
+
+	var got, want string
+	if err := sqldb.QueryRow(`SELECT hex(group_concat(bar)) FROM foo`).Scan(&want); err != nil {
+		t.Fatal(err)
+	} else if err := restored.QueryRow(`SELECT hex(group_concat(bar)) FROM foo`).Scan(&got); err != nil {
+		t.Fatal(err)
+	} else if got != want {
+		t.Fatal("restored data mismatch")
+	}
+}
+
+func mustReadObject(tb testing.TB, fn func(context.Context, string, int) (io.ReadCloser, error), generation string, index int) []byte {
+	tb.Helper()
+
+	rc, err := fn(context.Background(), generation, index)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf
+}
+
+func mustReadWALSegment(tb testing.TB, c litestream.ReplicaClient, pos litestream.Pos) []byte {
+	tb.Helper()
+
+	rc, err := c.WALSegmentReader(context.Background(), pos)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf
+}
@@ -0,0 +1,307 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/benbjohnson/litestream"
+	"golang.org/x/time/rate"
+)
+
+// Process-wide limiters shared by all clients so that total bandwidth is
+// capped in addition to any per-replica limits. Nil means unlimited.
+var global = struct {
+	mu       sync.RWMutex
+	upload   *rate.Limiter
+	download *rate.Limiter
+}{}
+
+// SetGlobalUploadLimit sets the process-wide upload limit in bytes per second.
+// A limit of zero or less removes the limit.
+func SetGlobalUploadLimit(bytesPerSec int64) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.upload = updateLimiter(global.upload, bytesPerSec)
+}
+
+// SetGlobalDownloadLimit sets the process-wide download limit in bytes per
+// second. A limit of zero or less removes the limit.
+func SetGlobalDownloadLimit(bytesPerSec int64) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.download = updateLimiter(global.download, bytesPerSec)
+}
+
+// HasGlobalLimit returns true if a process-wide upload or download limit is set.
+func HasGlobalLimit() bool {
+	global.mu.RLock()
+	defer global.mu.RUnlock()
+	return global.upload != nil || global.download != nil
+}
+
+// NewLimiter returns a limiter that allows bytesPerSec with a one second burst.
+// Returns nil if bytesPerSec is zero or less.
+func NewLimiter(bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst(bytesPerSec))
+}
+
+// updateLimiter updates the rate of l in place so that in-progress transfers
+// pick up the change, or returns a new limiter if l is nil.
+func updateLimiter(l *rate.Limiter, bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	} else if l == nil {
+		return NewLimiter(bytesPerSec)
+	}
+	l.SetLimit(rate.Limit(bytesPerSec))
+	l.SetBurst(burst(bytesPerSec))
+	return l
+}
+
+// burst returns the bucket size for a given rate.
+func burst(bytesPerSec int64) int {
+	const maxBurst = 1 << 30
+	if bytesPerSec > maxBurst {
+		return maxBurst
+	}
+	return int(bytesPerSec)
+}
+
+var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.SnapshotRangeReader = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
+
+// ReplicaClient wraps another client and limits the bandwidth used when
+// writing & reading snapshots and WAL segments. Transfers must satisfy both
+// the client's limiters and the process-wide limiters.
+type ReplicaClient struct {
+	// Underlying client that calls are delegated to.
+	Client litestream.ReplicaClient
+
+	// Per-client limiters for writes & reads. Nil means unlimited.
+	UploadLimiter   *rate.Limiter
+	DownloadLimiter *rate.Limiter
+}
+
+// NewReplicaClient returns a new instance of ReplicaClient wrapping client.
+func NewReplicaClient(client litestream.ReplicaClient) *ReplicaClient {
+	return &ReplicaClient{Client: client}
+}
+
+// Unwrap returns the underlying client.
+func (c *ReplicaClient) Unwrap() litestream.ReplicaClient {
+	return c.Client
+}
+
+// Type returns the type of the underlying client.
+func (c *ReplicaClient) Type() string {
+	return c.Client.Type()
+}
+
+// Generations returns a list of available generation names.
+func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
+	return c.Client.Generations(ctx)
+}
+
+// DeleteGeneration deletes all snapshots & WAL segments within a generation.
+func (c *ReplicaClient) DeleteGeneration(ctx context.Context, generation string) error {
+	return c.Client.DeleteGeneration(ctx, generation)
+}
+
+// Snapshots returns an iterator over all available snapshots for a generation.
+func (c *ReplicaClient) Snapshots(ctx context.Context, generation string) (litestream.SnapshotIterator, error) {
+	return c.Client.Snapshots(ctx, generation)
+}
+
+// WriteSnapshot writes LZ4 compressed data from rd to the underlying client
+// at no more than the upload rate.
+func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (litestream.SnapshotInfo, error) {
+	return c.Client.WriteSnapshot(ctx, generation, index, c.uploadReader(ctx, rd))
+}
+
+// DeleteSnapshot deletes a snapshot with the given generation & index.
+func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
+	return c.Client.DeleteSnapshot(ctx, generation, index)
+}
+
+// SnapshotReader returns a reader for snapshot data at the given
+// generation/index which reads at no more than the download rate.
+func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+	rc, err := c.Client.SnapshotReader(ctx, generation, index)
+	if err != nil {
+		return nil, err
+	}
+	return c.downloadReader(ctx, rc), nil
+}
+
+// SnapshotRangeReader returns a reader for a range of snapshot data if the
+// underlying client supports ranged reads. Reads at no more than the
+// download rate.
+func (c *ReplicaClient) SnapshotRangeReader(ctx context.Context, generation string, index int, offset, size int64) (io.ReadCloser, error) {
+	rr, ok := c.Client.(litestream.SnapshotRangeReader)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support ranged reads", c.Client.Type())
+	}
+
+	rc, err := rr.SnapshotRangeReader(ctx, generation, index, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	return c.downloadReader(ctx, rc), nil
+}
+
+// WALSegments returns an iterator over all available WAL files for a generation.
+func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+	return c.Client.WALSegments(ctx, generation)
+}
+
+// WriteWALSegment writes LZ4 compressed data from rd to the underlying client
+// at no more than the upload rate.
+func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (litestream.WALSegmentInfo, error) {
+	return c.Client.WriteWALSegment(ctx, pos, c.uploadReader(ctx, rd))
+}
+
+// DeleteWALSegments deletes WAL segments at the given positions.
+func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Pos) error {
+	return c.Client.DeleteWALSegments(ctx, a)
+}
+
+// WALSegmentReader returns a reader for a section of WAL data at the given
+// position which reads at no more than the download rate.
+func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+	rc, err := c.Client.WALSegmentReader(ctx, pos)
+	if err != nil {
+		return nil, err
+	}
+	return c.downloadReader(ctx, rc), nil
+}
+
+// GenerationMetaReader returns a reader for the metadata of a generation if
+// the underlying client supports generation metadata.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	mc, ok := c.Client.(litestream.GenerationMetaClient)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support generation metadata", c.Client.Type())
+	}
+	return mc.GenerationMetaReader(ctx, generation)
+}
+
+// WriteGenerationMeta writes the metadata of a generation to the underlying client.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	mc, ok := c.Client.(litestream.GenerationMetaClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support generation metadata", c.Client.Type())
+	}
+	return mc.WriteGenerationMeta(ctx, generation, rd)
+}
+
+// LeaseReader returns a reader for the replica lease if the underlying client
+// supports leases. Leases are small so they are not rate limited.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+	return lc.LeaseReader(ctx)
+}
+
+// WriteLease writes the replica lease to the underlying client.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+	return lc.WriteLease(ctx, rd)
+}
+
+// DeleteLease deletes the replica lease from the underlying client.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+	return lc.DeleteLease(ctx)
+}
+
+// uploadReader returns rd wrapped with the upload limiters, if any.
+func (c *ReplicaClient) uploadReader(ctx context.Context, rd io.Reader) io.Reader {
+	if rd == nil {
+		return nil
+	}
+
+	global.mu.RLock()
+	limiters := nonNil(c.UploadLimiter, global.upload)
+	global.mu.RUnlock()
+
+	if len(limiters) == 0 {
+		return rd
+	}
+	return &reader{ctx: ctx, r: rd, limiters: limiters}
+}
+
+// downloadReader returns rc wrapped with the download limiters, if any.
+func (c *ReplicaClient) downloadReader(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	global.mu.RLock()
+	limiters := nonNil(c.DownloadLimiter, global.download)
+	global.mu.RUnlock()
+
+	if len(limiters) == 0 {
+		return rc
+	}
+	return &readCloser{reader: reader{ctx: ctx, r: rc, limiters: limiters}, c: rc}
+}
+
+// nonNil returns the non-nil limiters from a.
+func nonNil(a ...*rate.Limiter) []*rate.Limiter {
+	var other []*rate.Limiter
+	for _, l := range a {
+		if l != nil {
+			other = append(other, l)
+		}
+	}
+	return other
+}
+
+// reader waits on all limiters for each chunk of data read.
+type reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rate.Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	// Limit the read size to the smallest burst so a single wait can succeed.
+	for _, l := range r.limiters {
+		if b := l.Burst(); b > 0 && len(p) > b {
+			p = p[:b]
+		}
+	}
+
+	n, err := r.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	for _, l := range r.limiters {
+		if e := l.WaitN(r.ctx, n); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+// readCloser is a rate limited reader that closes the underlying reader.
+type readCloser struct {
+	reader
+	c io.Closer
+}
+
+func (r *readCloser) Close() error {
+	return r.c.Close()
+}
@@ -0,0 +1,75 @@
+package ratelimit_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/memory"
+	"github.com/benbjohnson/litestream/ratelimit"
+)
+
+func TestReplicaClient_WriteSnapshot(t *testing.T) {
+	c := ratelimit.NewReplicaClient(memory.NewReplicaClient())
+	c.UploadLimiter = ratelimit.NewLimiter(10000)
+
+	// The first second of data is allowed immediately by the burst so writing
+	// 1.5x the rate should take at least half a second.
+	t0 := time.Now()
+	if _, err := c.WriteSnapshot(context.Background(), "0123456789abcdef", 0, bytes.NewReader(make([]byte, 15000))); err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(t0); elapsed < 400*time.Millisecond {
+		t.Fatalf("write not limited: %s", elapsed)
+	}
+}
+
+func TestReplicaClient_WALSegmentReader(t *testing.T) {
+	c := ratelimit.NewReplicaClient(memory.NewReplicaClient())
+	c.DownloadLimiter = ratelimit.NewLimiter(10000)
+
+	pos := litestream.Pos{Generation: "0123456789abcdef"}
+	if _, err := c.WriteWALSegment(context.Background(), pos, bytes.NewReader(make([]byte, 15000))); err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Now()
+	rc, err := c.WALSegmentReader(context.Background(), pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	if b, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	} else if got, want := len(b), 15000; got != want {
+		t.Fatalf("len=%d, want %d", got, want)
+	} else if elapsed := time.Since(t0); elapsed < 400*time.Millisecond {
+		t.Fatalf("read not limited: %s", elapsed)
+	}
+}
+
+// Ensure the process-wide limit is shared by separate clients.
+func TestSetGlobalUploadLimit(t *testing.T) {
+	ratelimit.SetGlobalUploadLimit(10000)
+	defer ratelimit.SetGlobalUploadLimit(0)
+
+	if !ratelimit.HasGlobalLimit() {
+		t.Fatal("expected global limit")
+	}
+
+	c0 := ratelimit.NewReplicaClient(memory.NewReplicaClient())
+	c1 := ratelimit.NewReplicaClient(memory.NewReplicaClient())
+
+	t0 := time.Now()
+	if _, err := c0.WriteSnapshot(context.Background(), "0123456789abcdef", 0, strings.NewReader(strings.Repeat("x", 10000))); err != nil {
+		t.Fatal(err)
+	} else if _, err := c1.WriteSnapshot(context.Background(), "0123456789abcdef", 0, strings.NewReader(strings.Repeat("x", 5000))); err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(t0); elapsed < 400*time.Millisecond {
+		t.Fatalf("writes not limited: %s", elapsed)
+	}
+}
@@ -3,6 +3,7 @@ package litestream
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc64"
 	"io"
@@ -15,7 +16,6 @@ import (
 	"time"
 
 	"filippo.io/age"
-	"github.com/pierrec/lz4/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"golang.org/x/sync/errgroup"
@@ -28,6 +28,18 @@ const (
 	DefaultSyncInterval           = 1 * time.Second
 	DefaultRetention              = 24 * time.Hour
 	DefaultRetentionCheckInterval = 1 * time.Hour
+	DefaultMaxSegmentDelay        = 10 * time.Second
+)
+
+// Snapshot modes.
+const (
+	// SnapshotModeDirect streams the database file to the replica while
+	// checkpoints are blocked.
+	SnapshotModeDirect = "direct"
+
+	// SnapshotModeStaged copies the database file to a local staging file
+	// while checkpoints are blocked & uploads the copy once they resume.
+	SnapshotModeStaged = "staged"
 )
 
 // Replica connects a database to a replication destination via a ReplicaClient.
@@ -37,12 +49,20 @@ type Replica struct {
 	db   *DB
 	name string
 
-	mu  sync.RWMutex
-	pos Pos // current replicated position
+	mu        sync.RWMutex
+	pos       Pos           // current replicated position
+	posNotify chan struct{} // closes on position change
+	batchedAt time.Time     // time unreplicated WAL was first held back
+	dropped   bool          // shadow WAL released by the DB, snapshot required
+	metaGen   string        // generation whose metadata was last uploaded
 
 	muf sync.Mutex
 	f   *os.File // long-running file descriptor to avoid non-OFD lock issues
 
+	leaseMu sync.Mutex
+	lease   *Lease // currently held writer lease, if any
+	leaseID string // ID of the last lease written, kept across failed renewals
+
 	wg     sync.WaitGroup
 	cancel func()
 
@@ -52,6 +72,13 @@ type Replica struct {
 	// Time between syncs with the shadow WAL.
 	SyncInterval time.Duration
 
+	// Minimum size of automatically synced WAL segments, in bytes. Smaller
+	// segments are held back until enough data accumulates or the oldest
+	// unreplicated data reaches MaxSegmentDelay. Batching is disabled if
+	// either is zero.
+	MinSegmentSize  int64
+	MaxSegmentDelay time.Duration
+
 	// Frequency to create new snapshots.
 	SnapshotInterval time.Duration
 
@@ -62,6 +89,11 @@ type Replica struct {
 	// Time between checks for retention.
 	RetentionCheckInterval time.Duration
 
+	// Minimum number of WAL segments in a completed WAL index before they are
+	// merged into a single segment. Compaction runs after each retention
+	// check. Disabled if zero.
+	CompactionMinSegments int
+
 	// Time between validation checks.
 	ValidationInterval time.Duration
 
@@ -72,18 +104,48 @@ type Replica struct {
 	// Encryption identities and recipients
 	AgeIdentities []age.Identity
 	AgeRecipients []age.Recipient
+
+	// Compression codec & level used for new snapshots & WAL segments.
+	// Existing objects are read with whichever codec they were written with.
+	Codec            string
+	CompressionLevel int
+
+	// Determines how the database is read during a snapshot. See the
+	// SnapshotMode constants.
+	SnapshotMode string
+
+	// Directory for staged snapshots. Defaults to the DB's meta directory.
+	// Each database stages within its own subdirectory so the path can be
+	// shared between databases.
+	SnapshotStagingPath string
+
+	// Maximum number of delta snapshots written after a full snapshot. Delta
+	// snapshots only contain pages changed since the previous snapshot.
+	// Disabled if zero.
+	MaxDeltaSnapshots int
+
+	// Duration of the writer lease stored in the replica. The lease is
+	// acquired on start & renewed during sync. Disabled if zero.
+	LeaseTimeout time.Duration
+
+	// Identity recorded in the lease. Defaults to the hostname.
+	LeaseHolder string
 }
 
 func NewReplica(db *DB, name string) *Replica {
 	r := &Replica{
-		db:     db,
-		name:   name,
-		cancel: func() {},
+		db:        db,
+		name:      name,
+		cancel:    func() {},
+		posNotify: make(chan struct{}),
 
 		SyncInterval:           DefaultSyncInterval,
 		Retention:              DefaultRetention,
 		RetentionCheckInterval: DefaultRetentionCheckInterval,
+		MaxSegmentDelay:        DefaultMaxSegmentDelay,
 		MonitorEnabled:         true,
+		Codec:                  DefaultCodec,
+		LeaseHolder:            defaultLeaseHolder(),
 	}
 
 	return r
@@ -121,6 +183,14 @@ func (r *Replica) Start(ctx context.Context) error {
 	r.Logger().Debug("stopping previous replication")
 	r.Stop(false)
 
+	// Acquire writer lease, if enabled. Syncs retry the acquisition so the
+	// replica can take over once another writer's lease expires.
+	if r.LeaseTimeout > 0 {
+		if err := r.AcquireLease(ctx, false); err != nil {
+			r.Logger().Error("cannot acquire replica lease", "error", err)
+		}
+	}
+
 	// Wrap context with cancelation.
 	ctx, r.cancel = context.WithCancel(ctx)
 
@@ -143,6 +213,15 @@ func (r *Replica) Stop(hard bool) (err error) {
 	r.cancel()
 	r.wg.Wait()
 
+	// Release writer lease so another writer can take over immediately.
+	if hard && r.LeaseTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if e := r.ReleaseLease(ctx); e != nil {
+			r.Logger().Error("cannot release replica lease", "error", e)
+		}
+	}
+
 	r.muf.Lock()
 	defer r.muf.Unlock()
 	if hard && r.f != nil {
@@ -154,16 +233,26 @@ func (r *Replica) Stop(hard bool) (err error) {
 }
 
 // Sync copies new WAL frames from the shadow WAL to the replica client.
+// All frames are copied regardless of segment batching settings.
 func (r *Replica) Sync(ctx context.Context) (err error) {
+	return r.sync(ctx, true)
+}
+
+// sync copies new WAL frames to the replica client. If flush is false then
+// small segments may be held back for a later sync.
+func (r *Replica) sync(ctx context.Context, flush bool) (err error) {
 	// Clear last position if an error occurs during sync.
 	defer func() {
 		if err != nil {
-			r.mu.Lock()
-			r.pos = Pos{}
-			r.mu.Unlock()
+			r.setPos(Pos{})
 		}
 	}()
 
+	// Ensure no other writer is replicating to the same location.
+	if err := r.renewLease(ctx); err != nil {
+		return fmt.Errorf("lease: %w", err)
+	}
+
 	// Find current position of database.
 	dpos, err := r.db.Pos()
 	if err != nil {
@@ -176,13 +265,15 @@ func (r *Replica) Sync(ctx context.Context) (err error) {
 	r.Logger().Debug("replica sync", "position", dpos.String())
 
 	// Create a new snapshot and update the current replica position if
-	// the generation on the database has changed.
-	if r.Pos().Generation != generation {
+	// the generation on the database has changed or the shadow WAL the
+	// replica had not yet replicated was dropped.
+	dropped := r.shadowWALDropped()
+	if r.Pos().Generation != generation || dropped {
 		// Create snapshot if no snapshots exist for generation.
 		snapshotN, err := r.snapshotN(ctx, generation)
 		if err != nil {
 			return err
-		} else if snapshotN == 0 {
+		} else if snapshotN == 0 || dropped {
 			if info, err := r.Snapshot(ctx); err != nil {
 				return err
 			} else if info.Generation != generation {
@@ -190,6 +281,11 @@ func (r *Replica) Sync(ctx context.Context) (err error) {
 			}
 		}
 
+		// Copy generation lineage to the replica after its first snapshot.
+		if err := r.uploadGenerationMeta(ctx, generation); err != nil {
+			return fmt.Errorf("cannot write generation metadata: %w", err)
+		}
+
 		pos, err := r.calcPos(ctx, generation)
 		if err != nil {
 			return fmt.Errorf("cannot determine replica position: %s", err)
@@ -197,13 +293,14 @@ func (r *Replica) Sync(ctx context.Context) (err error) {
 
 		r.Logger().Debug("replica sync: calc new pos", "position", pos.String())
 		r.mu.Lock()
-		r.pos = pos
+		r.dropped = false
 		r.mu.Unlock()
+		r.setPos(pos)
 	}
 
 	// Read all WAL files since the last position.
 	for {
-		if err = r.syncWAL(ctx); err == io.EOF {
+		if err = r.syncWAL(ctx, flush); err == io.EOF {
 			break
 		} else if err != nil {
 			return err
@@ -213,7 +310,7 @@ func (r *Replica) Sync(ctx context.Context) (err error) {
 	return nil
 }
 
-func (r *Replica) syncWAL(ctx context.Context) (err error) {
+func (r *Replica) syncWAL(ctx context.Context, flush bool) (err error) {
 	rd, err := r.db.ShadowWALReader(r.Pos())
 	if err == io.EOF {
 		return err
@@ -222,20 +319,106 @@ func (r *Replica) syncWAL(ctx context.Context) (err error) {
 	}
 	defer rd.Close()
 
-	// Copy shadow WAL to client write via io.Pipe().
-	pr, pw := io.Pipe()
-	defer func() { _ = pw.CloseWithError(err) }()
+	// Hold back small segments until a later sync, if batching is enabled.
+	if !flush && r.holdSegment(rd) {
+		return io.EOF
+	}
 
 	// Obtain initial position from shadow reader.
 	// It may have moved to the next index if previous position was at the end.
-	pos := rd.Pos()
-	initialPos := pos
+	initialPos := rd.Pos()
 	startTime := time.Now()
-	var bytesWritten int
 
 	logger := r.Logger()
 	logger.Info("write wal segment", "position", initialPos.String())
 
+	// Encode the segment once if other replicas use the same codec &
+	// encryption. Otherwise stream it directly to the client.
+	var pos Pos
+	var bytesWritten int
+	if n := r.db.sharedReplicaN(r, false); n > 1 && r.db.canSpool(rd.N()) {
+		pos, bytesWritten, err = r.writeSharedWALSegment(ctx, rd, n)
+	} else {
+		pos, bytesWritten, err = r.writeWALSegment(ctx, rd)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Track total WAL bytes written to replica client.
+	replicaWALBytesCounterVec.WithLabelValues(r.db.Path(), r.Name()).Add(float64(bytesWritten))
+
+	// Save last replicated position & start a new batch.
+	r.setPos(pos)
+	r.mu.Lock()
+	r.batchedAt = time.Time{}
+	r.mu.Unlock()
+
+	// Track current position
+	replicaWALIndexGaugeVec.WithLabelValues(r.db.Path(), r.Name()).Set(float64(pos.Index))
+	replicaWALOffsetGaugeVec.WithLabelValues(r.db.Path(), r.Name()).Set(float64(pos.Offset))
+
+	logger.Info("wal segment written", "position", initialPos.String(), "elapsed", time.Since(startTime).String(), "sz", bytesWritten)
+	return nil
+}
+
+// dropShadowWAL marks the shadow WAL the replica has not yet replicated as
+// released by the DB. The replica writes a new snapshot on its next sync.
+func (r *Replica) dropShadowWAL() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropped = true
+}
+
+// shadowWALDropped returns true if the shadow WAL has been released by the DB
+// since the replica's last snapshot.
+func (r *Replica) shadowWALDropped() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dropped
+}
+
+// holdSegment returns true if the segment available from rd is below the
+// minimum segment size & the oldest held back data is within the maximum
+// delay. Segments cannot span WAL indexes so a segment is never held back
+// once the database has moved to a later index.
+func (r *Replica) holdSegment(rd *ShadowWALReader) bool {
+	if r.MinSegmentSize <= 0 || r.MaxSegmentDelay <= 0 || rd.N() >= r.MinSegmentSize {
+		return false
+	} else if dpos, err := r.db.Pos(); err != nil || dpos.Generation != rd.Pos().Generation || dpos.Index != rd.Pos().Index {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.batchedAt.IsZero() {
+		r.batchedAt = time.Now()
+	}
+	return time.Since(r.batchedAt) < r.MaxSegmentDelay
+}
+
+// batchDeadline returns the time held back WAL data must be synced by.
+// Returns the zero time if no data is held back.
+func (r *Replica) batchDeadline() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.batchedAt.IsZero() {
+		return time.Time{}
+	}
+	return r.batchedAt.Add(r.MaxSegmentDelay)
+}
+
+// writeWALSegment streams a WAL segment from rd to the client. Returns the
+// position after the segment & the number of uncompressed bytes written.
+func (r *Replica) writeWALSegment(ctx context.Context, rd *ShadowWALReader) (_ Pos, n int, err error) {
+	pos := rd.Pos()
+
+	// Copy shadow WAL to client write via io.Pipe().
+	pr, pw := io.Pipe()
+	defer func() { _ = pw.CloseWithError(err) }()
+
 	// Copy through pipe into client from the starting position.
 	var g errgroup.Group
 	g.Go(func() error {
@@ -249,39 +432,75 @@ func (r *Replica) syncWAL(ctx context.Context) (err error) {
 		return err
 	})
 
-	var ew io.WriteCloser = pw
+	if n, err = r.encodeWALSegment(pw, rd); err != nil {
+		return Pos{}, n, err
+	} else if err := pw.Close(); err != nil {
+		return Pos{}, n, err
+	}
+
+	// Wait for client to finish write.
+	if err := g.Wait(); err != nil {
+		return Pos{}, n, fmt.Errorf("client write: %w", err)
+	}
+	return rd.Pos(), n, nil
+}
+
+// writeSharedWALSegment encodes a WAL segment once for the n replicas with
+// the same encoding & uploads the shared copy to the client. Another replica
+// may have already encoded a segment from the same position, in which case
+// its copy is used & the position after it is returned.
+func (r *Replica) writeSharedWALSegment(ctx context.Context, rd *ShadowWALReader, n int) (Pos, int, error) {
+	pos := rd.Pos()
+
+	key := fmt.Sprintf("wal/%s/%s", pos.String(), r.encodingKey())
+	obj, err := r.db.acquireSharedObject(ctx, key, n, func(w io.Writer) (Pos, int, error) {
+		sz, err := r.encodeWALSegment(w, rd)
+		return rd.Pos(), sz, err
+	})
+	if err != nil {
+		return Pos{}, 0, err
+	}
+	defer r.db.releaseSharedObject(obj)
+
+	if _, err := r.Client.WriteWALSegment(ctx, pos, obj.Reader()); err != nil {
+		return Pos{}, 0, fmt.Errorf("client write: %w", err)
+	}
+	return obj.end, obj.n, nil
+}
+
+// encodeWALSegment compresses & encrypts the WAL frames from rd to w. Returns
+// the number of uncompressed bytes written.
+func (r *Replica) encodeWALSegment(w io.Writer, rd *ShadowWALReader) (bytesWritten int, err error) {
+	var ew io.WriteCloser = nopWriteCloser{w}
 
 	// Add encryption if we have recipients.
 	if len(r.AgeRecipients) > 0 {
-		var err error
-		ew, err = age.Encrypt(pw, r.AgeRecipients...)
-		if err != nil {
-			return err
+		if ew, err = age.Encrypt(w, r.AgeRecipients...); err != nil {
+			return 0, err
 		}
 		defer ew.Close()
 	}
 
-	// Wrap writer to LZ4 compress.
-	zw := lz4.NewWriter(ew)
-
-	// Track total WAL bytes written to replica client.
-	walBytesCounter := replicaWALBytesCounterVec.WithLabelValues(r.db.Path(), r.Name())
+	// Wrap writer to compress with the configured codec.
+	zw, err := newCompressor(ew, r.Codec, r.CompressionLevel)
+	if err != nil {
+		return 0, err
+	}
 
 	// Copy header if at offset zero.
 	var psalt uint64 // previous salt value
 	if pos := rd.Pos(); pos.Offset == 0 {
 		buf := make([]byte, WALHeaderSize)
 		if _, err := io.ReadFull(rd, buf); err != nil {
-			return err
+			return bytesWritten, err
 		}
 
 		psalt = binary.BigEndian.Uint64(buf[16:24])
 
 		n, err := zw.Write(buf)
 		if err != nil {
-			return err
+			return bytesWritten, err
 		}
-		walBytesCounter.Add(float64(n))
 		bytesWritten += n
 	}
 
@@ -294,49 +513,30 @@ func (r *Replica) syncWAL(ctx context.Context) (err error) {
 		if _, err := io.ReadFull(rd, buf); err == io.EOF {
 			break
 		} else if err != nil {
-			return err
+			return bytesWritten, err
 		}
 
 		// Verify salt matches the previous frame/header read.
 		salt := binary.BigEndian.Uint64(buf[8:16])
 		if psalt != 0 && psalt != salt {
-			return fmt.Errorf("replica salt mismatch: %s", pos.String())
+			return bytesWritten, fmt.Errorf("replica salt mismatch: %s", pos.String())
 		}
 		psalt = salt
 
 		n, err := zw.Write(buf)
 		if err != nil {
-			return err
+			return bytesWritten, err
 		}
-		walBytesCounter.Add(float64(n))
 		bytesWritten += n
 	}
 
-	// Flush LZ4 writer, encryption writer and close pipe.
+	// Flush compression writer & encryption writer.
 	if err := zw.Close(); err != nil {
-		return err
+		return bytesWritten, err
 	} else if err := ew.Close(); err != nil {
-		return err
-	} else if err := pw.Close(); err != nil {
-		return err
-	}
-
-	// Wait for client to finish write.
-	if err := g.Wait(); err != nil {
-		return fmt.Errorf("client write: %w", err)
+		return bytesWritten, err
 	}
-
-	// Save last replicated position.
-	r.mu.Lock()
-	r.pos = rd.Pos()
-	r.mu.Unlock()
-
-	// Track current position
-	replicaWALIndexGaugeVec.WithLabelValues(r.db.Path(), r.Name()).Set(float64(rd.Pos().Index))
-	replicaWALOffsetGaugeVec.WithLabelValues(r.db.Path(), r.Name()).Set(float64(rd.Pos().Offset))
-
-	logger.Info("wal segment written", "position", initialPos.String(), "elapsed", time.Since(startTime).String(), "sz", bytesWritten)
-	return nil
+	return bytesWritten, nil
 }
 
 // snapshotN returns the number of snapshots for a generation.
@@ -364,11 +564,12 @@ func (r *Replica) calcPos(ctx context.Context, generation string) (pos Pos, err
 		return pos, fmt.Errorf("no snapshot available: generation=%s", generation)
 	}
 
-	// Determine last WAL segment available. Use snapshot if none exist.
+	// Determine last WAL segment available. Use snapshot if none exist or
+	// if the snapshot was written after the last segment.
 	segment, err := r.maxWALSegment(ctx, generation)
 	if err != nil {
 		return pos, fmt.Errorf("max wal segment: %w", err)
-	} else if segment == nil {
+	} else if segment == nil || segment.Index < snapshot.Index {
 		return Pos{Generation: snapshot.Generation, Index: snapshot.Index}, nil
 	}
 
@@ -388,7 +589,13 @@ func (r *Replica) calcPos(ctx context.Context, generation string) (pos Pos, err
 		rd = io.NopCloser(drd)
 	}
 
-	n, err := io.Copy(io.Discard, lz4.NewReader(rd))
+	zr, err := newDecompressor(rd)
+	if err != nil {
+		return pos, err
+	}
+	defer zr.Close()
+
+	n, err := io.Copy(io.Discard, zr)
 	if err != nil {
 		return pos, err
 	}
@@ -443,6 +650,56 @@ func (r *Replica) Pos() Pos {
 	return r.pos
 }
 
+// setPos updates the current replicated position & notifies waiters.
+func (r *Replica) setPos(pos Pos) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pos = pos
+	close(r.posNotify)
+	r.posNotify = make(chan struct{})
+}
+
+// WaitPos blocks until the replica has replicated up to at least pos.
+//
+// Returns ErrGenerationChanged if the database has moved to a new generation
+// since the replica can no longer reach pos. Callers should use a context
+// with a deadline to bound how long to wait.
+func (r *Replica) WaitPos(ctx context.Context, pos Pos) error {
+	if pos.Generation == "" {
+		return fmt.Errorf("generation required")
+	}
+
+	for {
+		r.mu.RLock()
+		curr, notify := r.pos, r.posNotify
+		r.mu.RUnlock()
+
+		// Exit if the replica is at or past the target position.
+		if curr.Generation == pos.Generation {
+			if curr.Index > pos.Index || (curr.Index == pos.Index && curr.Offset >= pos.Offset) {
+				return nil
+			}
+		}
+
+		// Exit if the database has started a new generation as there will be
+		// no further progress on the old generation.
+		if r.db != nil {
+			if generation, err := r.db.CurrentGeneration(); err != nil {
+				return fmt.Errorf("cannot determine current generation: %w", err)
+			} else if generation != "" && generation != pos.Generation {
+				return ErrGenerationChanged
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
 // Snapshots returns a list of all snapshots across all generations.
 func (r *Replica) Snapshots(ctx context.Context) ([]SnapshotInfo, error) {
 	generations, err := r.Client.Generations(ctx)
@@ -476,15 +733,29 @@ func (r *Replica) Snapshots(ctx context.Context) ([]SnapshotInfo, error) {
 	return a, nil
 }
 
-// Snapshot copies the entire database to the replica path.
+// Snapshot copies the database to the replica path. If delta snapshots are
+// enabled, only the pages changed since the previous snapshot may be copied.
 func (r *Replica) Snapshot(ctx context.Context) (info SnapshotInfo, err error) {
 	if r.db == nil || r.db.db == nil {
 		return info, fmt.Errorf("no database available")
 	}
 
+	if err := r.renewLease(ctx); err != nil {
+		return info, fmt.Errorf("lease: %w", err)
+	}
+
 	r.muf.Lock()
 	defer r.muf.Unlock()
 
+	// Upload a snapshot encoded by another replica at the current WAL index,
+	// if one exists, instead of checkpointing & encoding another one.
+	sharedN := r.db.sharedReplicaN(r, true)
+	if sharedN > 1 {
+		if info, ok, err := r.writeSharedSnapshot(ctx, sharedN); err != nil || ok {
+			return info, err
+		}
+	}
+
 	// Issue a passive checkpoint to flush any pages to disk before snapshotting.
 	if err := r.db.Checkpoint(ctx, CheckpointModePassive); err != nil {
 		return info, fmt.Errorf("pre-snapshot checkpoint: %w", err)
@@ -492,7 +763,14 @@ func (r *Replica) Snapshot(ctx context.Context) (info SnapshotInfo, err error) {
 
 	// Prevent internal checkpoints during snapshot.
 	r.db.BeginSnapshot()
-	defer r.db.EndSnapshot()
+	locked := true
+	unlock := func() {
+		if locked {
+			locked = false
+			r.db.EndSnapshot()
+		}
+	}
+	defer unlock()
 
 	// Acquire a read lock on the database during snapshot to prevent external checkpoints.
 	tx, err := r.db.db.Begin()
@@ -522,59 +800,220 @@ func (r *Replica) Snapshot(ctx context.Context) (info SnapshotInfo, err error) {
 		return info, err
 	}
 
-	// Use a pipe to convert the LZ4 writer to a reader.
-	pr, pw := io.Pipe()
+	// Copy the database to a local staging file, if enabled, so checkpoints
+	// can resume while the snapshot is compressed & uploaded.
+	f := r.f
+	if r.SnapshotMode == SnapshotModeStaged {
+		staged, err := r.stageSnapshot()
+		if err != nil {
+			return info, fmt.Errorf("cannot stage snapshot: %w", err)
+		} else if staged != nil {
+			defer func() {
+				_ = staged.Close()
+				_ = os.Remove(staged.Name())
+			}()
 
-	// Copy the database file to the LZ4 writer in a separate goroutine.
-	var g errgroup.Group
-	g.Go(func() error {
-		// We need to ensure the pipe is closed.
-		defer pw.Close()
+			f = staged
+			_ = tx.Rollback()
+			unlock()
+		}
+	}
+
+	// Determine whether the full database or only changed pages are written.
+	plan, err := r.planSnapshot(ctx, pos, f)
+	if err != nil {
+		return info, fmt.Errorf("cannot plan snapshot: %w", err)
+	}
+	defer func() { _ = plan.Close() }()
 
-		var wc io.WriteCloser = pw
+	logger := r.Logger()
+	logger.Info("write snapshot", "position", pos.String(), "delta", plan.IsDelta(), "pages", len(plan.pgnos))
 
-		// Add encryption if we have recipients.
-		if len(r.AgeRecipients) > 0 {
-			var err error
-			wc, err = age.Encrypt(pw, r.AgeRecipients...)
-			if err != nil {
-				pw.CloseWithError(err)
-				return err
-			}
-			defer wc.Close()
+	startTime := time.Now()
+
+	// Fall back to a direct upload if the spool lacks space for a large database.
+	shared := sharedN > 1
+	if shared {
+		fi, err := f.Stat()
+		if err != nil {
+			return info, err
+		}
+		shared = r.db.canSpool(fi.Size())
+	}
+
+	if shared {
+		// Encode once for all replicas with the same codec & encryption.
+		obj, err := r.db.acquireSharedObject(ctx, r.sharedSnapshotKey(pos), sharedN, func(w io.Writer) (Pos, int, error) {
+			return pos, 0, r.encodeSnapshot(w, f, plan)
+		})
+		if err != nil {
+			return info, err
 		}
+		defer r.db.releaseSharedObject(obj)
 
-		zr := lz4.NewWriter(wc)
-		defer zr.Close()
+		// Release database locks before the shared copy is uploaded.
+		_ = tx.Rollback()
+		unlock()
+
+		pos = obj.end
+		if info, err = r.Client.WriteSnapshot(ctx, pos.Generation, pos.Index, obj.Reader()); err != nil {
+			return info, err
+		}
+	} else {
+		// Use a pipe to convert the compression writer to a reader.
+		pr, pw := io.Pipe()
 
-		if _, err := io.Copy(zr, r.f); err != nil {
-			pw.CloseWithError(err)
+		// Copy the database file to the compression writer in a separate goroutine.
+		var g errgroup.Group
+		g.Go(func() error {
+			err := r.encodeSnapshot(pw, f, plan)
+			_ = pw.CloseWithError(err)
 			return err
-		} else if err := zr.Close(); err != nil {
-			pw.CloseWithError(err)
+		})
+
+		// Delegate write to client & wait for writer goroutine to finish.
+		if info, err = r.Client.WriteSnapshot(ctx, pos.Generation, pos.Index, pr); err != nil {
+			return info, err
+		} else if err := g.Wait(); err != nil {
+			return info, err
+		}
+	}
+
+	if err := plan.Commit(); err != nil {
+		return info, fmt.Errorf("cannot save page checksums: %w", err)
+	}
+
+	logger.Info("snapshot written", "position", pos.String(), "elapsed", time.Since(startTime).String(), "sz", info.Size)
+	return info, nil
+}
+
+// encodeSnapshot writes the snapshot data from f to w, compressed &
+// encrypted. Delta snapshots begin with an unencrypted header.
+func (r *Replica) encodeSnapshot(w io.Writer, f *os.File, plan *snapshotPlan) error {
+	if err := plan.WriteHeader(w); err != nil {
+		return err
+	}
+
+	var wc io.WriteCloser = nopWriteCloser{w}
+
+	// Add encryption if we have recipients.
+	if len(r.AgeRecipients) > 0 {
+		var err error
+		if wc, err = age.Encrypt(w, r.AgeRecipients...); err != nil {
 			return err
 		}
-		return wc.Close()
-	})
+		defer wc.Close()
+	}
+
+	zw, err := newCompressor(wc, r.Codec, r.CompressionLevel)
+	if err != nil {
+		return err
+	}
+	defer zw.Close()
+
+	if err := plan.WriteData(zw, f); err != nil {
+		return err
+	} else if err := zw.Close(); err != nil {
+		return err
+	}
+	return wc.Close()
+}
+
+// sharedSnapshotKey returns the key of a shared snapshot at pos. The key
+// includes the WAL index so a snapshot is only shared until the database is
+// next checkpointed.
+func (r *Replica) sharedSnapshotKey(pos Pos) string {
+	return fmt.Sprintf("snapshot/%s/%08x/%s", pos.Generation, pos.Index, r.encodingKey())
+}
+
+// writeSharedSnapshot uploads a snapshot already encoded by another replica
+// at the database's current WAL index. Returns false if none exists.
+func (r *Replica) writeSharedSnapshot(ctx context.Context, n int) (info SnapshotInfo, ok bool, err error) {
+	pos, err := r.db.Pos()
+	if err != nil {
+		return info, false, fmt.Errorf("cannot determine db position: %w", err)
+	} else if pos.IsZero() {
+		return info, false, ErrNoGeneration
+	}
+
+	obj, err := r.db.acquireSharedObject(ctx, r.sharedSnapshotKey(pos), n, nil)
+	if err != nil || obj == nil {
+		return info, false, err
+	}
+	defer r.db.releaseSharedObject(obj)
+
+	// Remove stale checksums as a full snapshot is written.
+	if err := os.Remove(r.pageChecksumsPath(pos.Generation)); err != nil && !os.IsNotExist(err) {
+		return info, true, err
+	}
 
 	logger := r.Logger()
-	logger.Info("write snapshot", "position", pos.String())
+	logger.Info("write snapshot", "position", obj.end.String(), "delta", false, "shared", true)
 
 	startTime := time.Now()
-	// Delegate write to client & wait for writer goroutine to finish.
-	if info, err = r.Client.WriteSnapshot(ctx, pos.Generation, pos.Index, pr); err != nil {
-		return info, err
-	} else if err := g.Wait(); err != nil {
-		return info, err
+	if info, err = r.Client.WriteSnapshot(ctx, obj.end.Generation, obj.end.Index, obj.Reader()); err != nil {
+		return info, true, err
 	}
 
-	logger.Info("snapshot written", "position", pos.String(), "elapsed", time.Since(startTime).String(), "sz", info.Size)
-	return info, nil
+	logger.Info("snapshot written", "position", obj.end.String(), "elapsed", time.Since(startTime).String(), "sz", info.Size)
+	return info, true, nil
+}
+
+// stageSnapshot copies the database file to the staging directory & returns
+// the copy positioned at the start. Returns nil if the staging directory does
+// not have enough free space, in which case the database is read directly.
+func (r *Replica) stageSnapshot() (*os.File, error) {
+	// Databases may share a staging path so stage within a directory that is
+	// unique to the database.
+	dir := filepath.Join(r.db.MetaPath(), "staging")
+	if r.SnapshotStagingPath != "" {
+		id := crc64.Checksum([]byte(r.db.MetaPath()), crc64.MakeTable(crc64.ISO))
+		dir = filepath.Join(r.SnapshotStagingPath, fmt.Sprintf("%016x", id))
+	}
+	if err := internal.MkdirAll(dir, r.db.dirInfo); err != nil {
+		return nil, err
+	}
+
+	fi, err := r.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave a margin of free space so staging does not fill the disk.
+	if free, err := internal.DiskFree(dir); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return nil, fmt.Errorf("cannot determine free space: %w", err)
+	} else if need := uint64(fi.Size() + fi.Size()/10); err == nil && free < need {
+		r.Logger().Warn("insufficient space to stage snapshot, reading database directly", "path", dir, "free", free, "need", need)
+		return nil, nil
+	}
+
+	startTime := time.Now()
+
+	f, err := internal.CreateFile(filepath.Join(dir, r.Name()+".snapshot"), r.db.fileInfo)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, io.NewSectionReader(r.f, 0, fi.Size())); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+
+	r.Logger().Info("snapshot staged", "path", f.Name(), "sz", fi.Size(), "elapsed", time.Since(startTime).String())
+	return f, nil
 }
 
 // EnforceRetention forces a new snapshot once the retention interval has passed.
 // Older snapshots and WAL files are then removed.
 func (r *Replica) EnforceRetention(ctx context.Context) (err error) {
+	if err := r.renewLease(ctx); err != nil {
+		return fmt.Errorf("lease: %w", err)
+	}
+
 	// Obtain list of snapshots that are within the retention period.
 	snapshots, err := r.Snapshots(ctx)
 	if err != nil {
@@ -608,8 +1047,14 @@ func (r *Replica) EnforceRetention(ctx context.Context) (err error) {
 			continue
 		}
 
+		// Keep the snapshots that the earliest retained snapshot is built upon.
+		chain, err := r.SnapshotChain(ctx, generation, snapshot.Index)
+		if err != nil {
+			return fmt.Errorf("snapshot chain: %w", err)
+		}
+
 		// Otherwise remove all earlier snapshots & WAL segments.
-		if err := r.deleteSnapshotsBeforeIndex(ctx, generation, snapshot.Index); err != nil {
+		if err := r.deleteSnapshotsBeforeIndex(ctx, generation, chain[0]); err != nil {
 			return fmt.Errorf("delete snapshots before index: %w", err)
 		} else if err := r.deleteWALSegmentsBeforeIndex(ctx, generation, snapshot.Index); err != nil {
 			return fmt.Errorf("delete wal segments before index: %w", err)
@@ -698,19 +1143,31 @@ func (r *Replica) monitor(ctx context.Context) {
 			}
 		}
 
-		// Wait for changes to the database.
+		// Wait for changes to the database or for held back WAL data to
+		// reach its maximum delay.
+		var timer *time.Timer
+		var deadline <-chan time.Time
+		if t := r.batchDeadline(); !t.IsZero() {
+			timer = time.NewTimer(time.Until(t))
+			deadline = timer.C
+		}
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-notify:
 			r.Logger().Info("performing initial sync")
-		}
 
-		// Fetch new notify channel before replicating data.
-		notify = r.db.Notify()
+			// Fetch new notify channel before replicating data.
+			notify = r.db.Notify()
+		case <-deadline:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
 
 		// Synchronize the shadow wal into the replication directory.
-		if err := r.Sync(ctx); err != nil {
+		if err := r.sync(ctx, false); err != nil {
 			r.Logger().Error("monitor error", "error", err)
 			continue
 		}
@@ -742,6 +1199,13 @@ func (r *Replica) retainer(ctx context.Context) {
 				r.Logger().Error("retainer error", "error", err)
 				continue
 			}
+
+			// Merge small WAL segments in the current generation, if enabled.
+			if generation := r.Pos().Generation; r.CompactionMinSegments > 0 && generation != "" {
+				if _, err := r.CompactWAL(ctx, generation, r.CompactionMinSegments); err != nil {
+					r.Logger().Error("compaction error", "error", err)
+				}
+			}
 		}
 	}
 }
@@ -841,7 +1305,9 @@ func (r *Replica) Validate(ctx context.Context) error {
 	}
 
 	// Wait until replica catches up to position.
-	if err := r.waitForReplica(ctx, pos); err != nil {
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := r.WaitPos(waitCtx, pos); err != nil {
 		return fmt.Errorf("cannot wait for replica: %w", err)
 	}
 
@@ -891,57 +1357,6 @@ func (r *Replica) Validate(ctx context.Context) error {
 	return nil
 }
 
-// waitForReplica blocks until replica reaches at least the given position.
-func (r *Replica) waitForReplica(ctx context.Context, pos Pos) error {
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	timer := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	once := make(chan struct{}, 1)
-	once <- struct{}{}
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-timer.C:
-			return fmt.Errorf("replica wait exceeded timeout")
-		case <-ticker.C:
-		case <-once: // immediate on first check
-		}
-
-		// Obtain current position of replica, check if past target position.
-		curr := r.Pos()
-		if curr.IsZero() {
-			r.Logger().Info("validator: no replica position available")
-			continue
-		}
-
-		// Exit if the generation has changed while waiting as there will be
-		// no further progress on the old generation.
-		if curr.Generation != pos.Generation {
-			return fmt.Errorf("generation changed")
-		}
-
-		ready := true
-		if curr.Index < pos.Index {
-			ready = false
-		} else if curr.Index == pos.Index && curr.Offset < pos.Offset {
-			ready = false
-		}
-
-		// If not ready, restart loop.
-		if !ready {
-			continue
-		}
-
-		// Current position at or after target position.
-		return nil
-	}
-}
-
 // GenerationCreatedAt returns the earliest creation time of any snapshot.
 // Returns zero time if no snapshots exist.
 func (r *Replica) GenerationCreatedAt(ctx context.Context, generation string) (time.Time, error) {
@@ -1122,9 +1537,16 @@ func (r *Replica) Restore(ctx context.Context, opt RestoreOptions) (err error) {
 	pos := Pos{Generation: opt.Generation, Index: minWALIndex}
 	tmpPath := opt.OutputPath + ".tmp"
 
+	// Explain where the generation forked from, if known.
+	if meta, err := r.GenerationMeta(ctx, opt.Generation); err != nil {
+		r.Logger().Warn("cannot read generation metadata", "generation", opt.Generation, "error", err)
+	} else if meta != nil && meta.ParentGeneration != "" {
+		r.Logger().Info("generation forked from parent", "generation", opt.Generation, "parent", meta.ParentPos().String(), "reason", meta.Reason, "hostname", meta.Hostname, "created", meta.CreatedAt)
+	}
+
 	// Copy snapshot to output path.
 	r.Logger().Info("restoring snapshot", "generation", opt.Generation, "index", minWALIndex, "path", tmpPath)
-	if err := r.restoreSnapshot(ctx, pos.Generation, pos.Index, tmpPath); err != nil {
+	if err := r.restoreSnapshot(ctx, pos.Generation, pos.Index, tmpPath, opt.Parallelism, opt.SnapshotChunkSize); err != nil {
 		return fmt.Errorf("cannot restore snapshot: %w", err)
 	}
 
@@ -1345,7 +1767,7 @@ func (r *Replica) walSegmentMap(ctx context.Context, generation string, minIndex
 }
 
 // restoreSnapshot copies a snapshot from the replica to a file.
-func (r *Replica) restoreSnapshot(ctx context.Context, generation string, index int, filename string) error {
+func (r *Replica) restoreSnapshot(ctx context.Context, generation string, index int, filename string, parallelism int, chunkSize int64) error {
 	// Determine the user/group & mode based on the DB, if available.
 	var fileInfo, dirInfo os.FileInfo
 	if db := r.DB(); db != nil {
@@ -1362,12 +1784,51 @@ func (r *Replica) restoreSnapshot(ctx context.Context, generation string, index
 	}
 	defer f.Close()
 
-	rd, err := r.Client.SnapshotReader(ctx, generation, index)
+	if err := r.copySnapshot(ctx, f, generation, index, parallelism, chunkSize); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// copySnapshot writes the contents of a snapshot to f. Delta snapshots are
+// applied on top of their base snapshot, which is copied first.
+func (r *Replica) copySnapshot(ctx context.Context, f *os.File, generation string, index int, parallelism int, chunkSize int64) error {
+	base, err := r.snapshotBase(ctx, generation, index)
 	if err != nil {
 		return err
+	} else if base >= 0 {
+		if err := r.copySnapshot(ctx, f, generation, base, parallelism, chunkSize); err != nil {
+			return err
+		}
+		r.Logger().Info("applying delta snapshot", "generation", generation, "index", index, "base", base)
+	}
+
+	// Download large snapshots in parallel chunks, if supported. The chunks
+	// are reassembled in a temporary file before decryption & decompression.
+	var rd io.ReadCloser
+	if rr, ok := UnwrapClient[SnapshotRangeReader](r.Client); ok && parallelism > 1 {
+		tmpPath := f.Name() + ".snapshot"
+		defer os.Remove(tmpPath)
+
+		if rd, err = r.downloadSnapshot(ctx, rr, generation, index, tmpPath, parallelism, chunkSize); err != nil {
+			return err
+		}
+	} else {
+		if rd, err = r.Client.SnapshotReader(ctx, generation, index); err != nil {
+			return err
+		}
 	}
 	defer rd.Close()
 
+	// Skip the unencrypted delta header.
+	if base >= 0 {
+		if _, err := io.CopyN(io.Discard, rd, deltaSnapshotHeaderSize); err != nil {
+			return err
+		}
+	}
+
 	if len(r.AgeIdentities) > 0 {
 		drd, err := age.Decrypt(rd, r.AgeIdentities...)
 		if err != nil {
@@ -1377,43 +1838,100 @@ func (r *Replica) restoreSnapshot(ctx context.Context, generation string, index
 		rd = io.NopCloser(drd)
 	}
 
-	if _, err := io.Copy(f, lz4.NewReader(rd)); err != nil {
-		return err
-	} else if err := f.Sync(); err != nil {
+	zr, err := newDecompressor(rd)
+	if err != nil {
 		return err
 	}
-	return f.Close()
+	defer zr.Close()
+
+	if base >= 0 {
+		return applyDeltaSnapshot(f, zr)
+	}
+	_, err = io.Copy(f, zr)
+	return err
 }
 
-// downloadWAL copies a WAL file from the replica to a local copy next to the DB.
-// The WAL is later applied by applyWAL(). This function can be run in parallel
-// to download multiple WAL files simultaneously.
-func (r *Replica) downloadWAL(ctx context.Context, generation string, index int, offsets []int64, dbPath string) (err error) {
-	// Determine the user/group & mode based on the DB, if available.
-	var fileInfo os.FileInfo
-	if db := r.DB(); db != nil {
-		fileInfo = db.fileInfo
+// downloadSnapshot downloads a snapshot to filename using parallel ranged
+// reads & returns the file positioned at the start. Snapshots that fit in a
+// single chunk are read directly from the client.
+func (r *Replica) downloadSnapshot(ctx context.Context, rr SnapshotRangeReader, generation string, index int, filename string, parallelism int, chunkSize int64) (io.ReadCloser, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultSnapshotChunkSize
 	}
 
-	// Open readers for every segment in the WAL file, in order.
-	var readers []io.Reader
-	for _, offset := range offsets {
-		rd, err := r.Client.WALSegmentReader(ctx, Pos{Generation: generation, Index: index, Offset: offset})
-		if err != nil {
-			return err
+	// Look up the snapshot size so it can be split into chunks.
+	itr, err := r.Client.Snapshots(ctx, generation)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+
+	size := int64(-1)
+	for itr.Next() {
+		if info := itr.Snapshot(); info.Index == index {
+			size = info.Size
 		}
-		defer rd.Close()
+	}
+	if err := itr.Close(); err != nil {
+		return nil, err
+	} else if size == -1 {
+		return nil, os.ErrNotExist
+	} else if size <= chunkSize {
+		return r.Client.SnapshotReader(ctx, generation, index)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
 
-		if len(r.AgeIdentities) > 0 {
-			drd, err := age.Decrypt(rd, r.AgeIdentities...)
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallelism)
+	for offset := int64(0); offset < size; offset += chunkSize {
+		offset, n := offset, min(chunkSize, size-offset)
+		g.Go(func() error {
+			rd, err := rr.SnapshotRangeReader(ctx, generation, index, offset, n)
 			if err != nil {
 				return err
 			}
+			defer rd.Close()
 
-			rd = io.NopCloser(drd)
-		}
+			if m, err := io.Copy(io.NewOffsetWriter(f, offset), rd); err != nil {
+				return err
+			} else if m != n {
+				return fmt.Errorf("short snapshot chunk at offset %d: %d of %d bytes", offset, m, n)
+			}
+			return rd.Close()
+		})
+	}
+	if err := g.Wait(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("cannot download snapshot chunk: %w", err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	r.Logger().Info("downloaded snapshot",
+		"generation", generation, "index", index, "size", size,
+		"chunks", (size+chunkSize-1)/chunkSize, "elapsed", time.Since(startTime).String(),
+	)
+
+	return f, nil
+}
 
-		readers = append(readers, lz4.NewReader(rd))
+// downloadWAL copies a WAL file from the replica to a local copy next to the DB.
+// The WAL is later applied by applyWAL(). This function can be run in parallel
+// to download multiple WAL files simultaneously.
+func (r *Replica) downloadWAL(ctx context.Context, generation string, index int, offsets []int64, dbPath string) (err error) {
+	// Determine the user/group & mode based on the DB, if available.
+	var fileInfo os.FileInfo
+	if db := r.DB(); db != nil {
+		fileInfo = db.fileInfo
 	}
 
 	// Open handle to destination WAL path.
@@ -1424,7 +1942,7 @@ func (r *Replica) downloadWAL(ctx context.Context, generation string, index int,
 	defer f.Close()
 
 	// Combine segments together and copy WAL to target path.
-	if _, err := io.Copy(f, io.MultiReader(readers...)); err != nil {
+	if _, err := r.copyWALSegments(ctx, f, generation, index, offsets); err != nil {
 		return err
 	} else if err := f.Close(); err != nil {
 		return err
@@ -1432,6 +1950,29 @@ func (r *Replica) downloadWAL(ctx context.Context, generation string, index int,
 	return nil
 }
 
+// openWALSegment returns a reader for the decrypted & decompressed contents
+// of a WAL segment.
+func (r *Replica) openWALSegment(ctx context.Context, pos Pos) (io.ReadCloser, error) {
+	rc, err := r.Client.WALSegmentReader(ctx, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	var rd io.Reader = rc
+	if len(r.AgeIdentities) > 0 {
+		if rd, err = age.Decrypt(rc, r.AgeIdentities...); err != nil {
+			_ = rc.Close()
+			return nil, err
+		}
+	}
+	zr, err := newDecompressor(rd)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return internal.NewReadCloser(zr, rc), nil
+}
+
 // Replica metrics.
 var (
 	replicaWALBytesCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
@@ -1455,6 +1996,13 @@ var (
 		Help:      "The current WAL offset",
 	}, []string{"db", "name"})
 
+	replicaShadowWALRetainedBytesGaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "litestream",
+		Subsystem: "replica",
+		Name:      "shadow_wal_retained_bytes",
+		Help:      "The number of shadow WAL bytes retained until replicated",
+	}, []string{"db", "name"})
+
 	replicaValidationTotalCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "litestream",
 		Subsystem: "replica",
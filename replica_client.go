@@ -3,6 +3,7 @@ package litestream
 import (
 	"context"
 	"io"
+	"reflect"
 )
 
 // ReplicaClient represents client to connect to a Replica.
@@ -46,3 +47,83 @@ type ReplicaClient interface {
 	// WAL segment does not exist.
 	WALSegmentReader(ctx context.Context, pos Pos) (io.ReadCloser, error)
 }
+
+// SnapshotRangeReader is an optional interface implemented by clients that
+// can read a byte range of a snapshot. This allows large snapshots to be
+// downloaded in parallel chunks during restore.
+type SnapshotRangeReader interface {
+	ReplicaClient
+
+	// Returns a reader for size bytes of the LZ4 compressed snapshot data
+	// starting at offset. Returns an os.ErrNotFound error if the snapshot
+	// does not exist.
+	SnapshotRangeReader(ctx context.Context, generation string, index int, offset, size int64) (io.ReadCloser, error)
+}
+
+// LeaseClient is an optional interface implemented by clients that can store
+// a writer lease alongside the replica data. The lease prevents two primaries
+// from replicating into the same replica path at the same time.
+type LeaseClient interface {
+	ReplicaClient
+
+	// Returns a reader for the current JSON encoded lease. Returns an
+	// os.ErrNotFound error if no lease exists.
+	LeaseReader(ctx context.Context) (io.ReadCloser, error)
+
+	// Writes the JSON encoded lease, replacing any existing lease.
+	WriteLease(ctx context.Context, rd io.Reader) error
+
+	// Deletes the lease. Returns nil if no lease exists.
+	DeleteLease(ctx context.Context) error
+}
+
+// SupportsLeases returns true if client & every client it wraps support leases.
+func SupportsLeases(client ReplicaClient) bool {
+	_, ok := UnwrapClient[LeaseClient](client)
+	return ok
+}
+
+// GenerationMetaClient is an optional interface implemented by clients that
+// can store a metadata object alongside each generation. The metadata records
+// why the generation was started & which generation it forked from.
+type GenerationMetaClient interface {
+	ReplicaClient
+
+	// Returns a reader for the JSON encoded metadata of a generation.
+	// Returns an os.ErrNotFound error if no metadata exists.
+	GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error)
+
+	// Writes the JSON encoded metadata for a generation, replacing any
+	// existing metadata. Metadata is removed by DeleteGeneration().
+	WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error
+}
+
+// UnwrapClient returns client, or a client it wraps, as a T. Wrappers such
+// as retries implement optional interfaces regardless of their underlying
+// client so, if T is an interface, client & every client it wraps must
+// implement T. Otherwise the first client in the chain that is a T is
+// returned, such as the underlying client of a concrete type.
+func UnwrapClient[T any](client ReplicaClient) (T, bool) {
+	var zero T
+	strict := reflect.TypeFor[T]().Kind() == reflect.Interface
+
+	var v T
+	var found bool
+	for {
+		if c, ok := client.(T); ok {
+			if !found {
+				v, found = c, true
+			}
+		} else if strict {
+			return zero, false
+		}
+
+		wrapper, ok := client.(interface {
+			Unwrap() ReplicaClient
+		})
+		if !ok {
+			return v, found
+		}
+		client = wrapper.Unwrap()
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net/http/httptest"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
@@ -17,13 +19,20 @@ import (
 	"github.com/benbjohnson/litestream/abs"
 	"github.com/benbjohnson/litestream/file"
 	"github.com/benbjohnson/litestream/gcs"
+	lshttp "github.com/benbjohnson/litestream/http"
+	"github.com/benbjohnson/litestream/memory"
+	"github.com/benbjohnson/litestream/ratelimit"
+	"github.com/benbjohnson/litestream/retry"
 	"github.com/benbjohnson/litestream/s3"
 	"github.com/benbjohnson/litestream/sftp"
+	"github.com/benbjohnson/litestream/sqlite"
+	"github.com/benbjohnson/litestream/webdav"
+	xwebdav "golang.org/x/net/webdav"
 )
 
 var (
 	// Enables integration tests.
-	integration = flag.String("integration", "file", "")
+	integration = flag.String("integration", "file,webdav,mem,sqlite,http", "")
 )
 
 // S3 settings
@@ -41,16 +50,18 @@ var (
 
 // Google cloud storage settings
 var (
-	gcsBucket = flag.String("gcs-bucket", os.Getenv("LITESTREAM_GCS_BUCKET"), "")
-	gcsPath   = flag.String("gcs-path", os.Getenv("LITESTREAM_GCS_PATH"), "")
+	gcsBucket       = flag.String("gcs-bucket", os.Getenv("LITESTREAM_GCS_BUCKET"), "")
+	gcsPath         = flag.String("gcs-path", os.Getenv("LITESTREAM_GCS_PATH"), "")
+	gcsEmulatorHost = flag.String("gcs-emulator-host", os.Getenv("LITESTREAM_GCS_EMULATOR_HOST"), "")
 )
 
 // Azure blob storage settings
 var (
-	absAccountName = flag.String("abs-account-name", os.Getenv("LITESTREAM_ABS_ACCOUNT_NAME"), "")
-	absAccountKey  = flag.String("abs-account-key", os.Getenv("LITESTREAM_ABS_ACCOUNT_KEY"), "")
-	absBucket      = flag.String("abs-bucket", os.Getenv("LITESTREAM_ABS_BUCKET"), "")
-	absPath        = flag.String("abs-path", os.Getenv("LITESTREAM_ABS_PATH"), "")
+	absAccountName      = flag.String("abs-account-name", os.Getenv("LITESTREAM_ABS_ACCOUNT_NAME"), "")
+	absAccountKey       = flag.String("abs-account-key", os.Getenv("LITESTREAM_ABS_ACCOUNT_KEY"), "")
+	absConnectionString = flag.String("abs-connection-string", os.Getenv("LITESTREAM_ABS_CONNECTION_STRING"), "")
+	absBucket           = flag.String("abs-bucket", os.Getenv("LITESTREAM_ABS_BUCKET"), "")
+	absPath             = flag.String("abs-path", os.Getenv("LITESTREAM_ABS_PATH"), "")
 )
 
 // SFTP settings
@@ -59,6 +70,7 @@ var (
 	sftpUser     = flag.String("sftp-user", os.Getenv("LITESTREAM_SFTP_USER"), "")
 	sftpPassword = flag.String("sftp-password", os.Getenv("LITESTREAM_SFTP_PASSWORD"), "")
 	sftpKeyPath  = flag.String("sftp-key-path", os.Getenv("LITESTREAM_SFTP_KEY_PATH"), "")
+	sftpHostKey  = flag.String("sftp-host-key", os.Getenv("LITESTREAM_SFTP_HOST_KEY"), "")
 	sftpPath     = flag.String("sftp-path", os.Getenv("LITESTREAM_SFTP_PATH"), "")
 )
 
@@ -247,6 +259,184 @@ func TestReplicaClient_SnapshotReader(t *testing.T) {
 	})
 }
 
+func TestReplicaClient_SnapshotRangeReader(t *testing.T) {
+	RunWithReplicaClient(t, "OK", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		rr, ok := c.(litestream.SnapshotRangeReader)
+		if !ok {
+			t.Skip("ranged reads not supported")
+		}
+
+		if _, err := c.WriteSnapshot(context.Background(), "5efbd8d042012dca", 10, strings.NewReader(`foobarbaz`)); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := rr.SnapshotRangeReader(context.Background(), "5efbd8d042012dca", 10, 3, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		if buf, err := io.ReadAll(r); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), "barb"; got != want {
+			t.Fatalf("ReadAll=%v, want %v", got, want)
+		}
+	})
+
+	RunWithReplicaClient(t, "ErrNotFound", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		rr, ok := c.(litestream.SnapshotRangeReader)
+		if !ok {
+			t.Skip("ranged reads not supported")
+		}
+
+		if _, err := rr.SnapshotRangeReader(context.Background(), "5efbd8d042012dca", 1, 0, 1); !os.IsNotExist(err) {
+			t.Fatalf("expected not exist, got %#v", err)
+		}
+	})
+}
+
+func TestReplicaClient_Lease(t *testing.T) {
+	RunWithReplicaClient(t, "OK", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		lc, ok := c.(litestream.LeaseClient)
+		if !ok {
+			t.Skip("leases not supported")
+		}
+
+		if _, err := lc.LeaseReader(context.Background()); !os.IsNotExist(err) {
+			t.Fatalf("expected not exist, got %#v", err)
+		}
+
+		// Write lease twice to ensure it is replaced.
+		if err := lc.WriteLease(context.Background(), strings.NewReader(`foo`)); err != nil {
+			t.Fatal(err)
+		} else if err := lc.WriteLease(context.Background(), strings.NewReader(`bar`)); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := lc.LeaseReader(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := r.Close(); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), "bar"; got != want {
+			t.Fatalf("lease=%q, want %q", got, want)
+		}
+
+		// Ensure the lease does not appear as a generation.
+		if generations, err := c.Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if len(generations) != 0 {
+			t.Fatalf("unexpected generations: %v", generations)
+		}
+
+		// Delete lease & ensure deleting a missing lease does not fail.
+		if err := lc.DeleteLease(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := lc.DeleteLease(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := lc.LeaseReader(context.Background()); !os.IsNotExist(err) {
+			t.Fatalf("expected not exist, got %#v", err)
+		}
+	})
+}
+
+func TestSupportsLeases(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		c := retry.NewReplicaClient(ratelimit.NewReplicaClient(memory.NewReplicaClient()))
+		if !litestream.SupportsLeases(c) {
+			t.Fatal("expected lease support")
+		}
+	})
+
+	// Wrappers implement leases regardless of the client they wrap.
+	t.Run("Unsupported", func(t *testing.T) {
+		c := retry.NewReplicaClient(ratelimit.NewReplicaClient(webdav.NewReplicaClient()))
+		if litestream.SupportsLeases(c) {
+			t.Fatal("expected no lease support")
+		}
+	})
+}
+
+func TestUnwrapClient(t *testing.T) {
+	// Concrete types match the underlying client.
+	t.Run("Concrete", func(t *testing.T) {
+		inner := memory.NewReplicaClient()
+		if c, ok := litestream.UnwrapClient[*memory.ReplicaClient](retry.NewReplicaClient(inner)); !ok || c != inner {
+			t.Fatalf("UnwrapClient()=%v, %v", c, ok)
+		} else if _, ok := litestream.UnwrapClient[*webdav.ReplicaClient](retry.NewReplicaClient(inner)); ok {
+			t.Fatal("expected no match")
+		}
+	})
+
+	// Interfaces return the outermost client so calls pass through wrappers.
+	t.Run("Interface", func(t *testing.T) {
+		c := retry.NewReplicaClient(memory.NewReplicaClient())
+		if lc, ok := litestream.UnwrapClient[litestream.LeaseClient](c); !ok || lc != litestream.LeaseClient(c) {
+			t.Fatalf("UnwrapClient()=%v, %v", lc, ok)
+		}
+	})
+}
+
+func TestReplicaClient_GenerationMeta(t *testing.T) {
+	RunWithReplicaClient(t, "OK", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		mc, ok := c.(litestream.GenerationMetaClient)
+		if !ok {
+			t.Skip("generation metadata not supported")
+		}
+
+		if _, err := mc.GenerationMetaReader(context.Background(), "5efbd8d042012dca"); !os.IsNotExist(err) {
+			t.Fatalf("expected not exist, got %#v", err)
+		} else if err := mc.WriteGenerationMeta(context.Background(), "5efbd8d042012dca", strings.NewReader(`foo`)); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := mc.GenerationMetaReader(context.Background(), "5efbd8d042012dca")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := r.Close(); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), "foo"; got != want {
+			t.Fatalf("meta=%q, want %q", got, want)
+		}
+
+		// Ensure metadata is removed with its generation.
+		if err := c.DeleteGeneration(context.Background(), "5efbd8d042012dca"); err != nil {
+			t.Fatal(err)
+		} else if _, err := mc.GenerationMetaReader(context.Background(), "5efbd8d042012dca"); !os.IsNotExist(err) {
+			t.Fatalf("expected not exist, got %#v", err)
+		}
+	})
+
+	RunWithReplicaClient(t, "ErrNoGeneration", func(t *testing.T, c litestream.ReplicaClient) {
+		t.Parallel()
+
+		mc, ok := c.(litestream.GenerationMetaClient)
+		if !ok {
+			t.Skip("generation metadata not supported")
+		}
+
+		if _, err := mc.GenerationMetaReader(context.Background(), ""); err == nil || err.Error() != `cannot determine generation metadata path: generation required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
 func TestReplicaClient_WALs(t *testing.T) {
 	RunWithReplicaClient(t, "OK", func(t *testing.T, c litestream.ReplicaClient) {
 		t.Parallel()
@@ -485,6 +675,14 @@ func NewReplicaClient(tb testing.TB, typ string) litestream.ReplicaClient {
 		return NewABSReplicaClient(tb)
 	case sftp.ReplicaClientType:
 		return NewSFTPReplicaClient(tb)
+	case webdav.ReplicaClientType:
+		return NewWebDAVReplicaClient(tb)
+	case memory.ReplicaClientType:
+		return memory.NewReplicaClient()
+	case sqlite.ReplicaClientType:
+		return NewSQLiteReplicaClient(tb)
+	case lshttp.ReplicaClientType:
+		return NewHTTPReplicaClient(tb)
 	default:
 		tb.Fatalf("invalid replica client type: %q", typ)
 		return nil
@@ -519,6 +717,7 @@ func NewGCSReplicaClient(tb testing.TB) *gcs.ReplicaClient {
 
 	c := gcs.NewReplicaClient()
 	c.Bucket = *gcsBucket
+	c.EmulatorHost = *gcsEmulatorHost
 	c.Path = path.Join(*gcsPath, fmt.Sprintf("%016x", rand.Uint64()))
 	return c
 }
@@ -530,6 +729,7 @@ func NewABSReplicaClient(tb testing.TB) *abs.ReplicaClient {
 	c := abs.NewReplicaClient()
 	c.AccountName = *absAccountName
 	c.AccountKey = *absAccountKey
+	c.ConnectionString = *absConnectionString
 	c.Bucket = *absBucket
 	c.Path = path.Join(*absPath, fmt.Sprintf("%016x", rand.Uint64()))
 	return c
@@ -544,10 +744,63 @@ func NewSFTPReplicaClient(tb testing.TB) *sftp.ReplicaClient {
 	c.User = *sftpUser
 	c.Password = *sftpPassword
 	c.KeyPath = *sftpKeyPath
+	c.HostKey = *sftpHostKey
 	c.Path = path.Join(*sftpPath, fmt.Sprintf("%016x", rand.Uint64()))
 	return c
 }
 
+// NewWebDAVReplicaClient returns a new client for integration testing. The
+// client connects to an in-process WebDAV server backed by a temp directory.
+func NewWebDAVReplicaClient(tb testing.TB) *webdav.ReplicaClient {
+	tb.Helper()
+
+	s := httptest.NewServer(&xwebdav.Handler{
+		FileSystem: xwebdav.Dir(tb.TempDir()),
+		LockSystem: xwebdav.NewMemLS(),
+	})
+	tb.Cleanup(s.Close)
+
+	c := webdav.NewReplicaClient()
+	c.Endpoint = s.URL
+	c.Path = fmt.Sprintf("%016x", rand.Uint64())
+	return c
+}
+
+// NewSQLiteReplicaClient returns a new client for integration testing.
+func NewSQLiteReplicaClient(tb testing.TB) *sqlite.ReplicaClient {
+	tb.Helper()
+
+	c := sqlite.NewReplicaClient(filepath.Join(tb.TempDir(), "replica.db"))
+	tb.Cleanup(func() {
+		if err := c.Close(); err != nil {
+			tb.Fatalf("cannot close sqlite replica: %s", err)
+		}
+	})
+	return c
+}
+
+// NewHTTPReplicaClient returns a new client for integration testing. The
+// client connects to an in-process server that stores data in a temp directory
+// and requires a token scoped to the client's database prefix.
+func NewHTTPReplicaClient(tb testing.TB) *lshttp.ReplicaClient {
+	tb.Helper()
+
+	dir := tb.TempDir()
+	h := lshttp.NewHandler(func(prefix string) (litestream.ReplicaClient, error) {
+		return file.NewReplicaClient(filepath.Join(dir, filepath.FromSlash(prefix))), nil
+	})
+	h.Tokens = []*lshttp.Token{{Value: "TOKEN", Paths: []string{"tenant"}}}
+
+	s := httptest.NewServer(h)
+	tb.Cleanup(s.Close)
+
+	c := lshttp.NewReplicaClient()
+	c.Endpoint = s.URL
+	c.Path = path.Join("tenant", fmt.Sprintf("%016x", rand.Uint64()))
+	c.Token = "TOKEN"
+	return c
+}
+
 // MustDeleteAll deletes all objects under the client's path.
 func MustDeleteAll(tb testing.TB, c litestream.ReplicaClient) {
 	tb.Helper()
@@ -568,5 +821,9 @@ func MustDeleteAll(tb testing.TB, c litestream.ReplicaClient) {
 		if err := c.Cleanup(context.Background()); err != nil {
 			tb.Fatalf("cannot cleanup sftp: %s", err)
 		}
+	case *webdav.ReplicaClient:
+		if err := c.Cleanup(context.Background()); err != nil {
+			tb.Fatalf("cannot cleanup webdav: %s", err)
+		}
 	}
 }
@@ -3,12 +3,16 @@ package litestream_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/benbjohnson/litestream"
 	"github.com/benbjohnson/litestream/file"
+	"github.com/benbjohnson/litestream/memory"
 	"github.com/benbjohnson/litestream/mock"
 	"github.com/pierrec/lz4/v4"
 )
@@ -183,3 +187,323 @@ func TestReplica_Snapshot(t *testing.T) {
 		t.Fatalf("info[2]=%s, want %s", got, want)
 	}
 }
+
+// Ensure a staged snapshot allows checkpoints while the snapshot is uploaded.
+func TestReplica_Snapshot_Staged(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	c := memory.NewReplicaClient()
+	r := litestream.NewReplica(db, "")
+	r.Client = c
+	r.SnapshotMode, r.SnapshotStagingPath = litestream.SnapshotModeStaged, t.TempDir()
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write & checkpoint the database during the upload.
+	var mc mock.ReplicaClient
+	mc.WriteSnapshotFunc = func(ctx context.Context, generation string, index int, rd io.Reader) (litestream.SnapshotInfo, error) {
+		pos0, err := db.Pos()
+		if err != nil {
+			return litestream.SnapshotInfo{}, err
+		} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+			return litestream.SnapshotInfo{}, err
+		} else if err := db.Checkpoint(ctx, litestream.CheckpointModeTruncate); err != nil {
+			return litestream.SnapshotInfo{}, err
+		} else if pos1, err := db.Pos(); err != nil {
+			return litestream.SnapshotInfo{}, err
+		} else if pos1.Index == pos0.Index {
+			return litestream.SnapshotInfo{}, errors.New("checkpoint blocked during upload")
+		}
+		return c.WriteSnapshot(ctx, generation, index, rd)
+	}
+	r.Client = &mc
+
+	if _, err := r.Snapshot(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Staging file should be staged in a directory for the database & removed
+	// after upload.
+	if ents, err := os.ReadDir(r.SnapshotStagingPath); err != nil {
+		t.Fatal(err)
+	} else if len(ents) != 1 || !ents[0].IsDir() {
+		t.Fatalf("unexpected staging entries: %v", ents)
+	} else if ents, err := os.ReadDir(filepath.Join(r.SnapshotStagingPath, ents[0].Name())); err != nil {
+		t.Fatal(err)
+	} else if len(ents) != 0 {
+		t.Fatalf("unexpected staging files: %v", ents)
+	}
+}
+
+// Ensure small WAL changes are batched into a single segment that is written
+// once the maximum segment delay elapses.
+func TestReplica_SegmentBatching(t *testing.T) {
+	db, sqldb := MustOpenDBs(t)
+	defer MustCloseDBs(t, db, sqldb)
+
+	c := memory.NewReplicaClient()
+	r := litestream.NewReplica(db, "")
+	r.Client, r.SyncInterval = c, 10*time.Millisecond
+	r.MinSegmentSize, r.MaxSegmentDelay = 1<<20, 500*time.Millisecond
+	db.Replicas = []*litestream.Replica{r}
+
+	if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	initialPos := r.Pos()
+
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop(false)
+
+	startTime := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pos, err := db.Pos()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.WaitPos(ctx, pos); err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(startTime); elapsed < r.MaxSegmentDelay/2 {
+		t.Fatalf("segment written before delay: %s", elapsed)
+	}
+
+	// Only one segment is written after the initial sync.
+	itr, err := c.WALSegments(context.Background(), pos.Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+
+	var n int
+	for itr.Next() {
+		if info := itr.WALSegment(); info.Index > initialPos.Index || (info.Index == initialPos.Index && info.Offset >= initialPos.Offset) {
+			n++
+		}
+	}
+	if err := itr.Close(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("segment count=%d, want 1", n)
+	}
+}
+
+func TestReplica_Restore(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := memory.NewReplicaClient()
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+
+		// Write data, sync & snapshot, then write more data to the WAL.
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := r.Snapshot(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES ('baz');`); err != nil {
+			t.Fatal(err)
+		} else if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Restore from a separate replica sharing the same client.
+		rr := litestream.NewReplica(nil, "")
+		rr.Client = c
+
+		opt := litestream.NewRestoreOptions()
+		opt.OutputPath = filepath.Join(t.TempDir(), "db")
+		generation, _, err := rr.CalcRestoreTarget(context.Background(), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opt.Generation = generation
+		if err := rr.Restore(context.Background(), opt); err != nil {
+			t.Fatal(err)
+		}
+
+		// Verify restored database contains the data written after the snapshot.
+		restored := MustOpenSQLDB(t, opt.OutputPath)
+		defer MustCloseSQLDB(t, restored)
+
+		var bar string
+		if err := restored.QueryRow(`SELECT bar FROM foo`).Scan(&bar); err != nil {
+			t.Fatal(err)
+		} else if got, want := bar, "baz"; got != want {
+			t.Fatalf("bar=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure snapshots are reassembled correctly when downloaded in chunks.
+	t.Run("ParallelSnapshot", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		c := file.NewReplicaClient(t.TempDir())
+		r := litestream.NewReplica(db, "")
+		r.Client = c
+
+		// Write enough random data that the snapshot spans many chunks.
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar BLOB);`); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			if _, err := sqldb.Exec(`INSERT INTO foo (bar) VALUES (randomblob(1000));`); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := db.Checkpoint(context.Background(), litestream.CheckpointModeTruncate); err != nil {
+			t.Fatal(err)
+		} else if _, err := r.Snapshot(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var want string
+		if err := sqldb.QueryRow(`SELECT hex(group_concat(bar)) FROM foo`).Scan(&want); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := litestream.NewReplica(nil, "")
+		rr.Client = c
+
+		opt := litestream.NewRestoreOptions()
+		opt.OutputPath = filepath.Join(t.TempDir(), "db")
+		opt.Parallelism = 4
+		opt.SnapshotChunkSize = 4096
+		generation, _, err := rr.CalcRestoreTarget(context.Background(), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opt.Generation = generation
+		if err := rr.Restore(context.Background(), opt); err != nil {
+			t.Fatal(err)
+		}
+
+		restored := MustOpenSQLDB(t, opt.OutputPath)
+		defer MustCloseSQLDB(t, restored)
+
+		var got string
+		if err := restored.QueryRow(`SELECT hex(group_concat(bar)) FROM foo`).Scan(&got); err != nil {
+			t.Fatal(err)
+		} else if got != want {
+			t.Fatal("restored data mismatch")
+		}
+	})
+}
+
+func TestReplica_WaitPos(t *testing.T) {
+	// Ensure a waiter is released once the replica syncs past the position.
+	t.Run("OK", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		r := litestream.NewReplica(db, "")
+		r.Client = memory.NewReplicaClient()
+		db.Replicas = []*litestream.Replica{r}
+
+		if _, err := sqldb.Exec(`CREATE TABLE foo (bar TEXT);`); err != nil {
+			t.Fatal(err)
+		}
+		pos, err := db.SyncPos(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errCh := make(chan error)
+		go func() { errCh <- db.WaitReplicated(context.Background(), pos) }()
+
+		select {
+		case err := <-errCh:
+			t.Fatalf("unexpected early return: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for replication")
+		}
+	})
+
+	t.Run("ErrContextDeadline", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		r := litestream.NewReplica(db, "")
+		r.Client = memory.NewReplicaClient()
+
+		pos, err := db.SyncPos(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := r.WaitPos(ctx, pos); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrGenerationChanged", func(t *testing.T) {
+		db, sqldb := MustOpenDBs(t)
+		defer MustCloseDBs(t, db, sqldb)
+
+		r := litestream.NewReplica(db, "")
+		r.Client = memory.NewReplicaClient()
+
+		if err := db.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.WaitPos(context.Background(), litestream.Pos{Generation: "0000000000000000"}); err != litestream.ErrGenerationChanged {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrReplicaNotFound", func(t *testing.T) {
+		db := MustOpenDB(t)
+		defer MustCloseDB(t, db)
+
+		if err := db.WaitReplicated(context.Background(), litestream.Pos{Generation: "0000000000000000"}, "foo"); err == nil || err.Error() != `replica not found: "foo"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
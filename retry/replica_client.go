@@ -0,0 +1,631 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/benbjohnson/litestream"
+	lshttp "github.com/benbjohnson/litestream/http"
+	"github.com/benbjohnson/litestream/webdav"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// Default retry & circuit breaker settings.
+const (
+	DefaultMaxAttempts      = 5
+	DefaultMinBackoff       = 100 * time.Millisecond
+	DefaultMaxBackoff       = 10 * time.Second
+	DefaultJitter           = 0.2
+	DefaultBreakerThreshold = 10
+	DefaultBreakerCooldown  = 30 * time.Second
+
+	// DefaultMaxSpoolSize is the default size limit of the spool file used to
+	// replay writes from readers that cannot be rewound. Larger writes, such
+	// as snapshots of large databases, are attempted once & not retried so
+	// the limit should be raised, or disabled, to retry them.
+	DefaultMaxSpoolSize = 64 << 20
+)
+
+// ErrCircuitOpen is returned when the circuit breaker is open and calls to
+// the underlying client are rejected without being attempted.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states.
+const (
+	stateClosed = iota
+	stateOpen
+	stateHalfOpen
+)
+
+var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.SnapshotRangeReader = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
+
+// ReplicaClient wraps another client and retries failed operations with
+// exponential backoff & jitter. After BreakerThreshold consecutive failed
+// attempts the circuit breaker opens and all calls fail immediately with
+// ErrCircuitOpen until BreakerCooldown has elapsed. After the cooldown, a
+// single attempt is let through and its result closes or re-opens the breaker.
+//
+// Errors indicating a missing object, permission or authentication failures,
+// client errors other than timeouts & throttling, and context cancellation
+// are never retried.
+type ReplicaClient struct {
+	mu       sync.Mutex
+	state    int
+	failures int       // consecutive failed attempts
+	openedAt time.Time // time breaker last opened
+	probing  bool      // half-open trial attempt in progress
+
+	// Underlying client that calls are delegated to.
+	Client litestream.ReplicaClient
+
+	// Maximum number of attempts per operation, including the first.
+	MaxAttempts int
+
+	// Backoff between attempts starts at MinBackoff & doubles on each
+	// failure up to MaxBackoff. Jitter is the fraction of each backoff that
+	// is randomized to avoid synchronized retries.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Jitter     float64
+
+	// Number of consecutive failed attempts before the breaker opens & the
+	// time it stays open. A threshold of zero disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Directory used to spool writes from readers that cannot be rewound.
+	// Defaults to the system temporary directory. Writes larger than
+	// MaxSpoolSize are attempted once without retries. A size of zero
+	// disables the limit so writes of any size are spooled to disk.
+	SpoolPath    string
+	MaxSpoolSize int64
+
+	// Now returns the current time. Defaults to time.Now but can be
+	// overridden for testing.
+	Now func() time.Time
+}
+
+// NewReplicaClient returns a new instance of ReplicaClient wrapping client.
+func NewReplicaClient(client litestream.ReplicaClient) *ReplicaClient {
+	return &ReplicaClient{
+		Client:           client,
+		MaxAttempts:      DefaultMaxAttempts,
+		MinBackoff:       DefaultMinBackoff,
+		MaxBackoff:       DefaultMaxBackoff,
+		Jitter:           DefaultJitter,
+		BreakerThreshold: DefaultBreakerThreshold,
+		BreakerCooldown:  DefaultBreakerCooldown,
+		MaxSpoolSize:     DefaultMaxSpoolSize,
+		Now:              time.Now,
+	}
+}
+
+// Unwrap returns the underlying client.
+func (c *ReplicaClient) Unwrap() litestream.ReplicaClient {
+	return c.Client
+}
+
+// Type returns the type of the underlying client.
+func (c *ReplicaClient) Type() string {
+	return c.Client.Type()
+}
+
+// Generations returns a list of available generation names.
+func (c *ReplicaClient) Generations(ctx context.Context) (a []string, err error) {
+	err = c.do(ctx, "generations", func() (err error) {
+		a, err = c.Client.Generations(ctx)
+		return err
+	})
+	return a, err
+}
+
+// DeleteGeneration deletes all snapshots & WAL segments within a generation.
+func (c *ReplicaClient) DeleteGeneration(ctx context.Context, generation string) error {
+	return c.do(ctx, "delete_generation", func() error {
+		return c.Client.DeleteGeneration(ctx, generation)
+	})
+}
+
+// Snapshots returns an iterator over all available snapshots for a generation.
+// Only the initial request is retried, not errors that occur during iteration.
+func (c *ReplicaClient) Snapshots(ctx context.Context, generation string) (itr litestream.SnapshotIterator, err error) {
+	err = c.do(ctx, "snapshots", func() (err error) {
+		itr, err = c.Client.Snapshots(ctx, generation)
+		return err
+	})
+	return itr, err
+}
+
+// WriteSnapshot writes LZ4 compressed data from rd to the underlying client.
+// Data is spooled to a temporary file if rd cannot be rewound between attempts.
+// Snapshots larger than MaxSpoolSize are only attempted once.
+func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (info litestream.SnapshotInfo, err error) {
+	rs, cleanup, err := c.rewindable(rd)
+	if err != nil {
+		return info, err
+	}
+	defer cleanup()
+
+	err = c.doAttempts(ctx, "write_snapshot", rs.attempts(c.MaxAttempts), func() (err error) {
+		r, err := rs.rewind()
+		if err != nil {
+			return err
+		}
+		info, err = c.Client.WriteSnapshot(ctx, generation, index, r)
+		return err
+	})
+	return info, err
+}
+
+// DeleteSnapshot deletes a snapshot with the given generation & index.
+func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
+	return c.do(ctx, "delete_snapshot", func() error {
+		return c.Client.DeleteSnapshot(ctx, generation, index)
+	})
+}
+
+// SnapshotReader returns a reader for snapshot data at the given generation/index.
+// Only opening the reader is retried, not errors that occur while reading.
+func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, index int) (rc io.ReadCloser, err error) {
+	err = c.do(ctx, "snapshot_reader", func() (err error) {
+		rc, err = c.Client.SnapshotReader(ctx, generation, index)
+		return err
+	})
+	return rc, err
+}
+
+// SnapshotRangeReader returns a reader for a range of snapshot data if the
+// underlying client supports ranged reads. Only opening the reader is retried.
+func (c *ReplicaClient) SnapshotRangeReader(ctx context.Context, generation string, index int, offset, size int64) (rc io.ReadCloser, err error) {
+	rr, ok := c.Client.(litestream.SnapshotRangeReader)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support ranged reads", c.Client.Type())
+	}
+
+	err = c.do(ctx, "snapshot_range_reader", func() (err error) {
+		rc, err = rr.SnapshotRangeReader(ctx, generation, index, offset, size)
+		return err
+	})
+	return rc, err
+}
+
+// WALSegments returns an iterator over all available WAL files for a generation.
+// Only the initial request is retried, not errors that occur during iteration.
+func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (itr litestream.WALSegmentIterator, err error) {
+	err = c.do(ctx, "wal_segments", func() (err error) {
+		itr, err = c.Client.WALSegments(ctx, generation)
+		return err
+	})
+	return itr, err
+}
+
+// WriteWALSegment writes LZ4 compressed data from rd to the underlying client.
+// Data is spooled to a temporary file if rd cannot be rewound between attempts.
+func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (info litestream.WALSegmentInfo, err error) {
+	rs, cleanup, err := c.rewindable(rd)
+	if err != nil {
+		return info, err
+	}
+	defer cleanup()
+
+	err = c.doAttempts(ctx, "write_wal_segment", rs.attempts(c.MaxAttempts), func() (err error) {
+		r, err := rs.rewind()
+		if err != nil {
+			return err
+		}
+		info, err = c.Client.WriteWALSegment(ctx, pos, r)
+		return err
+	})
+	return info, err
+}
+
+// DeleteWALSegments deletes WAL segments at the given positions.
+func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Pos) error {
+	return c.do(ctx, "delete_wal_segments", func() error {
+		return c.Client.DeleteWALSegments(ctx, a)
+	})
+}
+
+// WALSegmentReader returns a reader for a section of WAL data at the given position.
+// Only opening the reader is retried, not errors that occur while reading.
+func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos) (rc io.ReadCloser, err error) {
+	err = c.do(ctx, "wal_segment_reader", func() (err error) {
+		rc, err = c.Client.WALSegmentReader(ctx, pos)
+		return err
+	})
+	return rc, err
+}
+
+// GenerationMetaReader returns a reader for the metadata of a generation if
+// the underlying client supports generation metadata.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (rc io.ReadCloser, err error) {
+	mc, ok := c.Client.(litestream.GenerationMetaClient)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support generation metadata", c.Client.Type())
+	}
+
+	err = c.do(ctx, "generation_meta_reader", func() (err error) {
+		rc, err = mc.GenerationMetaReader(ctx, generation)
+		return err
+	})
+	return rc, err
+}
+
+// WriteGenerationMeta writes the metadata of a generation to the underlying client.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	mc, ok := c.Client.(litestream.GenerationMetaClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support generation metadata", c.Client.Type())
+	}
+
+	rs, cleanup, err := c.rewindable(rd)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return c.doAttempts(ctx, "write_generation_meta", rs.attempts(c.MaxAttempts), func() error {
+		r, err := rs.rewind()
+		if err != nil {
+			return err
+		}
+		return mc.WriteGenerationMeta(ctx, generation, r)
+	})
+}
+
+// LeaseReader returns a reader for the replica lease if the underlying client
+// supports leases.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (rc io.ReadCloser, err error) {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return nil, fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+
+	err = c.do(ctx, "lease_reader", func() (err error) {
+		rc, err = lc.LeaseReader(ctx)
+		return err
+	})
+	return rc, err
+}
+
+// WriteLease writes the replica lease to the underlying client.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+
+	rs, cleanup, err := c.rewindable(rd)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return c.doAttempts(ctx, "write_lease", rs.attempts(c.MaxAttempts), func() error {
+		r, err := rs.rewind()
+		if err != nil {
+			return err
+		}
+		return lc.WriteLease(ctx, r)
+	})
+}
+
+// DeleteLease deletes the replica lease from the underlying client.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	lc, ok := c.Client.(litestream.LeaseClient)
+	if !ok {
+		return fmt.Errorf("%s client does not support leases", c.Client.Type())
+	}
+
+	return c.do(ctx, "delete_lease", func() error {
+		return lc.DeleteLease(ctx)
+	})
+}
+
+// do executes fn until it succeeds, returns a non-retryable error, or the
+// maximum number of attempts is reached.
+func (c *ReplicaClient) do(ctx context.Context, op string, fn func() error) error {
+	return c.doAttempts(ctx, op, c.MaxAttempts, fn)
+}
+
+// doAttempts executes fn until it succeeds, returns a non-retryable error, or
+// maxAttempts is reached.
+func (c *ReplicaClient) doAttempts(ctx context.Context, op string, maxAttempts int, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		probe, err := c.allow()
+		if err != nil {
+			return err
+		}
+
+		err = fn()
+		if err == nil || !isRetryable(err) {
+			c.recordSuccess(probe)
+			return err
+		}
+		c.recordFailure(probe)
+
+		if attempt >= maxAttempts {
+			return err
+		}
+		retryTotalCounterVec.WithLabelValues(c.Client.Type(), op).Inc()
+
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay after the given failed attempt.
+func (c *ReplicaClient) backoff(attempt int) time.Duration {
+	d := c.MinBackoff
+	for i := 1; i < attempt && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if c.MaxBackoff > 0 && d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+
+	if c.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * c.Jitter * float64(d))
+	}
+	return d
+}
+
+// allow returns ErrCircuitOpen if the breaker is open & still cooling down.
+// Once the cooldown has elapsed, the breaker moves to half-open & a single
+// trial attempt is let through. Returns true if the caller is the trial.
+func (c *ReplicaClient) allow() (probe bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case stateClosed:
+		return false, nil
+	case stateHalfOpen:
+		if c.probing {
+			return false, fmt.Errorf("%s: %w", c.Client.Type(), ErrCircuitOpen)
+		}
+	default:
+		if c.Now().Sub(c.openedAt) < c.BreakerCooldown {
+			return false, fmt.Errorf("%s: %w", c.Client.Type(), ErrCircuitOpen)
+		}
+		c.state = stateHalfOpen
+	}
+
+	c.probing = true
+	return true, nil
+}
+
+// recordSuccess resets the failure count and closes the breaker.
+func (c *ReplicaClient) recordSuccess(probe bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if probe {
+		c.probing = false
+	}
+	c.failures = 0
+	c.state = stateClosed
+}
+
+// recordFailure increments the failure count and opens the breaker if the
+// threshold is reached or a half-open trial attempt failed.
+func (c *ReplicaClient) recordFailure(probe bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if probe {
+		c.probing = false
+	}
+
+	c.failures++
+	if c.BreakerThreshold <= 0 {
+		return
+	}
+
+	if c.state == stateHalfOpen || (c.state == stateClosed && c.failures >= c.BreakerThreshold) {
+		c.openedAt = c.Now()
+		c.state = stateOpen
+		breakerOpenTotalCounterVec.WithLabelValues(c.Client.Type()).Inc()
+	}
+}
+
+// isRetryable returns true if err may be resolved by retrying the operation.
+// Missing objects, permission & credential failures, and client errors other
+// than timeouts & throttling are permanent so they are returned immediately.
+func isRetryable(err error) bool {
+	switch {
+	case os.IsNotExist(err), errors.Is(err, os.ErrNotExist):
+		return false
+	case errors.Is(err, os.ErrPermission):
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, ErrCircuitOpen):
+		return false
+	}
+
+	if code := statusCode(err); code >= 400 && code < 500 {
+		return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+	}
+
+	// AWS reports missing credentials without a response.
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == "NoCredentialProviders" {
+		return false
+	}
+	return true
+}
+
+// statusCode returns the HTTP status code of a failed storage or credential
+// request. Returns zero if err was not caused by an HTTP response.
+func statusCode(err error) int {
+	var requestFailure awserr.RequestFailure
+	var storageErr azblob.StorageError
+	var responseErr *azcore.ResponseError
+	var authErr *azidentity.AuthenticationFailedError
+	var googleErr *googleapi.Error
+	var retrieveErr *oauth2.RetrieveError
+	var httpErr *lshttp.StatusError
+	var webdavErr *webdav.StatusError
+
+	switch {
+	case errors.As(err, &requestFailure):
+		return requestFailure.StatusCode()
+	case errors.As(err, &storageErr):
+		return responseStatusCode(storageErr.Response())
+	case errors.As(err, &responseErr):
+		return responseErr.StatusCode
+	case errors.As(err, &authErr):
+		return responseStatusCode(authErr.RawResponse)
+	case errors.As(err, &googleErr):
+		return googleErr.Code
+	case errors.As(err, &retrieveErr):
+		return responseStatusCode(retrieveErr.Response)
+	case errors.As(err, &httpErr):
+		return httpErr.StatusCode
+	case errors.As(err, &webdavErr):
+		return webdavErr.StatusCode
+	default:
+		return 0
+	}
+}
+
+func responseStatusCode(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// rewindReader is a reader that can be reset to its starting position.
+// Readers larger than the spool size can only be read once.
+type rewindReader struct {
+	rs    io.ReadSeeker
+	start int64
+	rest  io.Reader // data beyond the spool size, if any
+	read  bool
+}
+
+// rewind returns a reader positioned at the start of the data.
+func (r *rewindReader) rewind() (io.Reader, error) {
+	if r.rest != nil && r.read {
+		return nil, fmt.Errorf("cannot rewind reader larger than spool size")
+	} else if _, err := r.rs.Seek(r.start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if r.rest == nil {
+		return r.rs, nil
+	}
+	r.read = true
+	return io.MultiReader(r.rs, r.rest), nil
+}
+
+// attempts returns maxAttempts if the reader can be rewound between attempts.
+// Otherwise only a single attempt is allowed.
+func (r *rewindReader) attempts(maxAttempts int) int {
+	if r.rest != nil {
+		return 1
+	}
+	return maxAttempts
+}
+
+// rewindable returns a rewindable reader for rd. If rd is not seekable then
+// it is spooled to a temporary file in SpoolPath, up to MaxSpoolSize, which
+// is removed by the cleanup function. Data beyond MaxSpoolSize is streamed
+// from rd so the reader can only be read once.
+func (c *ReplicaClient) rewindable(rd io.Reader) (_ *rewindReader, cleanup func(), err error) {
+	cleanup = func() {}
+
+	if rd == nil {
+		return &rewindReader{rs: bytes.NewReader(nil)}, cleanup, nil
+	}
+
+	// Use the reader directly if it can be seeked, e.g. a regular file.
+	if rs, ok := rd.(io.ReadSeeker); ok {
+		if start, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			return &rewindReader{rs: rs, start: start}, cleanup, nil
+		}
+	}
+
+	if c.SpoolPath != "" {
+		if err := os.MkdirAll(c.SpoolPath, 0o700); err != nil {
+			return nil, cleanup, err
+		}
+	}
+	f, err := os.CreateTemp(c.SpoolPath, "retry-*.tmp")
+	if err != nil {
+		return nil, cleanup, err
+	}
+	cleanup = func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+
+	if c.MaxSpoolSize <= 0 {
+		if _, err := io.Copy(f, rd); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+		return &rewindReader{rs: f}, cleanup, nil
+	}
+
+	if _, err := io.CopyN(f, rd, c.MaxSpoolSize); err == io.EOF {
+		return &rewindReader{rs: f}, cleanup, nil
+	} else if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	}
+
+	// Stream the remainder without retries if the spool size is exceeded.
+	buf := make([]byte, 1)
+	if n, err := io.ReadFull(rd, buf); err == io.EOF {
+		return &rewindReader{rs: f}, cleanup, nil
+	} else if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	} else {
+		rd = io.MultiReader(bytes.NewReader(buf[:n]), rd)
+	}
+	return &rewindReader{rs: f, rest: rd}, cleanup, nil
+}
+
+// Retry metrics.
+var (
+	retryTotalCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "litestream",
+		Subsystem: "replica",
+		Name:      "retry_total",
+		Help:      "The number of retried replica operations",
+	}, []string{"replica_type", "operation"})
+
+	breakerOpenTotalCounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "litestream",
+		Subsystem: "replica",
+		Name:      "circuit_breaker_open_total",
+		Help:      "The number of times the circuit breaker has opened",
+	}, []string{"replica_type"})
+)
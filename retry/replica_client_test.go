@@ -0,0 +1,300 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/benbjohnson/litestream"
+	lshttp "github.com/benbjohnson/litestream/http"
+	"github.com/benbjohnson/litestream/mock"
+	"github.com/benbjohnson/litestream/retry"
+	"github.com/benbjohnson/litestream/webdav"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestReplicaClient_Retry(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		var n int
+		c := newReplicaClient(&mock.ReplicaClient{
+			GenerationsFunc: func(ctx context.Context) ([]string, error) {
+				if n++; n < 3 {
+					return nil, errors.New("transient")
+				}
+				return []string{"0123456789abcdef"}, nil
+			},
+		})
+
+		if a, err := c.Generations(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(a), 1; got != want {
+			t.Fatalf("len=%d, want %d", got, want)
+		} else if got, want := n, 3; got != want {
+			t.Fatalf("attempts=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		var n int
+		c := newReplicaClient(&mock.ReplicaClient{
+			DeleteGenerationFunc: func(ctx context.Context, generation string) error {
+				n++
+				return errors.New("marker")
+			},
+		})
+
+		if err := c.DeleteGeneration(context.Background(), "0123456789abcdef"); err == nil || err.Error() != `marker` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := n, c.MaxAttempts; got != want {
+			t.Fatalf("attempts=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		var n int
+		c := newReplicaClient(&mock.ReplicaClient{
+			SnapshotReaderFunc: func(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+				n++
+				return nil, os.ErrNotExist
+			},
+		})
+
+		if _, err := c.SnapshotReader(context.Background(), "0123456789abcdef", 0); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := n, 1; got != want {
+			t.Fatalf("attempts=%d, want %d", got, want)
+		}
+	})
+
+	// Ensure permanent failures from each storage service are not retried.
+	t.Run("ErrPermanent", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			err  error
+		}{
+			{"Permission", os.ErrPermission},
+			{"S3", awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")},
+			{"S3Credentials", awserr.New("NoCredentialProviders", "no valid providers in chain", nil)},
+			{"GCS", &googleapi.Error{Code: http.StatusUnauthorized}},
+			{"GCSToken", &url.Error{Op: "Get", URL: "https://oauth2.googleapis.com/token", Err: &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusBadRequest}}}},
+			{"ABS", &azcore.ResponseError{StatusCode: http.StatusForbidden}},
+			{"HTTP", &lshttp.StatusError{Method: http.MethodGet, URL: "/", StatusCode: http.StatusUnauthorized}},
+			{"WebDAV", fmt.Errorf("wrapped: %w", &webdav.StatusError{Method: http.MethodPut, URL: "/", StatusCode: http.StatusConflict})},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				var n int
+				c := newReplicaClient(&mock.ReplicaClient{
+					GenerationsFunc: func(ctx context.Context) ([]string, error) {
+						n++
+						return nil, tt.err
+					},
+				})
+
+				if _, err := c.Generations(context.Background()); !errors.Is(err, tt.err) {
+					t.Fatalf("unexpected error: %v", err)
+				} else if got, want := n, 1; got != want {
+					t.Fatalf("attempts=%d, want %d", got, want)
+				}
+			})
+		}
+	})
+
+	// Ensure timeouts & throttling are retried even though they are client errors.
+	t.Run("Throttled", func(t *testing.T) {
+		for _, code := range []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+			var n int
+			c := newReplicaClient(&mock.ReplicaClient{
+				GenerationsFunc: func(ctx context.Context) ([]string, error) {
+					n++
+					return nil, &lshttp.StatusError{Method: http.MethodGet, URL: "/", StatusCode: code}
+				},
+			})
+
+			if _, err := c.Generations(context.Background()); err == nil {
+				t.Fatal("expected error")
+			} else if got, want := n, c.MaxAttempts; got != want {
+				t.Fatalf("%d: attempts=%d, want %d", code, got, want)
+			}
+		}
+	})
+
+	// Ensure non-seekable readers are replayed in full on each attempt.
+	t.Run("RewindReader", func(t *testing.T) {
+		var bodies []string
+		c := newReplicaClient(&mock.ReplicaClient{
+			WriteWALSegmentFunc: func(ctx context.Context, pos litestream.Pos, r io.Reader) (litestream.WALSegmentInfo, error) {
+				b, err := io.ReadAll(r)
+				if err != nil {
+					return litestream.WALSegmentInfo{}, err
+				}
+				if bodies = append(bodies, string(b)); len(bodies) < 2 {
+					return litestream.WALSegmentInfo{}, errors.New("transient")
+				}
+				return litestream.WALSegmentInfo{Size: int64(len(b))}, nil
+			},
+		})
+
+		pr, pw := io.Pipe()
+		go func() { _, _ = io.Copy(pw, strings.NewReader("foobar")); pw.Close() }()
+
+		if info, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "0123456789abcdef"}, pr); err != nil {
+			t.Fatal(err)
+		} else if got, want := info.Size, int64(6); got != want {
+			t.Fatalf("Size=%d, want %d", got, want)
+		} else if got, want := strings.Join(bodies, ","), "foobar,foobar"; got != want {
+			t.Fatalf("bodies=%s, want %s", got, want)
+		}
+	})
+
+	// Ensure readers larger than the spool size are written once in full.
+	t.Run("MaxSpoolSize", func(t *testing.T) {
+		var bodies []string
+		c := newReplicaClient(&mock.ReplicaClient{
+			WriteWALSegmentFunc: func(ctx context.Context, pos litestream.Pos, r io.Reader) (litestream.WALSegmentInfo, error) {
+				b, err := io.ReadAll(r)
+				if err != nil {
+					return litestream.WALSegmentInfo{}, err
+				}
+				bodies = append(bodies, string(b))
+				return litestream.WALSegmentInfo{}, errors.New("transient")
+			},
+		})
+		c.SpoolPath, c.MaxSpoolSize = t.TempDir(), 3
+
+		pr, pw := io.Pipe()
+		go func() { _, _ = io.Copy(pw, strings.NewReader("foobar")); pw.Close() }()
+
+		if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "0123456789abcdef"}, pr); err == nil || err.Error() != `transient` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := strings.Join(bodies, ","), "foobar"; got != want {
+			t.Fatalf("bodies=%s, want %s", got, want)
+		}
+
+		// Spool file is removed after the write.
+		if ents, err := os.ReadDir(c.SpoolPath); err != nil {
+			t.Fatal(err)
+		} else if len(ents) != 0 {
+			t.Fatalf("unexpected spool files: %v", ents)
+		}
+	})
+}
+
+func TestReplicaClient_CircuitBreaker(t *testing.T) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var n int
+	var fail = true
+	c := newReplicaClient(&mock.ReplicaClient{
+		GenerationsFunc: func(ctx context.Context) ([]string, error) {
+			if n++; fail {
+				return nil, errors.New("down")
+			}
+			return nil, nil
+		},
+	})
+	c.MaxAttempts = 2
+	c.BreakerThreshold = 3
+	c.BreakerCooldown = time.Minute
+	c.Now = func() time.Time { return now }
+
+	// Fail enough times to trip the breaker.
+	if _, err := c.Generations(context.Background()); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := c.Generations(context.Background()); !errors.Is(err, retry.ErrCircuitOpen) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if got, want := n, 3; got != want {
+		t.Fatalf("attempts=%d, want %d", got, want)
+	}
+
+	// Ensure calls are rejected while the breaker is open.
+	if _, err := c.Generations(context.Background()); !errors.Is(err, retry.ErrCircuitOpen) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if got, want := n, 3; got != want {
+		t.Fatalf("attempts=%d, want %d", got, want)
+	}
+
+	// A failed trial after the cooldown re-opens the breaker immediately.
+	now = now.Add(time.Minute)
+	if _, err := c.Generations(context.Background()); !errors.Is(err, retry.ErrCircuitOpen) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if got, want := n, 4; got != want {
+		t.Fatalf("attempts=%d, want %d", got, want)
+	}
+
+	// A successful trial closes the breaker.
+	now, fail = now.Add(time.Minute), false
+	if _, err := c.Generations(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Generations(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := n, 6; got != want {
+		t.Fatalf("attempts=%d, want %d", got, want)
+	}
+}
+
+// Ensure only a single trial call is let through while half-open.
+func TestReplicaClient_CircuitBreaker_HalfOpen(t *testing.T) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	var fail = true
+	c := newReplicaClient(&mock.ReplicaClient{
+		GenerationsFunc: func(ctx context.Context) ([]string, error) {
+			if fail {
+				return nil, errors.New("down")
+			}
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			return nil, nil
+		},
+	})
+	c.MaxAttempts = 1
+	c.BreakerThreshold = 1
+	c.BreakerCooldown = time.Minute
+	c.Now = func() time.Time { return now }
+
+	if _, err := c.Generations(context.Background()); err == nil || err.Error() != `down` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Start the trial call & block until it is released.
+	now, fail = now.Add(time.Minute), false
+	errc := make(chan error)
+	go func() {
+		_, err := c.Generations(context.Background())
+		errc <- err
+	}()
+	<-started
+
+	if _, err := c.Generations(context.Background()); !errors.Is(err, retry.ErrCircuitOpen) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Generations(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// newReplicaClient returns a retry client with short backoffs for testing.
+func newReplicaClient(client litestream.ReplicaClient) *retry.ReplicaClient {
+	c := retry.NewReplicaClient(client)
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = time.Millisecond
+	return c
+}
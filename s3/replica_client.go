@@ -3,10 +3,12 @@ package s3
 import (
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
@@ -34,6 +36,9 @@ const MaxKeys = 1000
 const DefaultRegion = "us-east-1"
 
 var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.SnapshotRangeReader = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
 
 // ReplicaClient is a client for writing snapshots & WAL segments to disk.
 type ReplicaClient struct {
@@ -52,6 +57,22 @@ type ReplicaClient struct {
 	Endpoint       string
 	ForcePathStyle bool
 	SkipVerify     bool
+
+	// Server-side encryption. SSE is "AES256" for S3-managed keys or
+	// "aws:kms" for KMS keys, optionally with a specific KMS key ID.
+	// SSECustomerKey is a base64-encoded 256-bit key used for SSE-C and must
+	// be provided on both writes & reads. SSE-C cannot be used with SSE.
+	SSE            string
+	SSEKMSKeyID    string
+	SSECustomerKey string
+
+	// Storage classes for uploaded objects (e.g. "STANDARD_IA").
+	// Uses the bucket's default if blank.
+	SnapshotStorageClass string
+	WALStorageClass      string
+
+	// User-defined tags applied to uploaded objects.
+	Tags map[string]string
 }
 
 // NewReplicaClient returns a new instance of ReplicaClient.
@@ -73,6 +94,10 @@ func (c *ReplicaClient) Init(ctx context.Context) (err error) {
 		return nil
 	}
 
+	if err := c.validateEncryption(); err != nil {
+		return err
+	}
+
 	// Look up region if not specified and no endpoint is used.
 	// Endpoints are typically used for non-S3 object stores and do not
 	// necessarily require a region.
@@ -125,6 +150,94 @@ func (c *ReplicaClient) config() *aws.Config {
 	return config
 }
 
+// validateEncryption returns an error if the encryption settings are invalid.
+func (c *ReplicaClient) validateEncryption() error {
+	switch c.SSE {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms:
+	default:
+		return fmt.Errorf("invalid s3 server-side encryption: %q", c.SSE)
+	}
+
+	if c.SSEKMSKeyID != "" && c.SSE != s3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("s3 kms key id requires %q server-side encryption", s3.ServerSideEncryptionAwsKms)
+	}
+
+	if c.SSECustomerKey != "" {
+		if c.SSE != "" {
+			return fmt.Errorf("cannot use s3 customer key with server-side encryption %q", c.SSE)
+		} else if key, err := base64.StdEncoding.DecodeString(c.SSECustomerKey); err != nil {
+			return fmt.Errorf("cannot decode s3 customer key: %w", err)
+		} else if len(key) != 32 {
+			return fmt.Errorf("s3 customer key must be 256 bits, got %d bits", len(key)*8)
+		}
+	}
+	return nil
+}
+
+// uploadInput returns the input for uploading body to key, including the
+// configured encryption, storage class & tags.
+func (c *ReplicaClient) uploadInput(key, storageClass string, body io.Reader) *s3manager.UploadInput {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+
+	if c.SSE != "" {
+		input.ServerSideEncryption = aws.String(c.SSE)
+	}
+	if c.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(c.SSEKMSKeyID)
+	}
+	if algorithm, key := c.sseCustomerKey(); key != nil {
+		input.SSECustomerAlgorithm, input.SSECustomerKey = algorithm, key
+	}
+	if storageClass != "" {
+		input.StorageClass = aws.String(storageClass)
+	}
+	if len(c.Tags) > 0 {
+		input.Tagging = aws.String(encodeTags(c.Tags))
+	}
+
+	return input
+}
+
+// getObjectInput returns the input for reading key. The customer key is
+// included if the object was encrypted using SSE-C.
+func (c *ReplicaClient) getObjectInput(key string) *s3.GetObjectInput {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(key),
+	}
+	if algorithm, key := c.sseCustomerKey(); key != nil {
+		input.SSECustomerAlgorithm, input.SSECustomerKey = algorithm, key
+	}
+	return input
+}
+
+// sseCustomerKey returns the SSE-C algorithm & raw key, if set. The SDK
+// encodes the key & computes its MD5 digest when the request is sent.
+func (c *ReplicaClient) sseCustomerKey() (algorithm, key *string) {
+	if c.SSECustomerKey == "" {
+		return nil, nil
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(c.SSECustomerKey)
+	if err != nil {
+		return nil, nil // validated during Init()
+	}
+	return aws.String(s3.ServerSideEncryptionAes256), aws.String(string(buf))
+}
+
+// encodeTags returns tags encoded as URL query parameters, sorted by key.
+func encodeTags(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
 func (c *ReplicaClient) findBucketRegion(ctx context.Context, bucket string) (string, error) {
 	// Connect to US standard region to fetch info.
 	config := c.config()
@@ -250,11 +363,7 @@ func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, in
 	startTime := time.Now()
 
 	rc := internal.NewReadCounter(rd)
-	if _, err := c.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
-		Bucket: aws.String(c.Bucket),
-		Key:    aws.String(key),
-		Body:   rc,
-	}); err != nil {
+	if _, err := c.uploader.UploadWithContext(ctx, c.uploadInput(key, c.SnapshotStorageClass, rc)); err != nil {
 		return info, err
 	}
 
@@ -282,10 +391,34 @@ func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, i
 		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
 	}
 
-	out, err := c.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(c.Bucket),
-		Key:    aws.String(key),
-	})
+	out, err := c.s3.GetObjectWithContext(ctx, c.getObjectInput(key))
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(aws.Int64Value(out.ContentLength)))
+
+	return out.Body, nil
+}
+
+// SnapshotRangeReader returns a reader for size bytes of snapshot data
+// starting at offset.
+func (c *ReplicaClient) SnapshotRangeReader(ctx context.Context, generation string, index int, offset, size int64) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	input := c.getObjectInput(key)
+	input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+size-1))
+
+	out, err := c.s3.GetObjectWithContext(ctx, input)
 	if isNotExists(err) {
 		return nil, os.ErrNotExist
 	} else if err != nil {
@@ -344,11 +477,7 @@ func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos,
 	startTime := time.Now()
 
 	rc := internal.NewReadCounter(rd)
-	if _, err := c.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
-		Bucket: aws.String(c.Bucket),
-		Key:    aws.String(key),
-		Body:   rc,
-	}); err != nil {
+	if _, err := c.uploader.UploadWithContext(ctx, c.uploadInput(key, c.WALStorageClass, rc)); err != nil {
 		return info, err
 	}
 
@@ -376,10 +505,7 @@ func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos
 		return nil, fmt.Errorf("cannot determine wal segment path: %w", err)
 	}
 
-	out, err := c.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(c.Bucket),
-		Key:    aws.String(key),
-	})
+	out, err := c.s3.GetObjectWithContext(ctx, c.getObjectInput(key))
 	if isNotExists(err) {
 		return nil, os.ErrNotExist
 	} else if err != nil {
@@ -432,6 +558,105 @@ func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Po
 	return nil
 }
 
+// GenerationMetaReader returns a reader for the metadata of a generation.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	out, err := c.s3.GetObjectWithContext(ctx, c.getObjectInput(key))
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(aws.Int64Value(out.ContentLength)))
+
+	return out.Body, nil
+}
+
+// WriteGenerationMeta writes the metadata of a generation.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	key, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	rc := internal.NewReadCounter(rd)
+	if _, err := c.uploader.UploadWithContext(ctx, c.uploadInput(key, "", rc)); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(rc.N()))
+	return nil
+}
+
+// LeaseReader returns a reader for the replica lease.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	out, err := c.s3.GetObjectWithContext(ctx, c.getObjectInput(litestream.LeasePath(c.Path)))
+	if isNotExists(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(aws.Int64Value(out.ContentLength)))
+
+	return out.Body, nil
+}
+
+// WriteLease writes the replica lease, replacing any existing lease.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	rc := internal.NewReadCounter(rd)
+	if _, err := c.uploader.UploadWithContext(ctx, c.uploadInput(litestream.LeasePath(c.Path), "", rc)); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(rc.N()))
+	return nil
+}
+
+// DeleteLease deletes the replica lease, if it exists.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	key := litestream.LeasePath(c.Path)
+	out, err := c.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(c.Bucket),
+		Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{{Key: &key}}, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		return err
+	} else if err := deleteOutputError(out); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
 // DeleteAll deletes everything on the remote path. Mainly used for testing.
 func (c *ReplicaClient) DeleteAll(ctx context.Context) error {
 	if err := c.Init(ctx); err != nil {
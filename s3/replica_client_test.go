@@ -0,0 +1,230 @@
+package s3_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/s3"
+)
+
+// customerKey is a base64-encoded 256-bit SSE-C key.
+var customerKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestReplicaClient_Type(t *testing.T) {
+	if got, want := s3.NewReplicaClient().Type(), "s3"; got != want {
+		t.Fatalf("Type()=%v, want %v", got, want)
+	}
+}
+
+func TestReplicaClient_Init(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		fn   func(c *s3.ReplicaClient)
+		err  string
+	}{
+		{"ErrInvalidSSE", func(c *s3.ReplicaClient) { c.SSE = "foo" }, `invalid s3 server-side encryption: "foo"`},
+		{"ErrKMSKeyWithoutKMS", func(c *s3.ReplicaClient) { c.SSE, c.SSEKMSKeyID = "AES256", "KEY" }, `s3 kms key id requires "aws:kms" server-side encryption`},
+		{"ErrCustomerKeyWithSSE", func(c *s3.ReplicaClient) { c.SSE, c.SSECustomerKey = "AES256", customerKey }, `cannot use s3 customer key with server-side encryption "AES256"`},
+		{"ErrCustomerKeyEncoding", func(c *s3.ReplicaClient) { c.SSECustomerKey = "!!!" }, `cannot decode s3 customer key: illegal base64 data at input byte 0`},
+		{"ErrCustomerKeySize", func(c *s3.ReplicaClient) { c.SSECustomerKey = base64.StdEncoding.EncodeToString([]byte("foo")) }, `s3 customer key must be 256 bits, got 24 bits`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := s3.NewReplicaClient()
+			c.Bucket, c.Region = "bkt", "us-east-1"
+			tt.fn(c)
+			if err := c.Init(context.Background()); err == nil || err.Error() != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// Ensure encryption, storage class & tagging options are sent as headers.
+func TestReplicaClient_Upload(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		mustWriteSnapshot(t, c)
+
+		h := s.Header(http.MethodPut)
+		for _, key := range []string{
+			"X-Amz-Server-Side-Encryption",
+			"X-Amz-Server-Side-Encryption-Customer-Algorithm",
+			"X-Amz-Storage-Class",
+			"X-Amz-Tagging",
+		} {
+			if v := h.Get(key); v != "" {
+				t.Fatalf("unexpected %s header: %q", key, v)
+			}
+		}
+	})
+
+	t.Run("SSE", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.SSE = "AES256"
+		mustWriteSnapshot(t, c)
+
+		if got, want := s.Header(http.MethodPut).Get("X-Amz-Server-Side-Encryption"), "AES256"; got != want {
+			t.Fatalf("sse=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("SSEKMS", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.SSE, c.SSEKMSKeyID = "aws:kms", "KEY"
+		mustWriteSnapshot(t, c)
+
+		h := s.Header(http.MethodPut)
+		if got, want := h.Get("X-Amz-Server-Side-Encryption"), "aws:kms"; got != want {
+			t.Fatalf("sse=%q, want %q", got, want)
+		} else if got, want := h.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"), "KEY"; got != want {
+			t.Fatalf("kms key id=%q, want %q", got, want)
+		}
+	})
+
+	// The customer key must be sent on reads as well as writes.
+	t.Run("SSECustomerKey", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.SSECustomerKey = customerKey
+		mustWriteSnapshot(t, c)
+
+		rc, err := c.SnapshotReader(context.Background(), "b16ddcf5c697540f", 1000)
+		if err != nil {
+			t.Fatal(err)
+		} else if buf, err := io.ReadAll(rc); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), "foo"; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		} else if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		raw, _ := base64.StdEncoding.DecodeString(customerKey)
+		sum := md5.Sum(raw)
+		for _, method := range []string{http.MethodPut, http.MethodGet} {
+			h := s.Header(method)
+			if got, want := h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"), "AES256"; got != want {
+				t.Fatalf("%s: algorithm=%q, want %q", method, got, want)
+			} else if got, want := h.Get("X-Amz-Server-Side-Encryption-Customer-Key"), customerKey; got != want {
+				t.Fatalf("%s: key=%q, want %q", method, got, want)
+			} else if got, want := h.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"), base64.StdEncoding.EncodeToString(sum[:]); got != want {
+				t.Fatalf("%s: key md5=%q, want %q", method, got, want)
+			}
+		}
+	})
+
+	t.Run("StorageClass", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.SnapshotStorageClass, c.WALStorageClass = "STANDARD_IA", "ONEZONE_IA"
+
+		mustWriteSnapshot(t, c)
+		if got, want := s.Header(http.MethodPut).Get("X-Amz-Storage-Class"), "STANDARD_IA"; got != want {
+			t.Fatalf("snapshot storage class=%q, want %q", got, want)
+		}
+
+		pos := litestream.Pos{Generation: "b16ddcf5c697540f", Index: 1000}
+		if _, err := c.WriteWALSegment(context.Background(), pos, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		} else if got, want := s.Header(http.MethodPut).Get("X-Amz-Storage-Class"), "ONEZONE_IA"; got != want {
+			t.Fatalf("wal storage class=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Tags = map[string]string{"team": "data eng", "env": "prod"}
+		mustWriteSnapshot(t, c)
+
+		if got, want := s.Header(http.MethodPut).Get("X-Amz-Tagging"), "env=prod&team=data+eng"; got != want {
+			t.Fatalf("tagging=%q, want %q", got, want)
+		}
+	})
+}
+
+// Server is a fake S3 server that stores objects in memory & records the
+// headers of the last request for each method.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+}
+
+// NewServer returns a running server that is closed when tb completes. TLS
+// is used as the SDK refuses to send customer keys over plain HTTP.
+func NewServer(tb testing.TB) *Server {
+	s := &Server{
+		objects: make(map[string][]byte),
+		headers: make(map[string]http.Header),
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// NewReplicaClient returns a client for a bucket on the server.
+func (s *Server) NewReplicaClient() *s3.ReplicaClient {
+	c := s3.NewReplicaClient()
+	c.AccessKeyID, c.SecretAccessKey = "KEY", "SECRET"
+	c.Region, c.Bucket, c.Path = "us-east-1", "bkt", "db"
+	c.Endpoint, c.ForcePathStyle, c.SkipVerify = s.URL, true, true
+	return c
+}
+
+// Header returns the headers of the last request with method.
+func (s *Server) Header(method string) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[method]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.headers[r.Method] = r.Header.Clone()
+
+	switch r.Method {
+	case http.MethodPut:
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.objects[r.URL.Path] = buf
+		w.Header().Set("ETag", `"etag"`)
+
+	case http.MethodGet:
+		buf, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code></Error>`))
+			return
+		}
+		_, _ = w.Write(buf)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func mustWriteSnapshot(tb testing.TB, c *s3.ReplicaClient) {
+	tb.Helper()
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, strings.NewReader("foo")); err != nil {
+		tb.Fatal(err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +17,8 @@ import (
 	"github.com/benbjohnson/litestream/internal"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // ReplicaClientType is the client type for this package.
@@ -26,6 +30,8 @@ const (
 )
 
 var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
 
 // ReplicaClient is a client for writing snapshots & WAL segments to disk.
 type ReplicaClient struct {
@@ -40,6 +46,20 @@ type ReplicaClient struct {
 	Path        string
 	KeyPath     string
 	DialTimeout time.Duration
+
+	// Passphrase used to decrypt the private key at KeyPath, if encrypted.
+	KeyPassphrase string
+
+	// Path to an ssh-agent socket. If set, keys held by the agent are
+	// used for authentication.
+	AgentSocket string
+
+	// Host key verification. KnownHostsPath is an OpenSSH known_hosts file
+	// and HostKey is a fingerprint (e.g. "SHA256:...") or an authorized_keys
+	// formatted public key. If both are set, the host key must satisfy both.
+	// If neither is set, the host key is not verified.
+	KnownHostsPath string
+	HostKey        string
 }
 
 // NewReplicaClient returns a new instance of ReplicaClient.
@@ -67,10 +87,15 @@ func (c *ReplicaClient) Init(ctx context.Context) (_ *sftp.Client, err error) {
 		return nil, fmt.Errorf("sftp user required")
 	}
 
+	hostKeyCallback, err := c.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
 	// Build SSH configuration & auth methods
 	config := &ssh.ClientConfig{
 		User:            c.User,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 		BannerCallback:  ssh.BannerDisplayStderr(),
 	}
 	if c.Password != "" {
@@ -83,13 +108,34 @@ func (c *ReplicaClient) Init(ctx context.Context) (_ *sftp.Client, err error) {
 			return nil, fmt.Errorf("cannot read sftp key path: %w", err)
 		}
 
-		signer, err := ssh.ParsePrivateKey(buf)
-		if err != nil {
+		var signer ssh.Signer
+		if c.KeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(buf, []byte(c.KeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(buf)
+		}
+
+		var passphraseMissingErr *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseMissingErr) {
+			return nil, fmt.Errorf("sftp key path is encrypted, passphrase required")
+		} else if err != nil {
 			return nil, fmt.Errorf("cannot parse sftp key path: %w", err)
 		}
 		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
 	}
 
+	// Authenticate with keys from ssh-agent, if available. The agent is
+	// only needed during the handshake so the connection is closed after dial.
+	if c.AgentSocket != "" {
+		conn, err := net.DialTimeout("unix", c.AgentSocket, c.DialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to ssh-agent: %w", err)
+		}
+		defer conn.Close()
+
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
 	// Append standard port, if necessary.
 	host := c.Host
 	if _, _, err := net.SplitHostPort(c.Host); err != nil {
@@ -361,7 +407,8 @@ func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (_ l
 	return litestream.NewWALSegmentInfoSliceIterator(infos), nil
 }
 
-// WriteWALSegment writes LZ4 compressed data from rd into a file on disk.
+// WriteWALSegment writes LZ4 compressed data from rd into a temporary file &
+// renames it over any existing segment, such as one being compacted.
 func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (info litestream.WALSegmentInfo, err error) {
 	defer func() { c.resetOnConnError(err) }()
 
@@ -380,9 +427,9 @@ func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos,
 		return info, fmt.Errorf("cannot make parent snapshot directory %q: %w", path.Dir(filename), err)
 	}
 
-	f, err := sftpClient.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	f, err := sftpClient.OpenFile(filename+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
 	if err != nil {
-		return info, fmt.Errorf("cannot open snapshot file for writing: %w", err)
+		return info, fmt.Errorf("cannot open wal segment file for writing: %w", err)
 	}
 	defer f.Close()
 
@@ -391,6 +438,8 @@ func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos,
 		return info, err
 	} else if err := f.Close(); err != nil {
 		return info, err
+	} else if err := sftpClient.PosixRename(filename+".tmp", filename); err != nil {
+		return info, fmt.Errorf("cannot rename wal segment file: %w", err)
 	}
 
 	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
@@ -454,6 +503,138 @@ func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Po
 	return nil
 }
 
+// GenerationMetaReader returns a reader for the metadata of a generation.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (_ io.ReadCloser, err error) {
+	defer func() { c.resetOnConnError(err) }()
+
+	sftpClient, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filename, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	f, err := sftpClient.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	return f, nil
+}
+
+// WriteGenerationMeta writes the metadata of a generation.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) (err error) {
+	defer func() { c.resetOnConnError(err) }()
+
+	sftpClient, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	filename, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	if err := sftpClient.MkdirAll(path.Dir(filename)); err != nil {
+		return fmt.Errorf("cannot make parent generation directory %q: %w", path.Dir(filename), err)
+	}
+
+	f, err := sftpClient.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("cannot open generation metadata file for writing: %w", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, rd)
+	if err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+	return nil
+}
+
+// LeaseReader returns a reader for the replica lease.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (_ io.ReadCloser, err error) {
+	defer func() { c.resetOnConnError(err) }()
+
+	sftpClient, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := sftpClient.Open(litestream.LeasePath(c.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	return f, nil
+}
+
+// WriteLease writes the replica lease to a temporary file & renames it over
+// any existing lease.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) (err error) {
+	defer func() { c.resetOnConnError(err) }()
+
+	sftpClient, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	filename := litestream.LeasePath(c.Path)
+	if err := sftpClient.MkdirAll(path.Dir(filename)); err != nil {
+		return fmt.Errorf("cannot make parent lease directory %q: %w", path.Dir(filename), err)
+	}
+
+	f, err := sftpClient.OpenFile(filename+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("cannot open lease file for writing: %w", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, rd)
+	if err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	} else if err := sftpClient.PosixRename(filename+".tmp", filename); err != nil {
+		return fmt.Errorf("cannot rename lease file: %w", err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+	return nil
+}
+
+// DeleteLease deletes the replica lease, if it exists.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) (err error) {
+	defer func() { c.resetOnConnError(err) }()
+
+	sftpClient, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	filename := litestream.LeasePath(c.Path)
+	if err := sftpClient.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot delete lease %q: %w", filename, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
 // Cleanup deletes path & generations directories after empty.
 func (c *ReplicaClient) Cleanup(ctx context.Context) (err error) {
 	defer func() { c.resetOnConnError(err) }()
@@ -471,6 +652,73 @@ func (c *ReplicaClient) Cleanup(ctx context.Context) (err error) {
 	return nil
 }
 
+// hostKeyCallback returns a callback that verifies the server's host key
+// against the known hosts file and/or host key fingerprint.
+func (c *ReplicaClient) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	var callbacks []ssh.HostKeyCallback
+
+	if c.KnownHostsPath != "" {
+		callback, err := knownhosts.New(c.KnownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read sftp known hosts path: %w", err)
+		}
+		callbacks = append(callbacks, callback)
+	}
+
+	if c.HostKey != "" {
+		callback, err := fixedHostKeyCallback(c.HostKey)
+		if err != nil {
+			return nil, err
+		}
+		callbacks = append(callbacks, callback)
+	}
+
+	if len(callbacks) == 0 {
+		slog.Warn("sftp host key verification disabled, set known-hosts-path or host-key", "host", c.Host)
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, callback := range callbacks {
+			if err := callback(hostname, remote, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// fixedHostKeyCallback returns a callback that only accepts a host key
+// matching s. The value can be a SHA256 fingerprint, a legacy MD5
+// fingerprint, or a public key in authorized_keys format.
+func fixedHostKeyCallback(s string) (ssh.HostKeyCallback, error) {
+	s = strings.TrimSpace(s)
+
+	// Use the fingerprint of the public key, if one is specified.
+	if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s)); err == nil {
+		s = ssh.FingerprintSHA256(key)
+	}
+
+	var fingerprint func(ssh.PublicKey) string
+	switch {
+	case strings.HasPrefix(s, "SHA256:"):
+		s, fingerprint = strings.TrimRight(s, "="), ssh.FingerprintSHA256
+	case strings.HasPrefix(s, "MD5:"):
+		s, fingerprint = strings.ToLower(strings.TrimPrefix(s, "MD5:")), ssh.FingerprintLegacyMD5
+	case strings.Count(s, ":") == 15:
+		s, fingerprint = strings.ToLower(s), ssh.FingerprintLegacyMD5
+	default:
+		return nil, fmt.Errorf("invalid sftp host key: %q", s)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if got := fingerprint(key); got != s {
+			return fmt.Errorf("sftp host key mismatch for %s: got %s, expected %s", hostname, got, s)
+		}
+		return nil
+	}, nil
+}
+
 // resetOnConnError closes & clears the client if a connection error occurs.
 func (c *ReplicaClient) resetOnConnError(err error) {
 	if !errors.Is(err, sftp.ErrSSHFxConnectionLost) {
@@ -0,0 +1,404 @@
+package sftp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/benbjohnson/litestream/sftp"
+	pkgsftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestReplicaClient_Type(t *testing.T) {
+	if got, want := sftp.NewReplicaClient().Type(), "sftp"; got != want {
+		t.Fatalf("Type()=%v, want %v", got, want)
+	}
+}
+
+func TestReplicaClient_Init(t *testing.T) {
+	t.Run("Password", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Password = "secret"
+		mustInit(t, c)
+	})
+
+	t.Run("ErrPassword", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Password = "wrong"
+		if _, err := c.Init(context.Background()); err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrNoUser", func(t *testing.T) {
+		if _, err := sftp.NewReplicaClient().Init(context.Background()); err == nil || err.Error() != `sftp user required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("KeyPath", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.KeyPath = mustWritePrivateKey(t, s.clientKey, "")
+		mustInit(t, c)
+	})
+
+	t.Run("KeyPassphrase", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.KeyPath = mustWritePrivateKey(t, s.clientKey, "hunter2")
+		c.KeyPassphrase = "hunter2"
+		mustInit(t, c)
+	})
+
+	t.Run("ErrKeyPassphraseRequired", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.KeyPath = mustWritePrivateKey(t, s.clientKey, "hunter2")
+		if _, err := c.Init(context.Background()); err == nil || err.Error() != `sftp key path is encrypted, passphrase required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrKeyPassphrase", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.KeyPath = mustWritePrivateKey(t, s.clientKey, "hunter2")
+		c.KeyPassphrase = "wrong"
+		if _, err := c.Init(context.Background()); err == nil || !strings.HasPrefix(err.Error(), `cannot parse sftp key path: `) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("AgentSocket", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.AgentSocket = mustServeAgent(t, s.clientKey)
+		mustInit(t, c)
+	})
+
+	t.Run("ErrAgentSocket", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.AgentSocket = filepath.Join(t.TempDir(), "missing.sock")
+		if _, err := c.Init(context.Background()); err == nil || !strings.HasPrefix(err.Error(), `cannot connect to ssh-agent: `) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicaClient_HostKey(t *testing.T) {
+	t.Run("SHA256", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Password = "secret"
+		c.HostKey = ssh.FingerprintSHA256(s.hostKey.PublicKey())
+		mustInit(t, c)
+	})
+
+	t.Run("MD5", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Password = "secret"
+		c.HostKey = ssh.FingerprintLegacyMD5(s.hostKey.PublicKey())
+		mustInit(t, c)
+	})
+
+	t.Run("AuthorizedKey", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Password = "secret"
+		c.HostKey = string(ssh.MarshalAuthorizedKey(s.hostKey.PublicKey()))
+		mustInit(t, c)
+	})
+
+	t.Run("KnownHostsPath", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Password = "secret"
+		c.KnownHostsPath = mustWriteKnownHosts(t, s.addr, s.hostKey.PublicKey())
+		mustInit(t, c)
+	})
+
+	t.Run("ErrMismatch", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Password = "secret"
+		c.HostKey = ssh.FingerprintSHA256(mustGenerateSigner(t).PublicKey())
+		if _, err := c.Init(context.Background()); err == nil || !strings.Contains(err.Error(), "sftp host key mismatch") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Both the known hosts file & the fixed host key must match.
+	t.Run("ErrKnownHostsMismatch", func(t *testing.T) {
+		s := NewServer(t)
+		c := s.NewReplicaClient()
+		c.Password = "secret"
+		c.HostKey = ssh.FingerprintSHA256(s.hostKey.PublicKey())
+		c.KnownHostsPath = mustWriteKnownHosts(t, s.addr, mustGenerateSigner(t).PublicKey())
+		var keyErr *knownhosts.KeyError
+		if _, err := c.Init(context.Background()); !errors.As(err, &keyErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		c := sftp.NewReplicaClient()
+		c.User, c.HostKey = "alice", "foo"
+		if _, err := c.Init(context.Background()); err == nil || err.Error() != `invalid sftp host key: "foo"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// Server is an in-process SSH server with an SFTP subsystem. It accepts the
+// password "secret" or the client key for user "alice".
+type Server struct {
+	ln        net.Listener
+	addr      string
+	dir       string
+	hostKey   ssh.Signer
+	clientKey ed25519.PrivateKey
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// NewServer returns a new, running server that is closed when tb completes.
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	clientPub, err := ssh.NewPublicKey(clientKey.Public())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s := &Server{
+		dir:       tb.TempDir(),
+		hostKey:   mustGenerateSigner(tb),
+		clientKey: clientKey,
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "alice" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "alice" && bytes.Equal(key.Marshal(), clientPub.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(s.hostKey)
+
+	if s.ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		tb.Fatal(err)
+	}
+	s.addr = s.ln.Addr().String()
+	tb.Cleanup(s.Close)
+
+	go s.serve(config)
+	return s
+}
+
+// Close stops the listener & closes all open connections.
+func (s *Server) Close() {
+	_ = s.ln.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// NewReplicaClient returns a client for the server without any credentials.
+func (s *Server) NewReplicaClient() *sftp.ReplicaClient {
+	c := sftp.NewReplicaClient()
+	c.Host = s.addr
+	c.User = "alice"
+	c.Path = s.dir
+	return c
+}
+
+func (s *Server) serve(config *ssh.ServerConfig) {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		go s.handleConn(conn, config)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				server, err := pkgsftp.NewServer(channel)
+				if err != nil {
+					_ = channel.Close()
+					return
+				}
+				go func() {
+					_ = server.Serve()
+					_ = server.Close()
+				}()
+			}
+		}()
+	}
+}
+
+// mustInit initializes c & ensures the connection is usable.
+func mustInit(tb testing.TB, c *sftp.ReplicaClient) {
+	tb.Helper()
+
+	sftpClient, err := c.Init(context.Background())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = sftpClient.Close() })
+
+	if _, err := c.Generations(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func mustGenerateSigner(tb testing.TB) ssh.Signer {
+	tb.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return signer
+}
+
+// mustWritePrivateKey writes key in OpenSSH format, encrypted if a
+// passphrase is specified, & returns the path.
+func mustWritePrivateKey(tb testing.TB, key ed25519.PrivateKey, passphrase string) string {
+	tb.Helper()
+
+	var block *pem.Block
+	var err error
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(key, "")
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	filename := filepath.Join(tb.TempDir(), "id_ed25519")
+	if err := os.WriteFile(filename, pem.EncodeToMemory(block), 0o600); err != nil {
+		tb.Fatal(err)
+	}
+	return filename
+}
+
+// mustWriteKnownHosts writes a known_hosts file with key for addr & returns the path.
+func mustWriteKnownHosts(tb testing.TB, addr string, key ssh.PublicKey) string {
+	tb.Helper()
+
+	filename := filepath.Join(tb.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)
+	if err := os.WriteFile(filename, []byte(line+"\n"), 0o600); err != nil {
+		tb.Fatal(err)
+	}
+	return filename
+}
+
+// mustServeAgent runs an ssh-agent holding key & returns its socket path.
+func mustServeAgent(tb testing.TB, key ed25519.PrivateKey) string {
+	tb.Helper()
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		tb.Fatal(err)
+	}
+
+	// Unix socket paths are limited in length so avoid the test's temp dir.
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	ln, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
@@ -0,0 +1,854 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/internal"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ReplicaClientType is the client type for this package.
+const ReplicaClientType = "sqlite"
+
+// DefaultBusyTimeout is the default time to wait for a lock on the replica database.
+const DefaultBusyTimeout = 5 * time.Second
+
+// ChunkSize is the maximum size of each stored chunk of an object.
+const ChunkSize = 1 << 20
+
+// errGenerationRequired is returned when an empty generation name is passed.
+var errGenerationRequired = errors.New("generation required")
+
+var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.LeaseClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
+
+// ReplicaClient is a client for storing snapshots & WAL segments as blobs
+// within a single SQLite database file. Listing snapshots & WAL segments are
+// indexed queries and every write is performed within a transaction.
+//
+// Snapshots & WAL segments are stored as a sequence of chunks of up to
+// ChunkSize bytes so objects are streamed rather than buffered in memory and
+// are not limited by SQLite's maximum blob length. Objects are spooled to a
+// temporary file before they are written so the write lock is only held while
+// the chunks are inserted, and every chunk of an object is read within a
+// single read transaction.
+type ReplicaClient struct {
+	mu   sync.Mutex
+	db   *sql.DB
+	path string // destination database path
+
+	Replica *litestream.Replica
+}
+
+// NewReplicaClient returns a new instance of ReplicaClient.
+func NewReplicaClient(path string) *ReplicaClient {
+	return &ReplicaClient{
+		path: path,
+	}
+}
+
+// Type returns "sqlite" as the client type.
+func (c *ReplicaClient) Type() string {
+	return ReplicaClientType
+}
+
+// Path returns the path to the destination database file.
+func (c *ReplicaClient) Path() string {
+	return c.path
+}
+
+// Init opens the destination database & creates the schema, if necessary.
+func (c *ReplicaClient) Init(ctx context.Context) (_ *sql.DB, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.db != nil {
+		return c.db, nil
+	}
+
+	if c.path == "" {
+		return nil, fmt.Errorf("sqlite replica path required")
+	}
+
+	// Ensure parent directory exists.
+	if err := internal.MkdirAll(filepath.Dir(c.path), c.dirInfo()); err != nil {
+		return nil, err
+	}
+
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", escapePath(c.path), DefaultBusyTimeout.Milliseconds())
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("cannot create schema: %w", err)
+	}
+
+	c.db = db
+	return c.db, nil
+}
+
+// Close closes the underlying destination database, if open.
+func (c *ReplicaClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.db == nil {
+		return nil
+	}
+	err := c.db.Close()
+	c.db = nil
+	return err
+}
+
+// dirInfo returns the file info of the source database's parent directory so
+// the destination directory can be created with matching permissions.
+func (c *ReplicaClient) dirInfo() os.FileInfo {
+	if c.Replica == nil || c.Replica.DB() == nil {
+		return nil
+	}
+	return c.Replica.DB().DirInfo()
+}
+
+// Generations returns a list of available generation names.
+func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
+	db, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT name FROM generations ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var generations []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		generations = append(generations, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+	return generations, nil
+}
+
+// DeleteGeneration deletes all snapshots & WAL segments within a generation.
+func (c *ReplicaClient) DeleteGeneration(ctx context.Context, generation string) error {
+	if generation == "" {
+		return fmt.Errorf("cannot determine generation path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM wal_segment_chunks WHERE generation = ?`, generation); err != nil {
+		return fmt.Errorf("cannot delete wal segment chunks: %w", err)
+	} else if _, err := tx.ExecContext(ctx, `DELETE FROM wal_segments WHERE generation = ?`, generation); err != nil {
+		return fmt.Errorf("cannot delete wal segments: %w", err)
+	} else if _, err := tx.ExecContext(ctx, `DELETE FROM snapshot_chunks WHERE generation = ?`, generation); err != nil {
+		return fmt.Errorf("cannot delete snapshot chunks: %w", err)
+	} else if _, err := tx.ExecContext(ctx, `DELETE FROM snapshots WHERE generation = ?`, generation); err != nil {
+		return fmt.Errorf("cannot delete snapshots: %w", err)
+	} else if _, err := tx.ExecContext(ctx, `DELETE FROM generation_meta WHERE generation = ?`, generation); err != nil {
+		return fmt.Errorf("cannot delete generation metadata: %w", err)
+	} else if _, err := tx.ExecContext(ctx, `DELETE FROM generations WHERE name = ?`, generation); err != nil {
+		return fmt.Errorf("cannot delete generation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+
+	return nil
+}
+
+// Snapshots returns an iterator over all available snapshots for a generation.
+func (c *ReplicaClient) Snapshots(ctx context.Context, generation string) (litestream.SnapshotIterator, error) {
+	if generation == "" {
+		return nil, fmt.Errorf("cannot determine snapshots path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT "index", size, created_at
+		FROM snapshots
+		WHERE generation = ?
+		ORDER BY "index"
+	`, generation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var infos []litestream.SnapshotInfo
+	for rows.Next() {
+		info := litestream.SnapshotInfo{Generation: generation}
+
+		var createdAt int64
+		if err := rows.Scan(&info.Index, &info.Size, &createdAt); err != nil {
+			return nil, err
+		}
+		info.CreatedAt = time.Unix(0, createdAt).UTC()
+
+		infos = append(infos, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+	return litestream.NewSnapshotInfoSliceIterator(infos), nil
+}
+
+// WriteSnapshot writes LZ4 compressed data from rd into the snapshots table.
+func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (info litestream.SnapshotInfo, err error) {
+	if generation == "" {
+		return info, fmt.Errorf("cannot determine snapshot path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	f, err := c.spool(rd)
+	if err != nil {
+		return info, fmt.Errorf("cannot spool snapshot: %w", err)
+	}
+	defer func() { _ = closeSpool(f) }()
+
+	createdAt := time.Now().UTC()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return info, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var size int64
+	if err := upsertGeneration(ctx, tx, generation, createdAt); err != nil {
+		return info, err
+	} else if _, err := tx.ExecContext(ctx, `DELETE FROM snapshot_chunks WHERE generation = ? AND "index" = ?`, generation, index); err != nil {
+		return info, fmt.Errorf("cannot delete snapshot chunks: %w", err)
+	} else if size, err = insertChunks(ctx, tx, `
+		INSERT INTO snapshot_chunks (generation, "index", seq, data)
+		VALUES (?, ?, ?, ?)
+	`, []any{generation, index}, f); err != nil {
+		return info, fmt.Errorf("cannot insert snapshot: %w", err)
+	} else if _, err := tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO snapshots (generation, "index", size, created_at)
+		VALUES (?, ?, ?, ?)
+	`, generation, index, size, createdAt.UnixNano()); err != nil {
+		return info, fmt.Errorf("cannot insert snapshot: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return info, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(size))
+
+	return litestream.SnapshotInfo{
+		Generation: generation,
+		Index:      index,
+		Size:       size,
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+// SnapshotReader returns a reader for snapshot data at the given generation/index.
+// Returns os.ErrNotExist if no matching index is found.
+func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+	if generation == "" {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := openChunkReader(ctx, db, `
+		SELECT s.size, c.seq, c.data
+		FROM snapshots s
+		LEFT JOIN snapshot_chunks c ON c.generation = s.generation AND c."index" = s."index"
+		WHERE s.generation = ? AND s."index" = ?
+		ORDER BY c.seq
+	`, generation, index)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(r.size))
+
+	return r, nil
+}
+
+// DeleteSnapshot deletes a snapshot with the given generation & index.
+func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
+	if generation == "" {
+		return fmt.Errorf("cannot determine snapshot path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM snapshot_chunks WHERE generation = ? AND "index" = ?`, generation, index); err != nil {
+		return fmt.Errorf("cannot delete snapshot chunks: %w", err)
+	} else if _, err := tx.ExecContext(ctx, `DELETE FROM snapshots WHERE generation = ? AND "index" = ?`, generation, index); err != nil {
+		return fmt.Errorf("cannot delete snapshot: %w", err)
+	} else if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+
+	return nil
+}
+
+// WALSegments returns an iterator over all available WAL files for a generation.
+func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+	if generation == "" {
+		return nil, fmt.Errorf("cannot determine wal path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT "index", "offset", size, created_at
+		FROM wal_segments
+		WHERE generation = ?
+		ORDER BY "index", "offset"
+	`, generation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var infos []litestream.WALSegmentInfo
+	for rows.Next() {
+		info := litestream.WALSegmentInfo{Generation: generation}
+
+		var createdAt int64
+		if err := rows.Scan(&info.Index, &info.Offset, &info.Size, &createdAt); err != nil {
+			return nil, err
+		}
+		info.CreatedAt = time.Unix(0, createdAt).UTC()
+
+		infos = append(infos, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+	return litestream.NewWALSegmentInfoSliceIterator(infos), nil
+}
+
+// WriteWALSegment writes LZ4 compressed data from rd into the wal_segments table.
+func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (info litestream.WALSegmentInfo, err error) {
+	if pos.Generation == "" {
+		return info, fmt.Errorf("cannot determine wal segment path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	f, err := c.spool(rd)
+	if err != nil {
+		return info, fmt.Errorf("cannot spool wal segment: %w", err)
+	}
+	defer func() { _ = closeSpool(f) }()
+
+	createdAt := time.Now().UTC()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return info, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var size int64
+	if err := upsertGeneration(ctx, tx, pos.Generation, createdAt); err != nil {
+		return info, err
+	} else if _, err := tx.ExecContext(ctx, `DELETE FROM wal_segment_chunks WHERE generation = ? AND "index" = ? AND "offset" = ?`, pos.Generation, pos.Index, pos.Offset); err != nil {
+		return info, fmt.Errorf("cannot delete wal segment chunks: %w", err)
+	} else if size, err = insertChunks(ctx, tx, `
+		INSERT INTO wal_segment_chunks (generation, "index", "offset", seq, data)
+		VALUES (?, ?, ?, ?, ?)
+	`, []any{pos.Generation, pos.Index, pos.Offset}, f); err != nil {
+		return info, fmt.Errorf("cannot insert wal segment: %w", err)
+	} else if _, err := tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO wal_segments (generation, "index", "offset", size, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, pos.Generation, pos.Index, pos.Offset, size, createdAt.UnixNano()); err != nil {
+		return info, fmt.Errorf("cannot insert wal segment: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return info, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(size))
+
+	return litestream.WALSegmentInfo{
+		Generation: pos.Generation,
+		Index:      pos.Index,
+		Offset:     pos.Offset,
+		Size:       size,
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+// WALSegmentReader returns a reader for a section of WAL data at the given position.
+// Returns os.ErrNotExist if no matching index/offset is found.
+func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+	if pos.Generation == "" {
+		return nil, fmt.Errorf("cannot determine wal segment path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := openChunkReader(ctx, db, `
+		SELECT s.size, c.seq, c.data
+		FROM wal_segments s
+		LEFT JOIN wal_segment_chunks c ON c.generation = s.generation AND c."index" = s."index" AND c."offset" = s."offset"
+		WHERE s.generation = ? AND s."index" = ? AND s."offset" = ?
+		ORDER BY c.seq
+	`, pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(r.size))
+
+	return r, nil
+}
+
+// DeleteWALSegments deletes WAL segments at the given positions.
+func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Pos) error {
+	for _, pos := range a {
+		if pos.Generation == "" {
+			return fmt.Errorf("cannot determine wal segment path: %w", errGenerationRequired)
+		}
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	chunkStmt, err := tx.PrepareContext(ctx, `DELETE FROM wal_segment_chunks WHERE generation = ? AND "index" = ? AND "offset" = ?`)
+	if err != nil {
+		return err
+	}
+	defer chunkStmt.Close()
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM wal_segments WHERE generation = ? AND "index" = ? AND "offset" = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, pos := range a {
+		if _, err := chunkStmt.ExecContext(ctx, pos.Generation, pos.Index, pos.Offset); err != nil {
+			return fmt.Errorf("cannot delete wal segment chunks: %w", err)
+		} else if _, err := stmt.ExecContext(ctx, pos.Generation, pos.Index, pos.Offset); err != nil {
+			return fmt.Errorf("cannot delete wal segment: %w", err)
+		}
+		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	}
+
+	return tx.Commit()
+}
+
+// GenerationMetaReader returns a reader for the metadata of a generation.
+// Returns os.ErrNotExist if no metadata exists.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	if generation == "" {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if err := db.QueryRowContext(ctx, `SELECT data FROM generation_meta WHERE generation = ?`, generation).Scan(&data); err == sql.ErrNoRows {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(len(data)))
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// WriteGenerationMeta writes the metadata of a generation, replacing any
+// existing metadata.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	if generation == "" {
+		return fmt.Errorf("cannot determine generation metadata path: %w", errGenerationRequired)
+	}
+
+	db, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := upsertGeneration(ctx, tx, generation, time.Now().UTC()); err != nil {
+		return err
+	} else if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO generation_meta (generation, data) VALUES (?, ?)`, generation, data); err != nil {
+		return fmt.Errorf("cannot write generation metadata: %w", err)
+	} else if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(len(data)))
+
+	return nil
+}
+
+// LeaseReader returns a reader for the replica lease. Returns os.ErrNotExist
+// if no lease exists.
+func (c *ReplicaClient) LeaseReader(ctx context.Context) (io.ReadCloser, error) {
+	db, err := c.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if err := db.QueryRowContext(ctx, `SELECT data FROM lease WHERE id = 1`).Scan(&data); err == sql.ErrNoRows {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "GET").Add(float64(len(data)))
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// WriteLease writes the replica lease, replacing any existing lease.
+func (c *ReplicaClient) WriteLease(ctx context.Context, rd io.Reader) error {
+	db, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	} else if _, err := db.ExecContext(ctx, `INSERT OR REPLACE INTO lease (id, data) VALUES (1, ?)`, data); err != nil {
+		return fmt.Errorf("cannot write lease: %w", err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(len(data)))
+
+	return nil
+}
+
+// DeleteLease deletes the replica lease, if it exists.
+func (c *ReplicaClient) DeleteLease(ctx context.Context) error {
+	db, err := c.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM lease`); err != nil {
+		return fmt.Errorf("cannot delete lease: %w", err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+
+	return nil
+}
+
+// spool copies rd to a temporary file next to the destination database &
+// rewinds it. This avoids holding the write lock while rd is being read.
+func (c *ReplicaClient) spool(rd io.Reader) (_ *os.File, err error) {
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = closeSpool(f)
+		}
+	}()
+
+	if rd != nil {
+		if _, err := io.Copy(f, rd); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// closeSpool closes & removes a file returned by spool().
+func closeSpool(f *os.File) error {
+	err := f.Close()
+	if e := os.Remove(f.Name()); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// upsertGeneration inserts a generation row if it does not already exist.
+func upsertGeneration(ctx context.Context, tx *sql.Tx, generation string, createdAt time.Time) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO generations (name, created_at)
+		VALUES (?, ?)
+	`, generation, createdAt.UnixNano()); err != nil {
+		return fmt.Errorf("cannot insert generation: %w", err)
+	}
+	return nil
+}
+
+// insertChunks reads rd in chunks of up to ChunkSize bytes & inserts each one
+// with query. The args are followed by the chunk sequence number & data.
+// Returns the total number of bytes inserted.
+func insertChunks(ctx context.Context, tx *sql.Tx, query string, args []any, rd io.Reader) (size int64, err error) {
+	if rd == nil {
+		return 0, nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	buf := make([]byte, ChunkSize)
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(rd, buf)
+		if n > 0 {
+			if _, err := stmt.ExecContext(ctx, append(args[:len(args):len(args)], seq, buf[:n])...); err != nil {
+				return size, err
+			}
+			size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, nil
+		} else if err != nil {
+			return size, err
+		}
+	}
+}
+
+// chunkReader reads the chunks of an object in sequence from a single query
+// so every chunk is read within the same read transaction. Only a single
+// chunk is held in memory at a time.
+type chunkReader struct {
+	rows *sql.Rows
+	size int64 // total size of the object
+	seq  int   // sequence number of the next chunk
+	buf  bytes.Reader
+}
+
+// openChunkReader executes query, which must return the object size, chunk
+// sequence number & chunk data ordered by sequence number. The sequence
+// number & data are NULL for objects without chunks. Returns os.ErrNotExist
+// if the object does not exist.
+func openChunkReader(ctx context.Context, db *sql.DB, query string, args ...any) (_ *chunkReader, err error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = rows.Close()
+		}
+	}()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, os.ErrNotExist
+	}
+
+	r := &chunkReader{rows: rows}
+	if err := r.scan(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// scan reads the current row into the chunk buffer.
+func (r *chunkReader) scan() error {
+	var seq sql.NullInt64
+	var data []byte
+	if err := r.rows.Scan(&r.size, &seq, &data); err != nil {
+		return err
+	} else if !seq.Valid {
+		return nil // no chunks
+	} else if int(seq.Int64) != r.seq {
+		return fmt.Errorf("missing chunk: seq=%d", r.seq)
+	}
+	r.buf.Reset(data)
+	r.seq++
+	return nil
+}
+
+// Read reads from the current chunk & fetches the next chunk once it is read.
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if !r.rows.Next() {
+			if err := r.rows.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		} else if err := r.scan(); err != nil {
+			return 0, err
+		}
+	}
+	return r.buf.Read(p)
+}
+
+// Close closes the underlying query & ends the read transaction.
+func (r *chunkReader) Close() error { return r.rows.Close() }
+
+// escapePath escapes characters in path that have special meaning in a
+// "file:" URI so they are not parsed as part of the query string.
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+// schema is the schema of the destination database. Metadata is stored
+// separately from chunk data so listings do not need to read blobs.
+const schema = `
+CREATE TABLE IF NOT EXISTS generations (
+	name       TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+	generation TEXT NOT NULL,
+	"index"    INTEGER NOT NULL,
+	size       INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (generation, "index")
+);
+
+CREATE TABLE IF NOT EXISTS snapshot_chunks (
+	generation TEXT NOT NULL,
+	"index"    INTEGER NOT NULL,
+	seq        INTEGER NOT NULL,
+	data       BLOB NOT NULL,
+	PRIMARY KEY (generation, "index", seq)
+);
+
+CREATE TABLE IF NOT EXISTS wal_segments (
+	generation TEXT NOT NULL,
+	"index"    INTEGER NOT NULL,
+	"offset"   INTEGER NOT NULL,
+	size       INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (generation, "index", "offset")
+);
+
+CREATE TABLE IF NOT EXISTS wal_segment_chunks (
+	generation TEXT NOT NULL,
+	"index"    INTEGER NOT NULL,
+	"offset"   INTEGER NOT NULL,
+	seq        INTEGER NOT NULL,
+	data       BLOB NOT NULL,
+	PRIMARY KEY (generation, "index", "offset", seq)
+);
+
+CREATE TABLE IF NOT EXISTS generation_meta (
+	generation TEXT PRIMARY KEY,
+	data       BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS lease (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	data BLOB NOT NULL
+);
+`
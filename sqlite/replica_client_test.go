@@ -0,0 +1,262 @@
+package sqlite_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/sqlite"
+)
+
+func TestReplicaClient_Path(t *testing.T) {
+	c := sqlite.NewReplicaClient("/foo/bar.db")
+	if got, want := c.Path(), "/foo/bar.db"; got != want {
+		t.Fatalf("Path()=%v, want %v", got, want)
+	}
+}
+
+func TestReplicaClient_Type(t *testing.T) {
+	if got, want := sqlite.NewReplicaClient("").Type(), "sqlite"; got != want {
+		t.Fatalf("Type()=%v, want %v", got, want)
+	}
+}
+
+func TestReplicaClient_Init(t *testing.T) {
+	// Ensure URI characters in the path are not parsed as part of the DSN.
+	t.Run("EscapePath", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a?b#c%d.db")
+		c := sqlite.NewReplicaClient(path)
+		defer c.Close()
+
+		if _, err := c.Init(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrNoPath", func(t *testing.T) {
+		if _, err := sqlite.NewReplicaClient("").Init(context.Background()); err == nil || err.Error() != `sqlite replica path required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReplicaClient_WriteSnapshot(t *testing.T) {
+	c := sqlite.NewReplicaClient(filepath.Join(t.TempDir(), "replica.db"))
+	defer c.Close()
+
+	// Span multiple chunks with a partial final chunk.
+	data := make([]byte, 2*sqlite.ChunkSize+100)
+	rand.New(rand.NewSource(0)).Read(data)
+
+	if info, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	} else if got, want := info.Size, int64(len(data)); got != want {
+		t.Fatalf("Size=%d, want %d", got, want)
+	}
+
+	if got := mustReadSnapshot(t, c, "b16ddcf5c697540f", 1000); !bytes.Equal(got, data) {
+		t.Fatalf("data mismatch: len=%d, want %d", len(got), len(data))
+	}
+
+	// Overwriting replaces all previous chunks.
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, bytes.NewReader(data[:10])); err != nil {
+		t.Fatal(err)
+	} else if got, want := mustReadSnapshot(t, c, "b16ddcf5c697540f", 1000), data[:10]; !bytes.Equal(got, want) {
+		t.Fatalf("data mismatch: len=%d, want %d", len(got), len(want))
+	}
+
+	if err := c.DeleteSnapshot(context.Background(), "b16ddcf5c697540f", 1000); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.SnapshotReader(context.Background(), "b16ddcf5c697540f", 1000); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReplicaClient_WriteWALSegment(t *testing.T) {
+	c := sqlite.NewReplicaClient(filepath.Join(t.TempDir(), "replica.db"))
+	defer c.Close()
+
+	data := make([]byte, sqlite.ChunkSize+100)
+	rand.New(rand.NewSource(0)).Read(data)
+
+	pos := litestream.Pos{Generation: "b16ddcf5c697540f", Index: 1000, Offset: 2000}
+	if info, err := c.WriteWALSegment(context.Background(), pos, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	} else if got, want := info.Size, int64(len(data)); got != want {
+		t.Fatalf("Size=%d, want %d", got, want)
+	} else if got := mustReadWALSegment(t, c, pos); !bytes.Equal(got, data) {
+		t.Fatalf("data mismatch: len=%d, want %d", len(got), len(data))
+	}
+
+	// Empty segments are stored without any chunks.
+	empty := litestream.Pos{Generation: "b16ddcf5c697540f", Index: 1000, Offset: 0}
+	if _, err := c.WriteWALSegment(context.Background(), empty, bytes.NewReader(nil)); err != nil {
+		t.Fatal(err)
+	} else if got := mustReadWALSegment(t, c, empty); len(got) != 0 {
+		t.Fatalf("unexpected data: len=%d", len(got))
+	}
+
+	if err := c.DeleteGeneration(context.Background(), "b16ddcf5c697540f"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.WALSegmentReader(context.Background(), pos); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the write lock is not held while the object is read from the caller.
+func TestReplicaClient_WriteSnapshot_Spool(t *testing.T) {
+	c := sqlite.NewReplicaClient(filepath.Join(t.TempDir(), "replica.db"))
+	defer c.Close()
+
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, pr)
+		errc <- err
+	}()
+	if _, err := pw.Write([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes are not blocked while the snapshot is still being read.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pos := litestream.Pos{Generation: "b16ddcf5c697540f", Index: 1000}
+	if _, err := c.WriteWALSegment(ctx, pos, bytes.NewReader([]byte("bar"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := <-errc; err != nil {
+		t.Fatal(err)
+	} else if got, want := string(mustReadSnapshot(t, c, "b16ddcf5c697540f", 1000)), "foo"; got != want {
+		t.Fatalf("data=%q, want %q", got, want)
+	}
+}
+
+// Ensure all chunks are read from the same version of an object.
+func TestReplicaClient_SnapshotReader_Consistent(t *testing.T) {
+	c := sqlite.NewReplicaClient(filepath.Join(t.TempDir(), "replica.db"))
+	defer c.Close()
+
+	data := bytes.Repeat([]byte("a"), 2*sqlite.ChunkSize)
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := c.SnapshotReader(context.Background(), "b16ddcf5c697540f", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadFull(rc, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwrite the snapshot while it is being read.
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, bytes.NewReader(bytes.Repeat([]byte("b"), 2*sqlite.ChunkSize))); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, data[10:]) {
+		t.Fatal("data mismatch")
+	} else if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplicaClient_GenerationMeta(t *testing.T) {
+	c := sqlite.NewReplicaClient(filepath.Join(t.TempDir(), "replica.db"))
+	defer c.Close()
+
+	if _, err := c.GenerationMetaReader(context.Background(), "b16ddcf5c697540f"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := c.WriteGenerationMeta(context.Background(), "b16ddcf5c697540f", strings.NewReader(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rc, err := c.GenerationMetaReader(context.Background(), "b16ddcf5c697540f"); err != nil {
+		t.Fatal(err)
+	} else if buf, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `{}`; got != want {
+		t.Fatalf("meta=%s, want %s", got, want)
+	}
+
+	// Metadata is removed with its generation.
+	if err := c.DeleteGeneration(context.Background(), "b16ddcf5c697540f"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.GenerationMetaReader(context.Background(), "b16ddcf5c697540f"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReplicaClient_Lease(t *testing.T) {
+	c := sqlite.NewReplicaClient(filepath.Join(t.TempDir(), "replica.db"))
+	defer c.Close()
+
+	if _, err := c.LeaseReader(context.Background()); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, data := range []string{`{"holder":"a"}`, `{"holder":"b"}`} {
+		if err := c.WriteLease(context.Background(), strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rc, err := c.LeaseReader(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if buf, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `{"holder":"b"}`; got != want {
+		t.Fatalf("lease=%s, want %s", got, want)
+	}
+
+	if err := c.DeleteLease(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.LeaseReader(context.Background()); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func mustReadSnapshot(tb testing.TB, c *sqlite.ReplicaClient, generation string, index int) []byte {
+	tb.Helper()
+	rc, err := c.SnapshotReader(context.Background(), generation, index)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf
+}
+
+func mustReadWALSegment(tb testing.TB, c *sqlite.ReplicaClient, pos litestream.Pos) []byte {
+	tb.Helper()
+	rc, err := c.WALSegmentReader(context.Background(), pos)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf
+}
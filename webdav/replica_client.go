@@ -0,0 +1,685 @@
+package webdav
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/internal"
+)
+
+// ReplicaClientType is the client type for this package.
+const ReplicaClientType = "webdav"
+
+// Default settings for replica client.
+const (
+	DefaultTimeout = 30 * time.Second
+)
+
+var _ litestream.ReplicaClient = (*ReplicaClient)(nil)
+var _ litestream.GenerationMetaClient = (*ReplicaClient)(nil)
+
+// ReplicaClient is a client for writing snapshots & WAL segments to a WebDAV server.
+type ReplicaClient struct {
+	mu     sync.Mutex
+	client *http.Client
+	dirs   map[string]struct{} // collections known to exist
+
+	// WebDAV connection info. Endpoint is the base URL of the WebDAV share
+	// (e.g. "https://nas.local/dav") and Path is the directory within it.
+	Endpoint   string
+	User       string
+	Password   string
+	Path       string
+	SkipVerify bool
+	Timeout    time.Duration
+}
+
+// NewReplicaClient returns a new instance of ReplicaClient.
+func NewReplicaClient() *ReplicaClient {
+	return &ReplicaClient{
+		Timeout: DefaultTimeout,
+	}
+}
+
+// Type returns "webdav" as the client type.
+func (c *ReplicaClient) Type() string {
+	return ReplicaClientType
+}
+
+// Init initializes the HTTP client. No-op if already initialized.
+func (c *ReplicaClient) Init(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		return nil
+	}
+
+	if c.Endpoint == "" {
+		return fmt.Errorf("webdav endpoint required")
+	} else if _, err := url.Parse(c.Endpoint); err != nil {
+		return fmt.Errorf("invalid webdav endpoint: %w", err)
+	}
+
+	// The timeout only applies to connecting & waiting on response headers so
+	// that large uploads & downloads are not interrupted.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: c.Timeout}).DialContext
+	transport.ResponseHeaderTimeout = c.Timeout
+	if c.SkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	c.client = &http.Client{Transport: transport}
+
+	return nil
+}
+
+// Generations returns a list of available generation names.
+func (c *ReplicaClient) Generations(ctx context.Context) ([]string, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	entries, err := c.readDir(ctx, litestream.GenerationsPath(c.Path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var generations []string
+	for _, entry := range entries {
+		if !entry.isDir {
+			continue
+		} else if !litestream.IsGenerationName(entry.name) {
+			continue
+		}
+		generations = append(generations, entry.name)
+	}
+
+	return generations, nil
+}
+
+// DeleteGeneration deletes all snapshots & WAL segments within a generation.
+func (c *ReplicaClient) DeleteGeneration(ctx context.Context, generation string) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	dir, err := litestream.GenerationPath(c.Path, generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation path: %w", err)
+	}
+
+	// WebDAV servers remove collections recursively.
+	c.forgetDirs(dir)
+	if err := c.delete(ctx, dir+"/"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot delete generation %q: %w", dir, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
+// Snapshots returns an iterator over all available snapshots for a generation.
+func (c *ReplicaClient) Snapshots(ctx context.Context, generation string) (litestream.SnapshotIterator, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	dir, err := litestream.SnapshotsPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshots path: %w", err)
+	}
+
+	entries, err := c.readDir(ctx, dir)
+	if os.IsNotExist(err) {
+		return litestream.NewSnapshotInfoSliceIterator(nil), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Iterate over every file and convert to metadata.
+	infos := make([]litestream.SnapshotInfo, 0, len(entries))
+	for _, entry := range entries {
+		index, err := litestream.ParseSnapshotPath(entry.name)
+		if err != nil {
+			continue
+		}
+
+		infos = append(infos, litestream.SnapshotInfo{
+			Generation: generation,
+			Index:      index,
+			Size:       entry.size,
+			CreatedAt:  entry.modTime.UTC(),
+		})
+	}
+
+	return litestream.NewSnapshotInfoSliceIterator(infos), nil
+}
+
+// WriteSnapshot writes LZ4 compressed data from rd to the WebDAV server.
+func (c *ReplicaClient) WriteSnapshot(ctx context.Context, generation string, index int, rd io.Reader) (info litestream.SnapshotInfo, err error) {
+	if err := c.Init(ctx); err != nil {
+		return info, err
+	}
+
+	filename, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return info, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+	startTime := time.Now()
+
+	if err := c.mkdirAll(ctx, path.Dir(filename)); err != nil {
+		return info, fmt.Errorf("cannot make parent snapshot directory %q: %w", path.Dir(filename), err)
+	}
+
+	n, err := c.put(ctx, filename, rd)
+	if err != nil {
+		return info, fmt.Errorf("cannot write snapshot %q: %w", filename, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+
+	return litestream.SnapshotInfo{
+		Generation: generation,
+		Index:      index,
+		Size:       n,
+		CreatedAt:  startTime.UTC(),
+	}, nil
+}
+
+// SnapshotReader returns a reader for snapshot data at the given generation/index.
+// Returns os.ErrNotExist if no matching index is found.
+func (c *ReplicaClient) SnapshotReader(ctx context.Context, generation string, index int) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	filename, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	rc, err := c.get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	return rc, nil
+}
+
+// DeleteSnapshot deletes a snapshot with the given generation & index.
+func (c *ReplicaClient) DeleteSnapshot(ctx context.Context, generation string, index int) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	filename, err := litestream.SnapshotPath(c.Path, generation, index)
+	if err != nil {
+		return fmt.Errorf("cannot determine snapshot path: %w", err)
+	}
+
+	if err := c.delete(ctx, filename); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot delete snapshot %q: %w", filename, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	return nil
+}
+
+// WALSegments returns an iterator over all available WAL files for a generation.
+func (c *ReplicaClient) WALSegments(ctx context.Context, generation string) (litestream.WALSegmentIterator, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	dir, err := litestream.WALPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine wal path: %w", err)
+	}
+
+	entries, err := c.readDir(ctx, dir)
+	if os.IsNotExist(err) {
+		return litestream.NewWALSegmentInfoSliceIterator(nil), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Iterate over every file and convert to metadata.
+	infos := make([]litestream.WALSegmentInfo, 0, len(entries))
+	for _, entry := range entries {
+		index, offset, err := litestream.ParseWALSegmentPath(entry.name)
+		if err != nil {
+			continue
+		}
+
+		infos = append(infos, litestream.WALSegmentInfo{
+			Generation: generation,
+			Index:      index,
+			Offset:     offset,
+			Size:       entry.size,
+			CreatedAt:  entry.modTime.UTC(),
+		})
+	}
+
+	return litestream.NewWALSegmentInfoSliceIterator(infos), nil
+}
+
+// WriteWALSegment writes LZ4 compressed data from rd to the WebDAV server.
+func (c *ReplicaClient) WriteWALSegment(ctx context.Context, pos litestream.Pos, rd io.Reader) (info litestream.WALSegmentInfo, err error) {
+	if err := c.Init(ctx); err != nil {
+		return info, err
+	}
+
+	filename, err := litestream.WALSegmentPath(c.Path, pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return info, fmt.Errorf("cannot determine wal segment path: %w", err)
+	}
+	startTime := time.Now()
+
+	if err := c.mkdirAll(ctx, path.Dir(filename)); err != nil {
+		return info, fmt.Errorf("cannot make parent wal segment directory %q: %w", path.Dir(filename), err)
+	}
+
+	n, err := c.put(ctx, filename, rd)
+	if err != nil {
+		return info, fmt.Errorf("cannot write wal segment %q: %w", filename, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+
+	return litestream.WALSegmentInfo{
+		Generation: pos.Generation,
+		Index:      pos.Index,
+		Offset:     pos.Offset,
+		Size:       n,
+		CreatedAt:  startTime.UTC(),
+	}, nil
+}
+
+// WALSegmentReader returns a reader for a section of WAL data at the given index.
+// Returns os.ErrNotExist if no matching index/offset is found.
+func (c *ReplicaClient) WALSegmentReader(ctx context.Context, pos litestream.Pos) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	filename, err := litestream.WALSegmentPath(c.Path, pos.Generation, pos.Index, pos.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine wal segment path: %w", err)
+	}
+
+	rc, err := c.get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	return rc, nil
+}
+
+// DeleteWALSegments deletes WAL segments with at the given positions.
+func (c *ReplicaClient) DeleteWALSegments(ctx context.Context, a []litestream.Pos) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	for _, pos := range a {
+		filename, err := litestream.WALSegmentPath(c.Path, pos.Generation, pos.Index, pos.Offset)
+		if err != nil {
+			return fmt.Errorf("cannot determine wal segment path: %w", err)
+		}
+
+		if err := c.delete(ctx, filename); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot delete wal segment %q: %w", filename, err)
+		}
+		internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "DELETE").Inc()
+	}
+
+	return nil
+}
+
+// GenerationMetaReader returns a reader for the metadata of a generation.
+// Returns os.ErrNotExist if no metadata exists.
+func (c *ReplicaClient) GenerationMetaReader(ctx context.Context, generation string) (io.ReadCloser, error) {
+	if err := c.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	filename, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	rc, err := c.get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "GET").Inc()
+
+	return rc, nil
+}
+
+// WriteGenerationMeta writes the metadata of a generation.
+func (c *ReplicaClient) WriteGenerationMeta(ctx context.Context, generation string, rd io.Reader) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	filename, err := litestream.GenerationMetaPath(c.Path, generation)
+	if err != nil {
+		return fmt.Errorf("cannot determine generation metadata path: %w", err)
+	}
+
+	if err := c.mkdirAll(ctx, path.Dir(filename)); err != nil {
+		return fmt.Errorf("cannot make parent generation directory %q: %w", path.Dir(filename), err)
+	}
+
+	n, err := c.put(ctx, filename, rd)
+	if err != nil {
+		return fmt.Errorf("cannot write generation metadata %q: %w", filename, err)
+	}
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "PUT").Inc()
+	internal.OperationBytesCounterVec.WithLabelValues(ReplicaClientType, "PUT").Add(float64(n))
+
+	return nil
+}
+
+// Cleanup deletes path & generations directories after empty.
+func (c *ReplicaClient) Cleanup(ctx context.Context) error {
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+
+	c.forgetDirs("")
+	if err := c.delete(ctx, litestream.GenerationsPath(c.Path)+"/"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot delete generations path: %w", err)
+	}
+	return nil
+}
+
+// urlFor returns the full URL for a path relative to the endpoint.
+func (c *ReplicaClient) urlFor(p string) string {
+	u, _ := url.Parse(c.Endpoint)
+	trailing := strings.HasSuffix(p, "/")
+	u.Path = path.Join("/", u.Path, p)
+	if trailing && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+// newRequest returns a new HTTP request with authentication applied.
+func (c *ReplicaClient) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.urlFor(p), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.User != "" || c.Password != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+	return req, nil
+}
+
+// do executes req and returns an error for non-2xx responses. A 404 response
+// is converted to os.ErrNotExist. The caller must close the response body.
+func (c *ReplicaClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	return nil, &StatusError{Method: req.Method, URL: req.URL.Redacted(), StatusCode: resp.StatusCode}
+}
+
+// get returns the body of the file at p.
+func (c *ReplicaClient) get(ctx context.Context, p string) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// put uploads the contents of rd to p. Returns the number of bytes written.
+func (c *ReplicaClient) put(ctx context.Context, p string, rd io.Reader) (int64, error) {
+	counter := internal.NewReadCounter(rd)
+
+	req, err := c.newRequest(ctx, http.MethodPut, p, counter)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		// Collections may have been removed by another client so recreate
+		// them on the next write.
+		c.forgetDirs("")
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return counter.N(), nil
+}
+
+// delete removes the file or collection at p.
+func (c *ReplicaClient) delete(ctx context.Context, p string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, p, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// mkdirAll creates the collection at dir along with any necessary parents.
+// Created collections are cached so repeated writes to the same directory
+// do not issue a MKCOL request for every level of the path.
+func (c *ReplicaClient) mkdirAll(ctx context.Context, dir string) error {
+	var p string
+	for _, name := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		p = path.Join(p, name)
+
+		if c.dirExists(p) {
+			continue
+		}
+
+		req, err := c.newRequest(ctx, "MKCOL", p+"/", nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		// A 405 is returned when the collection already exists.
+		switch resp.StatusCode {
+		case http.StatusCreated, http.StatusOK, http.StatusMethodNotAllowed:
+		default:
+			return &StatusError{Method: req.Method, URL: req.URL.Redacted(), StatusCode: resp.StatusCode}
+		}
+
+		c.mu.Lock()
+		if c.dirs == nil {
+			c.dirs = make(map[string]struct{})
+		}
+		c.dirs[p] = struct{}{}
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// dirExists returns true if the collection at p is cached as created.
+func (c *ReplicaClient) dirExists(p string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.dirs[p]
+	return ok
+}
+
+// forgetDirs removes dir & its descendants from the cache of created
+// collections. An empty dir clears the entire cache.
+func (c *ReplicaClient) forgetDirs(dir string) {
+	dir = strings.Trim(dir, "/")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for p := range c.dirs {
+		if dir == "" || p == dir || strings.HasPrefix(p, dir+"/") {
+			delete(c.dirs, p)
+		}
+	}
+}
+
+// readDir returns the direct children of the collection at dir.
+// Returns os.ErrNotExist if the collection does not exist.
+func (c *ReplicaClient) readDir(ctx context.Context, dir string) ([]dirEntry, error) {
+	req, err := c.newRequest(ctx, "PROPFIND", dir+"/", strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", `application/xml; charset="utf-8"`)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	internal.OperationTotalCounterVec.WithLabelValues(ReplicaClientType, "LIST").Inc()
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("cannot decode propfind response: %w", err)
+	}
+
+	// The request URL's path is used to skip the entry for the collection itself.
+	self := strings.TrimSuffix(req.URL.Path, "/")
+
+	entries := make([]dirEntry, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, fmt.Errorf("invalid propfind href %q: %w", r.Href, err)
+		}
+		if strings.TrimSuffix(href.Path, "/") == self {
+			continue
+		}
+
+		entry := dirEntry{name: path.Base(strings.TrimSuffix(href.Path, "/"))}
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			entry.isDir = ps.Prop.ResourceType.Collection != nil
+			if ps.Prop.ContentLength != "" {
+				if entry.size, err = strconv.ParseInt(ps.Prop.ContentLength, 10, 64); err != nil {
+					return nil, fmt.Errorf("invalid content length for %q: %w", r.Href, err)
+				}
+			}
+			if ps.Prop.LastModified != "" {
+				if entry.modTime, err = http.ParseTime(ps.Prop.LastModified); err != nil {
+					return nil, fmt.Errorf("invalid last modified time for %q: %w", r.Href, err)
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// StatusError is returned when a WebDAV server returns an unexpected status code.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+}
+
+// Error returns the string representation of the error.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webdav: %s %s: unexpected status: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// dirEntry represents a single child returned from a PROPFIND request.
+type dirEntry struct {
+	name    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// propfindBody requests only the properties required to build file metadata.
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:">
+	<D:prop>
+		<D:resourcetype/>
+		<D:getcontentlength/>
+		<D:getlastmodified/>
+	</D:prop>
+</D:propfind>`
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		ResourceType struct {
+			Collection *struct{} `xml:"DAV: collection"`
+		} `xml:"DAV: resourcetype"`
+		ContentLength string `xml:"DAV: getcontentlength"`
+		LastModified  string `xml:"DAV: getlastmodified"`
+	} `xml:"DAV: prop"`
+}
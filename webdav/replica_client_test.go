@@ -0,0 +1,175 @@
+package webdav_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/benbjohnson/litestream"
+	"github.com/benbjohnson/litestream/webdav"
+	xwebdav "golang.org/x/net/webdav"
+)
+
+func TestReplicaClient_Type(t *testing.T) {
+	if got, want := webdav.NewReplicaClient().Type(), "webdav"; got != want {
+		t.Fatalf("Type()=%v, want %v", got, want)
+	}
+}
+
+func TestReplicaClient_Init(t *testing.T) {
+	t.Run("ErrNoEndpoint", func(t *testing.T) {
+		if err := webdav.NewReplicaClient().Init(context.Background()); err == nil || err.Error() != `webdav endpoint required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// Ensure credentials are sent with every request.
+func TestReplicaClient_BasicAuth(t *testing.T) {
+	h := newHandler(t)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	c := webdav.NewReplicaClient()
+	c.Endpoint, c.User, c.Password, c.Path = s.URL, "alice", "secret", "db"
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 1000, strings.NewReader("foo")); err != nil {
+		t.Fatal(err)
+	} else if generations, err := c.Generations(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if len(generations) != 1 {
+		t.Fatalf("unexpected generations: %v", generations)
+	}
+
+	c = webdav.NewReplicaClient()
+	c.Endpoint, c.User, c.Password, c.Path = s.URL, "alice", "wrong", "db"
+	var statusErr *webdav.StatusError
+	if _, err := c.Generations(context.Background()); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure collections are only created once per client.
+func TestReplicaClient_MkdirAll(t *testing.T) {
+	t.Run("Cached", func(t *testing.T) {
+		c, mkcols, _ := newTestClient(t)
+
+		// db, generations, <generation>, snapshots
+		mustWriteSnapshot(t, c, 1000)
+		if got, want := mkcols.Load(), int64(4); got != want {
+			t.Fatalf("MKCOL=%d, want %d", got, want)
+		}
+
+		mustWriteSnapshot(t, c, 2000)
+		if got, want := mkcols.Load(), int64(4); got != want {
+			t.Fatalf("MKCOL=%d, want %d", got, want)
+		}
+
+		// Only the wal collection is new.
+		if _, err := c.WriteWALSegment(context.Background(), litestream.Pos{Generation: "b16ddcf5c697540f", Index: 1000}, strings.NewReader("foo")); err != nil {
+			t.Fatal(err)
+		} else if got, want := mkcols.Load(), int64(5); got != want {
+			t.Fatalf("MKCOL=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("DeleteGeneration", func(t *testing.T) {
+		c, mkcols, _ := newTestClient(t)
+
+		mustWriteSnapshot(t, c, 1000)
+		if err := c.DeleteGeneration(context.Background(), "b16ddcf5c697540f"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The generation & snapshots collections are recreated.
+		mustWriteSnapshot(t, c, 2000)
+		if got, want := mkcols.Load(), int64(6); got != want {
+			t.Fatalf("MKCOL=%d, want %d", got, want)
+		}
+	})
+
+	// Ensure a collection removed by another client is recreated after the
+	// next failed write.
+	t.Run("RemovedExternally", func(t *testing.T) {
+		c, _, root := newTestClient(t)
+
+		mustWriteSnapshot(t, c, 1000)
+		if err := os.RemoveAll(filepath.Join(root, "db", "generations")); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", 2000, strings.NewReader("foo")); err == nil {
+			t.Fatal("expected error")
+		}
+		mustWriteSnapshot(t, c, 2000)
+	})
+}
+
+func TestReplicaClient_GenerationMeta(t *testing.T) {
+	c, _, _ := newTestClient(t)
+
+	if _, err := c.GenerationMetaReader(context.Background(), "b16ddcf5c697540f"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := c.WriteGenerationMeta(context.Background(), "b16ddcf5c697540f", strings.NewReader(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := c.GenerationMetaReader(context.Background(), "b16ddcf5c697540f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if buf, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `{}`; got != want {
+		t.Fatalf("meta=%s, want %s", got, want)
+	}
+}
+
+// newHandler returns a WebDAV handler serving a temporary directory.
+func newHandler(tb testing.TB) *xwebdav.Handler {
+	return &xwebdav.Handler{
+		FileSystem: xwebdav.Dir(tb.TempDir()),
+		LockSystem: xwebdav.NewMemLS(),
+	}
+}
+
+// newTestClient returns a client for a test server that counts MKCOL
+// requests. Also returns the server's root directory.
+func newTestClient(tb testing.TB) (*webdav.ReplicaClient, *atomic.Int64, string) {
+	tb.Helper()
+
+	h := newHandler(tb)
+
+	var mkcols atomic.Int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "MKCOL" {
+			mkcols.Add(1)
+		}
+		h.ServeHTTP(w, r)
+	}))
+	tb.Cleanup(s.Close)
+
+	c := webdav.NewReplicaClient()
+	c.Endpoint, c.Path = s.URL, "db"
+	return c, &mkcols, string(h.FileSystem.(xwebdav.Dir))
+}
+
+func mustWriteSnapshot(tb testing.TB, c *webdav.ReplicaClient, index int) {
+	tb.Helper()
+	if _, err := c.WriteSnapshot(context.Background(), "b16ddcf5c697540f", index, strings.NewReader("foo")); err != nil {
+		tb.Fatal(err)
+	}
+}